@@ -0,0 +1,205 @@
+// anonymize-capture adds a stream recorded from a meter as seed for the fuzz targets of the sml package. The server
+// IDs and the values identifying the meter are replaced, frames which cannot be read are dropped.
+//
+//	go run ./cmd/anonymize-capture <meter>.bin
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sml-to-http/sml"
+	"strings"
+)
+
+// capturePrefix starts the names of the seeds recorded from meters, which are not generated by the tests.
+const capturePrefix = "capture_"
+
+func main() {
+	corpusFlag := flag.String("corpus", filepath.Join("sml", "testdata", "fuzz"), "The directory of the fuzz corpus to add the capture to.")
+
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		fmt.Printf("usage: anonymize-capture [-corpus <dir>] <capture>\n")
+		os.Exit(1)
+	}
+
+	if err := addCapture(flag.Arg(0), *corpusFlag); err != nil {
+		fmt.Printf("failed to add capture: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// addCapture anonymizes the files of a capture and writes them as seed for both fuzz targets.
+func addCapture(path string, corpus string) error {
+	data, err := os.ReadFile(path)
+
+	if err != nil {
+		return err
+	}
+
+	name := capturePrefix + strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	reader := sml.NewReaderWithOptions(bytes.NewReader(data), sml.ReaderOptions{
+		OnDiscardedFrame: func(frame sml.DiscardedFrame) {
+			fmt.Printf("dropping frame: %v\n", frame.Reason)
+		},
+	})
+	defer reader.Close()
+
+	stream := &bytes.Buffer{}
+	files := 0
+
+	for {
+		file, err := reader.ReadFile()
+
+		if err == io.EOF {
+			break
+		}
+
+		// Files which cannot be decoded have already been reported as dropped frame
+		var invalidFile *sml.InvalidFile
+
+		if errors.As(err, &invalidFile) {
+			continue
+		}
+
+		if err != nil {
+			return err
+		}
+
+		anonymize(reflect.ValueOf(file.Messages))
+
+		frame := &bytes.Buffer{}
+
+		if err := sml.NewWriter(frame).WriteFile(file); err != nil {
+			return err
+		}
+
+		stream.Write(frame.Bytes())
+
+		seed := filepath.Join(corpus, "FuzzDeserializeMessageBundle", fmt.Sprintf("%s_%d", name, files))
+
+		if err := writeSeed(seed, unescapedMessages(frame.Bytes())); err != nil {
+			return err
+		}
+
+		files++
+	}
+
+	if files == 0 {
+		return fmt.Errorf("%s does not contain any frames", path)
+	}
+
+	if err := writeSeed(filepath.Join(corpus, "FuzzReadMessageBundle", name), stream.Bytes()); err != nil {
+		return err
+	}
+
+	fmt.Printf("added %d files as %s, check that they do not contain any personal data before committing them\n", files, name)
+	return nil
+}
+
+// writeSeed writes an input in the corpus format of go test.
+func writeSeed(path string, input []byte) error {
+	return os.WriteFile(path, []byte(fmt.Sprintf("go test fuzz v1\n[]byte(%q)\n", input)), 0o644)
+}
+
+// unescapedMessages returns the messages of a frame written by the sml package, without the begin and end of
+// message markers, the escaping and the padding.
+func unescapedMessages(frame []byte) []byte {
+	escapeSequence := []byte{0x1b, 0x1b, 0x1b, 0x1b}
+	escapedEscapeSequence := []byte{0x1b, 0x1b, 0x1b, 0x1b, 0x1b, 0x1b, 0x1b, 0x1b}
+	padding := int(frame[len(frame)-3])
+	escaped := frame[8 : len(frame)-8]
+
+	messages := make([]byte, 0, len(escaped))
+
+	for i := 0; i < len(escaped); {
+		if bytes.HasPrefix(escaped[i:], escapedEscapeSequence) {
+			messages = append(messages, escapeSequence...)
+			i += 8
+			continue
+		}
+
+		messages = append(messages, escaped[i])
+		i++
+	}
+
+	return messages[:len(messages)-padding]
+}
+
+// identifyingObis are the entries and parameters whose value identifies the meter.
+var identifyingObis = map[string]bool{
+	"1-0:0.0.9*255":  true,
+	"1-0:96.1.0*255": true,
+	"0-0:96.1.0*255": true,
+}
+
+// anonymizeId replaces the serial number of a server ID. The type and manufacturer in the first 5 bytes of a
+// server ID of 10 bytes are kept, other IDs are replaced completely.
+func anonymizeId(id []byte) []byte {
+	anonymized := make([]byte, len(id))
+
+	if len(id) == 10 {
+		copy(anonymized, id[:5])
+	}
+
+	return anonymized
+}
+
+// anonymize replaces the server IDs, and the values of the entries and parameters identifying the meter.
+func anonymize(v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if !v.IsNil() {
+			anonymize(v.Elem())
+		}
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return
+		}
+
+		for i := 0; i < v.Len(); i++ {
+			anonymize(v.Index(i))
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+
+			if !field.IsExported() {
+				continue
+			}
+
+			switch field.Name {
+			case "ServerId":
+				if id := v.Field(i).Bytes(); len(id) != 0 {
+					v.Field(i).SetBytes(anonymizeId(id))
+				}
+			case "ObjName", "ParameterName":
+				if name, err := sml.ObisToString(v.Field(i).Bytes()); err == nil && identifyingObis[name] {
+					anonymizeValue(v)
+				}
+			default:
+				anonymize(v.Field(i))
+			}
+		}
+	}
+}
+
+// anonymizeValue replaces the octet string value of a ListEntry or Tree.
+func anonymizeValue(v reflect.Value) {
+	if field := v.FieldByName("ParameterValue"); field.IsValid() && !field.IsNil() {
+		anonymizeValue(field.Elem())
+	}
+
+	if field := v.FieldByName("Value"); field.IsValid() && field.Kind() == reflect.Interface {
+		if value, ok := field.Interface().([]byte); ok {
+			field.Set(reflect.ValueOf(anonymizeId(value)))
+		}
+	}
+}
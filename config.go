@@ -1,5 +1,7 @@
 package main
 
+import "sml-to-http/sml"
+
 type config struct {
 	Web    webConfig     `yaml:"web"`
 	Meters []meterConfig `yaml:"meters"`
@@ -18,4 +20,18 @@ type meterConfig struct {
 	ConnectTimeout      int    `yaml:"connect_timeout"`
 	DisableReceptionLog bool   `yaml:"disable_reception_log"`
 	Debug               bool   `yaml:"debug"`
+	PublicKey           string `yaml:"public_key"`
+
+	Lenient meterLenientConfig `yaml:"lenient"`
+
+	// verifier is created from the PublicKey when loading the configuration
+	verifier *sml.Verifier
+}
+
+type meterLenientConfig struct {
+	SkipFrameCrc          bool `yaml:"skip_frame_crc"`
+	AcceptSwappedCrc      bool `yaml:"accept_swapped_crc"`
+	AcceptPaddingMismatch bool `yaml:"accept_padding_mismatch"`
+	SkipMessageCrc        bool `yaml:"skip_message_crc"`
+	CoerceNumericWidths   bool `yaml:"coerce_numeric_widths"`
 }
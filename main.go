@@ -1,13 +1,21 @@
 package main
 
 import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
 	"sml-to-http/sml"
+	"strings"
+	"syscall"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
@@ -15,6 +23,8 @@ import (
 func main() {
 	configFileFlag := flag.String("config", "", "The config file")
 	dumpFlag := flag.String("dump", "", "A file to decode binary SML messages from for debugging. Prints the contents to the terminal and then exits.")
+	publicKeyFlag := flag.String("public-key", "", "The public key to verify the signatures of the dumped file with.")
+	formatFlag := flag.String("format", "text", "The format to dump files in: text, json or yaml.")
 
 	flag.Parse()
 
@@ -32,7 +42,7 @@ func main() {
 	}
 
 	if len(*dumpFlag) != 0 {
-		dumpFile(*dumpFlag)
+		dumpFile(*dumpFlag, *publicKeyFlag, *formatFlag)
 		return
 	}
 
@@ -44,11 +54,15 @@ func main() {
 
 	l := newLogger()
 
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	image := newProcessImageManager(cfg)
 	exporter := newWebExporter(image, l.newSubLogger("web"))
 	meters := newMeterManager(cfg.Meters, image, l.newSubLogger("meterManager"))
 
 	errorChannel := make(chan error)
+	metersStopped := make(chan interface{})
 
 	go func() {
 		err := exporter.serve(&cfg.Web)
@@ -61,15 +75,28 @@ func main() {
 	}()
 
 	go func() {
-		err := meters.run()
-		errorChannel <- err
+		meters.run(ctx)
+		close(metersStopped)
 	}()
 
-	for {
-		err := <-errorChannel
-
+	select {
+	case err := <-errorChannel:
 		log.Fatalf("subsystem returned error: %v", err)
+	case <-ctx.Done():
 	}
+
+	l.Printf("shutting down...")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err = exporter.shutdown(shutdownCtx)
+
+	if err != nil {
+		l.Printf("failed to shut down web server: %v", err)
+	}
+
+	<-metersStopped
 }
 
 func loadConfig(path string) (*config, error) {
@@ -97,10 +124,52 @@ func loadConfig(path string) (*config, error) {
 		return nil, err
 	}
 
+	for i := range c.Meters {
+		c.Meters[i].verifier, err = newVerifier(c.Meters[i].PublicKey)
+
+		if err != nil {
+			return nil, fmt.Errorf("meter %s: %w", c.Meters[i].Id, err)
+		}
+	}
+
 	return &c, nil
 }
 
-func dumpFile(filePath string) {
+// newVerifier creates a verifier for the public key, which may be empty if signatures are not verified.
+func newVerifier(publicKey string) (*sml.Verifier, error) {
+	if publicKey == "" {
+		return sml.NewVerifier(), nil
+	}
+
+	key, err := sml.ParsePublicKey(publicKey)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return sml.NewVerifier(key), nil
+}
+
+func dumpFile(filePath string, publicKey string, format string) {
+	if format != "text" && format != "json" && format != "yaml" {
+		fmt.Printf("unknown dump format %q\n", format)
+		os.Exit(1)
+	}
+
+	// Only the decoded files are written to stdout in the machine-readable formats
+	var diagnostics io.Writer = os.Stdout
+
+	if format != "text" {
+		diagnostics = os.Stderr
+	}
+
+	verifier, err := newVerifier(publicKey)
+
+	if err != nil {
+		fmt.Printf("failed to load public key: %v\n", err)
+		os.Exit(1)
+	}
+
 	f, err := os.OpenFile(filePath, os.O_RDONLY, 0)
 
 	if err != nil {
@@ -110,32 +179,94 @@ func dumpFile(filePath string) {
 
 	defer f.Close()
 
-	reader := sml.NewReader(f)
+	reader := sml.NewReaderWithOptions(f, sml.ReaderOptions{
+		OnDiscardedFrame: func(frame sml.DiscardedFrame) {
+			fmt.Fprintf(diagnostics, "%s\n\n", explainDiscardedFrame(frame))
+		},
+	})
+	defer reader.Close()
 
 	dumpedAny := false
+	yamlEncoder := yaml.NewEncoder(os.Stdout)
+	defer yamlEncoder.Close()
 
 	for {
 		var msg *sml.File
 		msg, err = reader.ReadFile()
 
+		// Files which cannot be decoded have already been explained as discarded frame
+		var invalidFile *sml.InvalidFile
+
+		if errors.As(err, &invalidFile) {
+			continue
+		}
+
 		if err != nil {
 			break
 		}
 
 		dumpedAny = true
-		fmt.Println("found file:")
-		fmt.Printf("%s\n\n", msg)
+
+		switch format {
+		case "json":
+			err = dumpJson(msg)
+		case "yaml":
+			err = yamlEncoder.Encode(msg)
+		default:
+			fmt.Printf("found file in frame of %s:\n", msg.Frame)
+			fmt.Printf("%s\n", msg)
+			fmt.Printf("%s\n\n", verifier.VerifyAll(msg))
+		}
+
+		if err != nil {
+			fmt.Fprintf(diagnostics, "failed to encode file: %v\n", err)
+			os.Exit(1)
+		}
 	}
 
 	if err == nil || err == io.EOF {
 		if !dumpedAny {
-			fmt.Printf("no valid sml files found in file\n")
+			fmt.Fprintf(diagnostics, "no valid sml files found in file\n")
 			os.Exit(2)
 		}
 
 		return
 	}
 
-	fmt.Printf("failed to read from file: %v\n", err)
+	fmt.Fprintf(diagnostics, "failed to read from file: %v\n", err)
 	os.Exit(1)
 }
+
+func dumpJson(f *sml.File) error {
+	marshal, err := json.MarshalIndent(f, "", "  ")
+
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%s\n", marshal)
+	return nil
+}
+
+// explainDiscardedFrame describes why a frame has been rejected.
+func explainDiscardedFrame(frame sml.DiscardedFrame) string {
+	s := fmt.Sprintf("discarded frame of %d bytes:\n", len(frame.Raw))
+
+	var invalid *sml.InvalidMessage
+
+	if errors.As(frame.Reason, &invalid) {
+		s += fmt.Sprintf("  reason: %v\n", invalid.Kind)
+		s += fmt.Sprintf("  offset: %d\n", invalid.Offset)
+
+		if invalid.Path != "" {
+			s += fmt.Sprintf("  field:  %s\n", invalid.Path)
+		}
+	} else if errors.Is(frame.Reason, sml.ErrFileStructure) {
+		s += fmt.Sprintf("  reason: %v\n", sml.ErrFileStructure)
+	}
+
+	s += fmt.Sprintf("  error:  %v\n", frame.Reason)
+	s += hex.Dump(frame.Raw)
+
+	return strings.TrimSuffix(s, "\n")
+}
@@ -1,12 +1,14 @@
 package main
 
 import (
+	"context"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"net"
 	"sml-to-http/sml"
+	"sync"
 	"time"
-
-	"golang.org/x/exp/constraints"
 )
 
 type meterManager struct {
@@ -20,7 +22,8 @@ type meterInstance struct {
 
 	logger logger
 
-	stopSignal chan interface{}
+	// The statistics of all previous connections
+	statistics sml.ReaderStatistics
 }
 
 func newMeterManager(meters []meterConfig, image *processImageManager, log logger) *meterManager {
@@ -39,43 +42,45 @@ func newMeterManager(meters []meterConfig, image *processImageManager, log logge
 				Values:    make(map[string]processImageMeterValue),
 			},
 			logger: meterLog.newSubLogger(meter.Id),
-
-			stopSignal: make(chan interface{}),
 		}
 	}
 
 	return m
 }
 
-func (m *meterManager) run() error {
-	errChan := make(chan error)
+// run reads all meters until the context is done and all connections are closed.
+func (m *meterManager) run(ctx context.Context) {
+	wg := &sync.WaitGroup{}
 
 	for _, i := range m.instances {
 		instance := i
+		wg.Add(1)
 
 		go func() {
-			err := instance.run()
-
-			if err != nil {
-				return
-			}
-
-			errChan <- err
+			defer wg.Done()
+			instance.run(ctx)
 		}()
 	}
 
-	err := <-errChan
-
-	return err
+	wg.Wait()
 }
 
-func (m *meterInstance) run() error {
+func (m *meterInstance) run(ctx context.Context) {
 	delay := false
 
 	for {
-		if delay {
+		if delay && ctx.Err() == nil {
 			m.logger.Printf("waiting %d seconds before reconnect...", m.config.ReconnectDelay)
-			time.Sleep(time.Duration(m.config.ReconnectDelay) * time.Second)
+
+			select {
+			case <-time.After(time.Duration(m.config.ReconnectDelay) * time.Second):
+			case <-ctx.Done():
+			}
+		}
+
+		if ctx.Err() != nil {
+			m.logger.Printf("stopped")
+			return
 		}
 
 		delay = true
@@ -87,7 +92,11 @@ func (m *meterInstance) run() error {
 		}
 
 		m.logger.Printf("connecting to %s...", m.config.Address)
-		conn, err := net.DialTimeout("tcp", m.config.Address, timeout)
+		dialer := &net.Dialer{
+			Timeout: timeout,
+		}
+
+		conn, err := dialer.DialContext(ctx, "tcp", m.config.Address)
 
 		if err != nil {
 			m.logger.Printf("dial failed: %v", err)
@@ -96,7 +105,7 @@ func (m *meterInstance) run() error {
 
 		m.logger.Printf("connection established")
 
-		err = m.handleConnection(conn)
+		err = m.handleConnection(ctx, conn)
 
 		if err != nil {
 			m.logger.Printf("connection error: %v", err)
@@ -104,10 +113,15 @@ func (m *meterInstance) run() error {
 	}
 }
 
-func (m *meterInstance) handleConnection(conn net.Conn) error {
+func (m *meterInstance) handleConnection(ctx context.Context, conn net.Conn) error {
 	defer func() {
 		m.processImageMeter.Connected = false
 		m.processImageMeter.LastUpdate = nil
+		m.processImageMeter.SensorTime = nil
+		m.processImageMeter.SensorSecIndex = nil
+		m.processImageMeter.ServerId = nil
+		m.processImageMeter.Status = nil
+		m.processImageMeter.ListSignature = ""
 		m.processImageMeter.Values = make(map[string]processImageMeterValue)
 		m.commitProcessImage()
 
@@ -117,7 +131,25 @@ func (m *meterInstance) handleConnection(conn net.Conn) error {
 	m.processImageMeter.Connected = true
 	m.commitProcessImage()
 
-	smlReader := sml.NewReader(conn)
+	var smlReader sml.Reader
+
+	smlReader = sml.NewReaderWithOptions(conn, sml.ReaderOptions{
+		SkipFrameCrc:          m.config.Lenient.SkipFrameCrc,
+		AcceptSwappedCrc:      m.config.Lenient.AcceptSwappedCrc,
+		AcceptPaddingMismatch: m.config.Lenient.AcceptPaddingMismatch,
+		SkipMessageCrc:        m.config.Lenient.SkipMessageCrc,
+		CoerceNumericWidths:   m.config.Lenient.CoerceNumericWidths,
+		OnDiscardedFrame: func(frame sml.DiscardedFrame) {
+			m.handleDiscardedFrame(frame, smlReader.Statistics())
+		},
+	})
+
+	defer func() {
+		_ = smlReader.Close()
+
+		m.statistics = addStatistics(m.statistics, smlReader.Statistics())
+		m.processImageMeter.Statistics = mapStatistics(m.statistics)
+	}()
 
 	for {
 		if m.config.ReadTimeout > 0 {
@@ -128,12 +160,33 @@ func (m *meterInstance) handleConnection(conn net.Conn) error {
 			}
 		}
 
-		f, err := smlReader.ReadFile()
+		f, err := smlReader.ReadFileContext(ctx)
 
 		if err != nil {
+			var cancelled *sml.ReadCancelled
+
+			if errors.As(err, &cancelled) {
+				if cancelled.MidFrame {
+					m.logger.Printf("closing connection, discarding partially received SML file")
+				} else {
+					m.logger.Printf("closing connection")
+				}
+
+				return nil
+			}
+
+			// Files which cannot be decoded have already been handled as discarded frame, the connection is kept
+			var invalidFile *sml.InvalidFile
+
+			if errors.As(err, &invalidFile) {
+				continue
+			}
+
 			return err
 		}
 
+		m.processImageMeter.Statistics = mapStatistics(addStatistics(m.statistics, smlReader.Statistics()))
+
 		if !m.config.DisableReceptionLog {
 			if m.config.Debug {
 				m.logger.Printf("received SML file:\n%s", f)
@@ -142,21 +195,52 @@ func (m *meterInstance) handleConnection(conn net.Conn) error {
 			}
 		}
 
-		if len(f.Messages) != 3 {
-			return fmt.Errorf("can only understand SML file with 3 messages, got %d", len(f.Messages))
+		m.processImageManager.updateLastFile(m.config.Id, f)
+
+		for _, relaxation := range f.Relaxations {
+			m.logger.Printf("accepted SML file despite %v", relaxation)
+		}
+
+		// Requests of other bus participants do not carry any values
+		if f.IsRequest() {
+			continue
+		}
+
+		// Attentions are recorded, values sent in the same file are still applied
+		attentions := f.AttentionErrors()
+
+		if len(attentions) != 0 {
+			m.handleAttentions(attentions)
+		}
+
+		// Other messages like unknown ones sent by gateways are ignored
+		var valueMessage *sml.GetListResMessageBody
+
+		for _, message := range f.Messages {
+			if body, ok := message.MessageBody.(*sml.GetListResMessageBody); ok {
+				valueMessage = body
+				break
+			}
 		}
 
-		valueMessage, ok := f.Messages[1].MessageBody.(*sml.GetListResMessageBody)
+		// Files like the responses to profile or parameter requests do not carry the current values
+		if valueMessage == nil {
+			if len(attentions) == 0 {
+				m.logger.Printf("ignoring SML file without SML_GetList.Res message")
+			}
 
-		if !ok {
-			return fmt.Errorf("SML_GetList.Res message required")
+			continue
 		}
 
 		procImage := m.processImageMeter
 
 		now := time.Now()
 		procImage.LastUpdate = &now
+		procImage.SensorTime, procImage.SensorSecIndex = mapSensorTime(valueMessage.ActSensorTime)
+		procImage.ServerId = mapServerId(valueMessage.ServerId)
 
+		procImage.Status = nil
+		procImage.ListSignature = m.mapSignature(m.config.verifier.VerifyList(valueMessage), "list")
 		procImage.Values = make(map[string]processImageMeterValue)
 
 		for _, value := range valueMessage.ValList {
@@ -172,58 +256,166 @@ func (m *meterInstance) handleConnection(conn net.Conn) error {
 	}
 }
 
+func (m *meterInstance) handleAttentions(attentions []*sml.AttentionError) {
+	for _, attention := range attentions {
+		m.logger.Printf("meter reported %v", attention)
+	}
+
+	lastAttention := attentions[len(attentions)-1].Error()
+
+	m.processImageMeter.AttentionCount += uint64(len(attentions))
+	m.processImageMeter.LastAttention = &lastAttention
+	m.commitProcessImage()
+}
+
+func (m *meterInstance) handleDiscardedFrame(frame sml.DiscardedFrame, statistics sml.ReaderStatistics) {
+	if !m.config.DisableReceptionLog {
+		if m.config.Debug {
+			m.logger.Printf("discarded SML frame: %v\n%s", frame.Reason, hex.Dump(frame.Raw))
+		} else {
+			m.logger.Printf("discarded SML frame: %v", frame.Reason)
+		}
+	}
+
+	m.processImageMeter.Statistics = mapStatistics(addStatistics(m.statistics, statistics))
+	m.commitProcessImage()
+}
+
+func addStatistics(a sml.ReaderStatistics, b sml.ReaderStatistics) sml.ReaderStatistics {
+	return sml.ReaderStatistics{
+		BytesRead:      a.BytesRead + b.BytesRead,
+		BytesSkipped:   a.BytesSkipped + b.BytesSkipped,
+		FramesOk:       a.FramesOk + b.FramesOk,
+		CrcFailures:    a.CrcFailures + b.CrcFailures,
+		EscapeErrors:   a.EscapeErrors + b.EscapeErrors,
+		PaddingErrors:  a.PaddingErrors + b.PaddingErrors,
+		DecodeFailures: a.DecodeFailures + b.DecodeFailures,
+	}
+}
+
+func mapStatistics(s sml.ReaderStatistics) processImageMeterStatistics {
+	return processImageMeterStatistics{
+		BytesRead:      s.BytesRead,
+		BytesSkipped:   s.BytesSkipped,
+		FramesOk:       s.FramesOk,
+		CrcFailures:    s.CrcFailures,
+		EscapeErrors:   s.EscapeErrors,
+		PaddingErrors:  s.PaddingErrors,
+		DecodeFailures: s.DecodeFailures,
+	}
+}
+
 func (m *meterInstance) commitProcessImage() {
 	m.processImageManager.updateMeterValues(m.config.Id, m.processImageMeter)
 }
 
+func mapSensorTime(t *sml.Time) (*time.Time, *uint32) {
+	if t == nil {
+		return nil, nil
+	}
+
+	if t.SecIndex != nil {
+		secIndex := *t.SecIndex
+		return nil, &secIndex
+	}
+
+	sensorTime, ok := t.Time()
+
+	if !ok {
+		return nil, nil
+	}
+
+	return &sensorTime, nil
+}
+
+func mapServerId(id []byte) *processImageMeterServerId {
+	p := &processImageMeterServerId{
+		Raw: hex.EncodeToString(id),
+	}
+
+	serverId, err := sml.ParseServerId(id)
+
+	if err != nil {
+		return p
+	}
+
+	p.MeterNumber = serverId.String()
+	p.Medium = &serverId.Medium
+	p.Manufacturer = serverId.Manufacturer
+	p.FabricationBlock = &serverId.FabricationBlock
+	p.SerialNumber = &serverId.SerialNumber
+
+	return p
+}
+
 func (m *meterInstance) mapValue(p *processImageMeter, value *sml.ListEntry) error {
-	obis, err := sml.ObisToString(value.ObjName)
+	obis, err := sml.ObisFromBytes(value.ObjName)
 
 	if err != nil {
 		return err
 	}
 
+	// Integers are published scaled, all other values as they are
 	val := value.Value
 
-	switch val.(type) {
-	case *int8:
-		val = smlScale(*val.(*int8), value.Scaler)
-	case *int16:
-		val = smlScale(*val.(*int16), value.Scaler)
-	case *int32:
-		val = smlScale(*val.(*int32), value.Scaler)
-	case *int64:
-		val = smlScale(*val.(*int64), value.Scaler)
-	case *uint8:
-		val = smlScale(*val.(*uint8), value.Scaler)
-	case *uint16:
-		val = smlScale(*val.(*uint16), value.Scaler)
-	case *uint32:
-		val = smlScale(*val.(*uint32), value.Scaler)
-	case *uint64:
-		val = smlScale(*val.(*uint64), value.Scaler)
-	}
-
-	p.Values[obis] = processImageMeterValue{
-		Value: val,
-		Unit:  value.Unit,
+	if scaled, ok := value.TypedValue().Scaled(); ok {
+		f, _ := scaled.Float64()
+		val = &f
+	}
+
+	v := processImageMeterValue{
+		Value:      val,
+		Unit:       uint8(value.Unit),
+		UnitSymbol: value.Unit.Symbol(),
+		Name:       obis.Name(),
 	}
 
+	if len(value.ValueSignature) != 0 {
+		v.Signature = m.mapSignature(m.config.verifier.VerifyListEntry(value), "value "+obis.String())
+	}
+
+	if status, ok := value.TypedStatus(); ok {
+		v.Status = mapStatus(status)
+	} else if obis == operatingStatusObis {
+		// Some meters transmit the status word as value of its own entry instead
+		if status, ok := sml.NewStatus(value.Value); ok {
+			v.Status = mapStatus(status)
+		}
+	}
+
+	// The meter status is the first one sent, usually the one of the imported energy
+	if p.Status == nil {
+		p.Status = v.Status
+	}
+
+	p.Values[obis.String()] = v
 	return nil
 }
 
-func smlScale[V constraints.Integer](v V, scaler int8) *float64 {
-	i := float64(v)
-
-	for scaler < 0 {
-		i /= 10
-		scaler++
+// mapSignature reports the state of a transmitted signature, which is empty for unsigned data.
+func (m *meterInstance) mapSignature(state sml.SignatureState, subject string) string {
+	if state == sml.SignatureUnsigned {
+		return ""
 	}
 
-	for scaler > 0 {
-		i *= 10
-		scaler--
+	if state == sml.SignatureFailed {
+		m.logger.Printf("invalid signature of %s", subject)
 	}
 
-	return &i
+	return state.String()
+}
+
+var operatingStatusObis = sml.Obis{1, 0, 96, 5, 0, 255}
+
+func mapStatus(s sml.Status) *processImageMeterStatus {
+	return &processImageMeterStatus{
+		Raw:                uint64(s),
+		EnergyExport:       s.Has(sml.StatusEnergyExport),
+		Manipulation:       s.Has(sml.StatusManipulation),
+		StartUp:            s.Has(sml.StatusStartUp),
+		PhaseFailureL1:     s.Has(sml.StatusPhaseFailureL1),
+		PhaseFailureL2:     s.Has(sml.StatusPhaseFailureL2),
+		PhaseFailureL3:     s.Has(sml.StatusPhaseFailureL3),
+		RotationFieldError: s.Has(sml.StatusRotationFieldError),
+	}
 }
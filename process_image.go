@@ -1,6 +1,7 @@
 package main
 
 import (
+	"sml-to-http/sml"
 	"sync"
 	"time"
 )
@@ -10,19 +11,68 @@ type processImage struct {
 }
 
 type processImageMeter struct {
-	Connected  bool                              `json:"connected"`
-	LastUpdate *time.Time                        `json:"lastUpdate"`
-	Values     map[string]processImageMeterValue `json:"values"`
+	Connected      bool                              `json:"connected"`
+	LastUpdate     *time.Time                        `json:"lastUpdate"`
+	SensorTime     *time.Time                        `json:"sensorTime"`
+	SensorSecIndex *uint32                           `json:"sensorSecIndex"`
+	ServerId       *processImageMeterServerId        `json:"serverId"`
+	Status         *processImageMeterStatus          `json:"status"`
+	ListSignature  string                            `json:"listSignature,omitempty"`
+	Values         map[string]processImageMeterValue `json:"values"`
+	AttentionCount uint64                            `json:"attentionCount"`
+	LastAttention  *string                           `json:"lastAttention"`
+	Statistics     processImageMeterStatistics       `json:"statistics"`
+}
+
+// processImageMeterStatistics are the reader statistics of a meter, accumulated over all connections.
+type processImageMeterStatistics struct {
+	BytesRead      uint64 `json:"bytesRead"`
+	BytesSkipped   uint64 `json:"bytesSkipped"`
+	FramesOk       uint64 `json:"framesOk"`
+	CrcFailures    uint64 `json:"crcFailures"`
+	EscapeErrors   uint64 `json:"escapeErrors"`
+	PaddingErrors  uint64 `json:"paddingErrors"`
+	DecodeFailures uint64 `json:"decodeFailures"`
+}
+
+// processImageMeterServerId is the server ID sent by a meter. The decoded fields are omitted, if the ID does not
+// contain a meter number according to DIN 43863-5.
+type processImageMeterServerId struct {
+	Raw              string  `json:"raw"`
+	MeterNumber      string  `json:"meterNumber,omitempty"`
+	Medium           *uint8  `json:"medium,omitempty"`
+	Manufacturer     string  `json:"manufacturer,omitempty"`
+	FabricationBlock *uint8  `json:"fabricationBlock,omitempty"`
+	SerialNumber     *uint32 `json:"serialNumber,omitempty"`
+}
+
+// processImageMeterStatus is a status word sent by a meter together with its decoded flags.
+type processImageMeterStatus struct {
+	Raw                uint64 `json:"raw"`
+	EnergyExport       bool   `json:"energyExport"`
+	Manipulation       bool   `json:"manipulation"`
+	StartUp            bool   `json:"startUp"`
+	PhaseFailureL1     bool   `json:"phaseFailureL1"`
+	PhaseFailureL2     bool   `json:"phaseFailureL2"`
+	PhaseFailureL3     bool   `json:"phaseFailureL3"`
+	RotationFieldError bool   `json:"rotationFieldError"`
 }
 
 type processImageMeterValue struct {
-	Value interface{} `json:"value"`
-	Unit  uint8       `json:"unit"`
+	Value      interface{}              `json:"value"`
+	Unit       uint8                    `json:"unit"`
+	UnitSymbol string                   `json:"unitSymbol,omitempty"`
+	Name       string                   `json:"name,omitempty"`
+	Status     *processImageMeterStatus `json:"status,omitempty"`
+	Signature  string                   `json:"signature,omitempty"`
 }
 
 type processImageManager struct {
 	image processImage
 	lock  sync.Mutex
+
+	// The last decoded file of every meter
+	lastFiles map[string]*sml.File
 }
 
 func newProcessImageManager(cfg *config) *processImageManager {
@@ -30,6 +80,7 @@ func newProcessImageManager(cfg *config) *processImageManager {
 		image: processImage{
 			Meters: make(map[string]processImageMeter),
 		},
+		lastFiles: make(map[string]*sml.File),
 	}
 
 	for _, m := range cfg.Meters {
@@ -56,3 +107,22 @@ func (i *processImageManager) get() processImage {
 
 	return i.image
 }
+
+func (i *processImageManager) updateLastFile(meterId string, f *sml.File) {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	i.lastFiles[meterId] = f
+}
+
+// getLastFile returns the last decoded file of a meter. The boolean is false for unknown meters.
+func (i *processImageManager) getLastFile(meterId string) (*sml.File, bool) {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	if _, ok := i.image.Meters[meterId]; !ok {
+		return nil, false
+	}
+
+	return i.lastFiles[meterId], true
+}
@@ -0,0 +1,79 @@
+package sml
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+)
+
+var attentionNumberPrefix = []byte{0x81, 0x81, 0xC7, 0xC7}
+
+var attentionNames = map[uint16]string{
+	0xFD00: "ok, positive acknowledgement",
+	0xFD01: "ok, attention will be delivered later",
+	0xFE00: "error, reason not specified",
+	0xFE01: "unknown SML designator",
+	0xFE02: "user/password not authorised",
+	0xFE03: "server id not available",
+	0xFE04: "request file id not available",
+	0xFE05: "one or more target attributes could not be written",
+	0xFE06: "one or more target attributes could not be read",
+	0xFE07: "communication with measuring point disrupted",
+	0xFE08: "raw data cannot be interpreted",
+	0xFE09: "value outside of the permitted range",
+	0xFE0A: "request not executed",
+	0xFE0B: "checksum incorrect",
+	0xFE0C: "broadcast not supported",
+	0xFE0D: "unexpected SML message",
+	0xFE0E: "unknown OBIS code",
+	0xFE0F: "data type not supported",
+	0xFE10: "optional element not supported",
+	0xFE11: "requested load profile has no entry",
+	0xFE12: "end limit before start limit",
+	0xFE13: "requested load profile not available in target area",
+	0xFE14: "requested list does not exist",
+}
+
+// AttentionName returns a human-readable description of the attention number, if it is known.
+func AttentionName(attentionNo []byte) (string, bool) {
+	if len(attentionNo) != 6 || !bytes.Equal(attentionNo[0:4], attentionNumberPrefix) {
+		return "", false
+	}
+
+	name, ok := attentionNames[uint16(attentionNo[4])<<8|uint16(attentionNo[5])]
+	return name, ok
+}
+
+// isAttentionError reports whether the attention number signals an error instead of an acknowledgement.
+func isAttentionError(attentionNo []byte) bool {
+	if len(attentionNo) != 6 || !bytes.Equal(attentionNo[0:4], attentionNumberPrefix) {
+		// Manufacturer specific attention numbers are treated as errors
+		return true
+	}
+
+	return attentionNo[4] != 0xFD
+}
+
+// AttentionError is the error a server reports by sending a SML_Attention.Res message.
+type AttentionError struct {
+	ServerId    []byte
+	AttentionNo []byte
+	Message     []byte
+	Details     *Tree
+}
+
+func (a *AttentionError) Error() string {
+	s := fmt.Sprintf("attention %s", hex.EncodeToString(a.AttentionNo))
+
+	if name, ok := AttentionName(a.AttentionNo); ok {
+		s += fmt.Sprintf(" (%s)", name)
+	}
+
+	s += fmt.Sprintf(" from server %s", stringServerId(a.ServerId))
+
+	if len(a.Message) != 0 {
+		s += fmt.Sprintf(": %q", string(a.Message))
+	}
+
+	return s
+}
@@ -0,0 +1,101 @@
+package sml
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestDecodeAttentionRes(t *testing.T) {
+	tests := []struct {
+		name    string
+		encoded string
+		wantErr string
+	}{
+		{
+			name:    "not authorised",
+			encoded: "74 0b 0a01454d4800007f9e31 07 8181c7c7fe02 01 01",
+			wantErr: "attention 8181c7c7fe02 (user/password not authorised) from server 0a01454d4800007f9e31 (1EMH0008363569)",
+		},
+		{
+			name:    "message and details",
+			encoded: "74 0b 0a01454d4800007f9e31 07 8181c7c7fe0e 08 3136372e302e30 73 07 0100100700ff 01 01",
+			wantErr: "attention 8181c7c7fe0e (unknown OBIS code) from server 0a01454d4800007f9e31 (1EMH0008363569): \"167.0.0\"",
+		},
+		{
+			name:    "manufacturer specific",
+			encoded: "74 0b 0a01454d4800007f9e31 07 8181c7c7e001 01 01",
+			wantErr: "attention 8181c7c7e001 from server 0a01454d4800007f9e31 (1EMH0008363569)",
+		},
+		{
+			name:    "acknowledgement",
+			encoded: "74 0b 0a01454d4800007f9e31 07 8181c7c7fd00 01 01",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := &AttentionResMessageBody{}
+
+			if err := decodeHex(t, tt.encoded, body); err != nil {
+				t.Fatal(err)
+			}
+
+			err := body.Err()
+
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Err() = %v, want nil", err)
+				}
+
+				return
+			}
+
+			var attention *AttentionError
+
+			if !errors.As(err, &attention) {
+				t.Fatalf("Err() = %v, want an *AttentionError", err)
+			}
+
+			if got := err.Error(); got != tt.wantErr {
+				t.Errorf("Error() = %s, want %s", got, tt.wantErr)
+			}
+
+			if !bytes.Equal(attention.AttentionNo, body.AttentionNo) || attention.Details != body.AttentionDetails {
+				t.Errorf("AttentionError = %+v, want the fields of %+v", attention, body)
+			}
+		})
+	}
+}
+
+func TestFileAttentionErrors(t *testing.T) {
+	var payload []byte
+
+	// The meter refuses to send the full data set, but still sends the values available without PIN
+	payload = append(payload, capturedMessage(t,
+		"05 00b1c2d1 6200 6200 72 630101 76 01 01 05 00b1c2d2 0b 0a01454d4800007f9e31 01 01")...)
+	payload = append(payload, capturedMessage(t,
+		"05 00b1c2d3 6200 6200 72 63ff01 74 0b 0a01454d4800007f9e31 07 8181c7c7fe02 01 01")...)
+	payload = append(payload, capturedMessage(t,
+		"05 00b1c2d4 6200 6200 72 630701 77 01 0b 0a01454d4800007f9e31 07 0100620affff 72 6201 65 00bc614e 71"+
+			"77 07 0100010800ff 0101 621e 52ff 56 0000001234 01"+
+			"01 01")...)
+	payload = append(payload, capturedMessage(t,
+		"05 00b1c2d5 6200 6200 72 630201 71 01")...)
+
+	file, err := NewReader(bytes.NewReader(fuzzFrame(payload))).ReadFile()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	attentions := file.AttentionErrors()
+
+	if len(attentions) != 1 || attentions[0].Error() != "attention 8181c7c7fe02 (user/password not authorised) from server 0a01454d4800007f9e31 (1EMH0008363569)" {
+		t.Errorf("AttentionErrors() = %v, want the refused authorisation", attentions)
+	}
+
+	if _, ok := file.Messages[2].MessageBody.(*GetListResMessageBody); !ok {
+		t.Errorf("MessageBody = %T, want *GetListResMessageBody", file.Messages[2].MessageBody)
+	}
+}
@@ -2,166 +2,405 @@ package sml
 
 import (
 	"bytes"
-	"encoding/binary"
+	"context"
 	"errors"
 	"fmt"
 	"io"
+	"sync"
+	"time"
 
 	"github.com/sigurn/crc16"
 )
 
+// maxTypeLengthFieldSize limits the type-length-field to 28 bits of length information.
+const maxTypeLengthFieldSize = 7
+
+// octetStringArenaSize is the size of the chunks octet strings are allocated from.
+const octetStringArenaSize = 1024
+
+var (
+	escapeSequence        = []byte{0x1b, 0x1b, 0x1b, 0x1b}
+	escapedEscapeSequence = []byte{0x1b, 0x1b, 0x1b, 0x1b, 0x1b, 0x1b, 0x1b, 0x1b}
+	beginOfMessageMarker  = []byte{0x1b, 0x1b, 0x1b, 0x1b, 0x01, 0x01, 0x01, 0x01}
+)
+
 type smlBinaryReader struct {
-	reader          io.Reader
-	ready           []byte
-	escapingToCheck []byte
+	reader  io.Reader
+	options ReaderOptions
+
+	// The context of the current read, if it can be cancelled
+	ctx context.Context
+	// The free space to read into and the results of the reads performed by the goroutine of readLoop
+	readRequests chan []byte
+	readResults  chan readResult
+	// Closed once the reader is closed, which stops the goroutine of readLoop. Close may be called concurrently
+	// with a read, so the channel is the only state shared with it.
+	closed    chan struct{}
+	closeOnce sync.Once
+
+	// The raw bytes read from the reader, which are not yet unescaped
+	buffer ringBuffer
+	// The unescaped bytes returned by readBuffer, reused for every call
+	scratch []byte
+	// An escaped 0x1b1b1b1b may be split up between two tokens, so the remainder is kept for the next read
+	pending       [4]byte
+	pendingLength int
+	// Octet strings are sliced from a shared chunk, which is replaced once it is exhausted
+	arena []byte
+	// The tokens of the current frame
+	tokens tokenAllocator
+	// The nesting depth of the list currently read
+	depth int
+	// The elements read so far of all lists currently read. A list is allocated once all of its elements
+	// have been read, so the memory used is bounded by the size of the frame instead of the announced counts.
+	elements []smlToken
+	// The messages of the current frame, reused for the next frame
+	bundle unparsedMessageBundle
 
 	crcTable      *crc16.Table
 	doCrc         bool
 	crc           uint16
 	crcDataLength int
+
+	// The CRC over the unescaped bytes of the current message, used to verify its embedded CRC
+	recording  bool
+	messageCrc uint16
+	// The unescaped bytes of the messages of the current frame
+	payload []byte
+
+	// The relaxed checks of the current frame
+	relaxations []Relaxation
+
+	// The escaped bytes of the current frame, starting with the begin of message marker
+	frame []byte
+	// A begin of message marker was found inside the previous frame, so the next frame has already started
+	beginPending bool
+	// The position of the begin of message marker of the current frame in the stream
+	frameOffset uint64
+	// The bytes skipped since the previous frame
+	frameSkipped uint64
+	// The reason to count, when the current frame is rejected
+	failure frameFailure
+	// The end of message marker is reused to avoid an allocation per frame
+	endOfMessage foundEndOfMessage
+
+	statistics ReaderStatistics
 }
 
-func newSmlBinaryReader(r io.Reader) *smlBinaryReader {
+// frameFailure classifies why a frame was rejected for the ReaderStatistics.
+type frameFailure int
+
+const (
+	failureDecode frameFailure = iota
+	failureCrc
+	failureEscape
+	failurePadding
+)
+
+func newSmlBinaryReader(r io.Reader, options ReaderOptions) *smlBinaryReader {
 	return &smlBinaryReader{
-		reader:          r,
-		ready:           make([]byte, 0),
-		escapingToCheck: make([]byte, 0),
-		crcTable:        crc16.MakeTable(crc16.CRC16_X_25),
-		doCrc:           false,
-		crc:             0,
+		reader:   r,
+		options:  options,
+		buffer:   newRingBuffer(),
+		closed:   make(chan struct{}),
+		crcTable: crc16.MakeTable(crc16.CRC16_X_25),
+		doCrc:    false,
+		crc:      0,
 	}
 }
 
 var foundBeginOfMessage = errors.New("found begin of message in stream")
-var escapeError = &InvalidMessage{
-	error: errors.New("escape error"),
-}
 
 type foundEndOfMessage struct {
 	countPaddingBytes  int
 	crcDataLength      int
 	expectedCheckSum   uint16
 	calculatedChecksum uint16
+	receivedAt         time.Time
 }
 
 func (f *foundEndOfMessage) Error() string {
 	return "found end of message in stream"
 }
 
-func (r *smlBinaryReader) readBuffer(wantedLength int) (data []byte, e error) {
-	if len(r.ready) >= wantedLength {
-		data = r.ready[0:wantedLength]
-		r.ready = r.ready[wantedLength:]
-		return
+// readBuffer returns the next unescaped bytes of the stream.
+// The returned slice is only valid until the next call.
+func (r *smlBinaryReader) readBuffer(wantedLength int) ([]byte, error) {
+	data, err := r.unescape(r.scratch[:0], wantedLength)
+
+	// Keep the grown slice for the next call
+	r.scratch = data
+
+	if err != nil {
+		return nil, err
 	}
 
-	forceRead := false
+	r.record(data)
+	return data, nil
+}
+
+// unescape appends wantedLength unescaped bytes of the stream to dst.
+// Escape sequences and begin and end of message markers are handled while the raw bytes are consumed.
+func (r *smlBinaryReader) unescape(dst []byte, wantedLength int) ([]byte, error) {
+	wanted := len(dst) + wantedLength
 
-	for {
-		// When we still have something to check for, do it first.
-		// We may already be EOF and the end of message marker needs to be returned.
-		// But only do it ONCE, because we might need more data for escape checking
-		if forceRead || len(r.escapingToCheck) == 0 {
-			tmp := make([]byte, 32)
-			n, err := r.reader.Read(tmp)
-
-			if err != nil {
-				e = err
-				return
+	for len(dst) < wanted {
+		if r.doCrc && len(r.frame) > r.options.MaxFrameSize {
+			return dst, newInvalidMessage(ErrLimitExceeded, "frame exceeds %d bytes", r.options.MaxFrameSize)
+		}
+
+		if r.pendingLength > 0 {
+			n := r.pendingLength
+
+			if n > wanted-len(dst) {
+				n = wanted - len(dst)
 			}
 
-			tmp = tmp[0:n]
+			dst = append(dst, r.pending[:n]...)
+			r.pendingLength = copy(r.pending[:], r.pending[n:r.pendingLength])
+			continue
+		}
+
+		available := r.buffer.len()
 
-			r.escapingToCheck = append(r.escapingToCheck, tmp...)
+		if available == 0 {
+			if err := r.fill(); err != nil {
+				return dst, err
+			}
+
+			continue
 		}
 
-		forceRead = true
+		if r.buffer.peek(0) != 0x1b {
+			data := r.buffer.contiguous()
 
-		for {
-			// When we have enough, return it immediately
-			// This way we can actually read everything before receiving a "found EOF marker" error
-			if len(r.ready) >= wantedLength {
-				data = r.ready[0:wantedLength]
-				r.ready = r.ready[wantedLength:]
-				return
+			if i := bytes.IndexByte(data, 0x1b); i >= 0 {
+				data = data[:i]
 			}
 
-			escapeOffset := bytes.IndexByte(r.escapingToCheck, 0x1b)
+			if len(data) > wanted-len(dst) {
+				data = data[:wanted-len(dst)]
+			}
+
+			dst = append(dst, data...)
+			r.appendCrc(data)
+			r.buffer.discard(len(data))
+			continue
+		}
+
+		// Only four 0x1b start an escape sequence, a single one is regular data
+		isEscapeSequence := true
 
-			if escapeOffset < 0 {
-				r.ready = append(r.ready, r.escapingToCheck...)
-				r.appendCrc(r.escapingToCheck)
-				r.escapingToCheck = make([]byte, 0)
+		for i := 1; i < 4 && i < available; i++ {
+			if r.buffer.peek(i) != 0x1b {
+				isEscapeSequence = false
 				break
 			}
+		}
 
-			if escapeOffset > 0 {
-				r.ready = append(r.ready, r.escapingToCheck[0:escapeOffset]...)
-				r.appendCrc(r.escapingToCheck[0:escapeOffset])
-				r.escapingToCheck = r.escapingToCheck[escapeOffset:]
-				continue
+		if !isEscapeSequence {
+			dst = append(dst, 0x1b)
+			r.appendCrc(escapeSequence[0:1])
+			r.buffer.discard(1)
+			continue
+		}
+
+		// The escape sequence is followed by 4 bytes, which we need to check
+		if available < 8 {
+			if err := r.fill(); err != nil {
+				return dst, err
 			}
 
-			// If we don't have 7 following bytes to check, loop around
-			if len(r.escapingToCheck) < 8 {
-				break
+			continue
+		}
+
+		var escapeData [4]byte
+
+		for i := range escapeData {
+			escapeData[i] = r.buffer.peek(4 + i)
+		}
+
+		r.buffer.discard(8)
+
+		switch {
+		// Encoded 0x1b1b1b1b
+		case escapeData == [4]byte{0x1b, 0x1b, 0x1b, 0x1b}:
+			copy(r.pending[:], escapeSequence)
+			r.pendingLength = len(escapeSequence)
+			r.appendCrc(escapedEscapeSequence)
+		// Encoded begin of message
+		case escapeData == [4]byte{0x01, 0x01, 0x01, 0x01}:
+			r.pendingLength = 0
+			r.crc = crc16.Init(r.crcTable)
+			r.crcDataLength = 0
+			r.doCrc = true
+			r.frameOffset = r.position() - 8
+
+			r.appendCrc(beginOfMessageMarker)
+			return dst, foundBeginOfMessage
+		// End of message
+		case escapeData[0] == 0x1a:
+			countPaddingBytes := escapeData[1]
+
+			if countPaddingBytes > 3 {
+				r.failure = failureEscape
+				r.recordFrame(escapeSequence)
+				r.recordFrame(escapeData[:])
+				return dst, newInvalidMessage(ErrEscape, "end of message marker announces %d padding bytes", countPaddingBytes)
 			}
 
-			// Handle escaping
-			if r.escapingToCheck[1] == 0x1b && r.escapingToCheck[2] == 0x1b && r.escapingToCheck[3] == 0x1b {
-				escapeData := r.escapingToCheck[4:8]
-				r.escapingToCheck = r.escapingToCheck[8:]
-
-				// Encoded 0x1b1b1b1b
-				if bytes.Compare(escapeData, []byte{0x1b, 0x1b, 0x1b, 0x1b}) == 0 {
-					r.ready = append(r.ready, escapeData...)
-					r.appendCrc([]byte{0x1b, 0x1b, 0x1b, 0x1b, 0x1b, 0x1b, 0x1b, 0x1b})
-				} else
-				// Encoded begin of message
-				if bytes.Compare(escapeData, []byte{0x01, 0x01, 0x01, 0x01}) == 0 {
-					r.ready = make([]byte, 0)
-
-					r.crc = crc16.Init(r.crcTable)
-					r.crcDataLength = 0
-					r.doCrc = true
-
-					r.appendCrc([]byte{
-						0x1b, 0x1b, 0x1b, 0x1b,
-						0x01, 0x01, 0x01, 0x01,
-					})
-					return nil, foundBeginOfMessage
-				} else
-				// End of message
-				if escapeData[0] == 0x1a {
-					countPaddingBytes := escapeData[1]
-
-					if countPaddingBytes > 3 {
-						return nil, escapeError
-					}
-
-					// Do not add the CRC bytes
-					r.appendCrc([]byte{0x1b, 0x1b, 0x1b, 0x1b})
-					r.appendCrc(escapeData[0:2])
-
-					checksum := crc16.Complete(r.crc, r.crcTable)
-					checksum = checksum&0x00FF<<8 | checksum&0xFF00>>8
-
-					return nil, &foundEndOfMessage{
-						countPaddingBytes:  int(countPaddingBytes),
-						expectedCheckSum:   uint16(escapeData[2])<<8 | uint16(escapeData[3]),
-						crcDataLength:      r.crcDataLength,
-						calculatedChecksum: checksum,
-					}
-				} else {
-					return nil, escapeError
-				}
-			} else {
-				r.ready = append(r.ready, r.escapingToCheck[0])
-				r.appendCrc(r.escapingToCheck[0:1])
-				r.escapingToCheck = r.escapingToCheck[1:]
+			// Do not add the CRC bytes
+			r.appendCrc(escapeSequence)
+			r.appendCrc(escapeData[0:2])
+			r.recordFrame(escapeData[2:4])
+
+			r.endOfMessage = foundEndOfMessage{
+				countPaddingBytes:  int(countPaddingBytes),
+				expectedCheckSum:   uint16(escapeData[2])<<8 | uint16(escapeData[3]),
+				crcDataLength:      r.crcDataLength,
+				calculatedChecksum: swapBytes(crc16.Complete(r.crc, r.crcTable)),
+				receivedAt:         time.Now(),
 			}
+
+			return dst, &r.endOfMessage
+		default:
+			r.failure = failureEscape
+			r.recordFrame(escapeSequence)
+			r.recordFrame(escapeData[:])
+			return dst, newInvalidMessage(ErrEscape, "unknown escape sequence %x", escapeData)
 		}
 	}
+
+	return dst, nil
+}
+
+// position returns the number of bytes of the stream processed so far.
+func (r *smlBinaryReader) position() uint64 {
+	return r.statistics.BytesRead - uint64(r.buffer.len())
+}
+
+// fill reads more raw bytes from the underlying reader.
+func (r *smlBinaryReader) fill() error {
+	// Give up on readers which repeatedly return neither data nor an error, like bufio.Reader does
+	for i := 0; i < 100; i++ {
+		n, err := r.read()
+		r.statistics.BytesRead += uint64(n)
+
+		// Process the data first, the error is returned again by the next read
+		if n > 0 {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return io.ErrNoProgress
+}
+
+type readResult struct {
+	n   int
+	err error
+}
+
+// readLoop performs the requested reads until the reader is closed.
+func readLoop(reader io.Reader, requests <-chan []byte, results chan<- readResult, closed <-chan struct{}) {
+	for {
+		select {
+		case free := <-requests:
+			n, err := reader.Read(free)
+			// The results are buffered, so a result nobody waits for anymore does not block
+			results <- readResult{n, err}
+		case <-closed:
+			return
+		}
+	}
+}
+
+// close stops the goroutine performing the cancellable reads. A read in progress is not interrupted, the
+// goroutine exits as soon as the underlying reader returns. It is safe to call close concurrently with a read,
+// which then returns ErrReaderClosed.
+func (r *smlBinaryReader) close() {
+	r.closeOnce.Do(func() {
+		close(r.closed)
+	})
+}
+
+func (r *smlBinaryReader) isClosed() bool {
+	select {
+	case <-r.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+// read performs a single read into the free space of the buffer, like bufio.Reader does.
+// While a context is set, the read is done by a goroutine, so waiting for it can be cancelled. The result of
+// a cancelled read is kept for the next read, so no data is lost. The goroutine is started by the first
+// cancellable read and performs all following cancellable ones, until the reader is closed.
+func (r *smlBinaryReader) read() (int, error) {
+	var done <-chan struct{}
+
+	if r.ctx != nil {
+		done = r.ctx.Done()
+	}
+
+	if r.isClosed() {
+		return 0, ErrReaderClosed
+	}
+
+	if !r.buffer.reading {
+		free := r.buffer.free()
+
+		if len(free) == 0 {
+			return 0, io.ErrShortBuffer
+		}
+
+		// Reads which can not be cancelled do not need a goroutine
+		if done == nil {
+			n, err := r.reader.Read(free)
+			r.buffer.commit(n)
+
+			return n, err
+		}
+
+		if r.readRequests == nil {
+			r.readRequests = make(chan []byte)
+			r.readResults = make(chan readResult, 1)
+
+			go readLoop(r.reader, r.readRequests, r.readResults, r.closed)
+		}
+
+		select {
+		case r.readRequests <- free:
+			r.buffer.reading = true
+		case <-r.closed:
+			return 0, ErrReaderClosed
+		}
+	}
+
+	select {
+	case result := <-r.readResults:
+		r.buffer.reading = false
+		r.buffer.commit(result.n)
+
+		return result.n, result.err
+	case <-done:
+		return 0, r.ctx.Err()
+	case <-r.closed:
+		return 0, ErrReaderClosed
+	}
+}
+
+func (r *smlBinaryReader) record(data []byte) {
+	if !r.recording {
+		return
+	}
+
+	r.messageCrc = crc16.Update(r.messageCrc, data, r.crcTable)
+	r.payload = append(r.payload, data...)
 }
 
 func (r *smlBinaryReader) appendCrc(data []byte) {
@@ -171,6 +410,16 @@ func (r *smlBinaryReader) appendCrc(data []byte) {
 
 	r.crc = crc16.Update(r.crc, data, r.crcTable)
 	r.crcDataLength = r.crcDataLength + len(data)
+	r.frame = append(r.frame, data...)
+}
+
+// recordFrame adds bytes to the raw frame, which are not covered by the transport CRC.
+func (r *smlBinaryReader) recordFrame(data []byte) {
+	if !r.doCrc {
+		return
+	}
+
+	r.frame = append(r.frame, data...)
 }
 
 func (r *smlBinaryReader) readTypeLength() (tlf binaryTypeLengthField, e error) {
@@ -182,39 +431,49 @@ func (r *smlBinaryReader) readTypeLength() (tlf binaryTypeLengthField, e error)
 	}
 
 	typeId := firstTlvByte[0] & 0x70 >> 4
-	dataLength := firstTlvByte[0] & 0x0F
+	dataLength := int(firstTlvByte[0] & 0x0F)
+	headerLength := 1
 	moreBytesFollowing := (firstTlvByte[0] & 0x80) != 0
 
-	if moreBytesFollowing {
-		nextByte, err := r.readBuffer(1)
-
-		if err != nil {
-			e = err
+	for moreBytesFollowing {
+		if headerLength == maxTypeLengthFieldSize {
+			e = newInvalidMessage(ErrInvalidToken, "SML type-length-fields with more than %d bytes are not supported", maxTypeLengthFieldSize)
 			return
 		}
 
-		moreBytesFollowing = (nextByte[0] & 0x80) != 0
+		nextByte, err := r.readBuffer(1)
 
-		if moreBytesFollowing {
-			e = &InvalidMessage{
-				error: errors.New("only SML type-length-fields with up to two bytes are supported"),
-			}
+		if err != nil {
+			e = err
 			return
 		}
 
 		if nextByteMode := (nextByte[0] & 0x70) >> 4; nextByteMode != 0 {
-			e = &InvalidMessage{
-				error: fmt.Errorf("unknown mode %1x for second SML tlv byte", nextByteMode),
-			}
+			e = newInvalidMessage(ErrInvalidToken, "unknown mode %1x for SML tlv byte %d", nextByteMode, headerLength+1)
 			return
 		}
 
-		dataLength = (dataLength << 4) | nextByte[0]&0x0F
+		moreBytesFollowing = (nextByte[0] & 0x80) != 0
+		dataLength = (dataLength << 4) | int(nextByte[0]&0x0F)
+		headerLength++
+	}
+
+	// Octet strings and numbers include the type-length-field in their length, lists only count their elements
+	payloadLength := dataLength
+
+	if typeId != 0x7 {
+		payloadLength -= headerLength
+	}
+
+	if payloadLength > r.options.MaxAllocation {
+		e = newInvalidMessage(ErrInvalidToken, "SML type-length-field announces %d, but at most %d are allowed", payloadLength, r.options.MaxAllocation)
+		return
 	}
 
 	tlf = binaryTypeLengthField{
 		typeId,
-		int(dataLength),
+		dataLength,
+		headerLength,
 	}
 	e = nil
 	return
@@ -227,49 +486,67 @@ func (r *smlBinaryReader) readToken() (smlToken, error) {
 		return nil, err
 	}
 
+	return r.readTokenValue(&tlf)
+}
+
+func (r *smlBinaryReader) readTokenValue(tlf *binaryTypeLengthField) (smlToken, error) {
 	if tlf.dataLength == 0 && tlf.dataType == 0 {
-		return &smlEndOfMessage{}, nil
+		return endOfMessageToken, nil
 	}
 
 	switch tlf.dataType {
 	case 0x0:
-		return r.readOctetString(&tlf)
+		return r.readOctetString(tlf)
 	case 0x4:
-		return r.readBoolean(&tlf)
+		return r.readBoolean(tlf)
 	case 0x5, 0x6:
-		return r.readNumber(&tlf)
+		return r.readNumber(tlf)
 	case 0x7:
-		return r.readList(&tlf)
+		return r.readList(tlf)
 	default:
-		return nil, &InvalidMessage{
-			error: fmt.Errorf("unknown SML type %1x", tlf.dataType),
-		}
+		return nil, newInvalidMessage(ErrInvalidToken, "unknown SML type %1x", tlf.dataType)
 	}
 }
 
 func (r *smlBinaryReader) readOctetString(tlf *binaryTypeLengthField) (smlToken, error) {
-	if tlf.dataLength == 0 {
-		return nil, &InvalidMessage{
-			error: fmt.Errorf("invalid data length value %d for octet string", tlf.dataLength),
+	// The length of octet strings includes the type-length-field itself
+	if tlf.dataLength < tlf.headerLength {
+		return nil, newInvalidMessage(ErrInvalidToken, "invalid data length value %d for octet string", tlf.dataLength)
+	}
+
+	length := tlf.dataLength - tlf.headerLength
+
+	if cap(r.arena)-len(r.arena) < length {
+		arenaSize := octetStringArenaSize
+
+		if length > arenaSize {
+			arenaSize = length
 		}
+
+		r.arena = make([]byte, 0, arenaSize)
 	}
 
-	data, err := r.readBuffer(tlf.dataLength - 1)
+	start := len(r.arena)
+	arena, err := r.unescape(r.arena, length)
 
 	if err != nil {
 		return nil, err
 	}
 
-	return &smlOctetString{
-		value: data,
-	}, nil
+	// Limit the capacity, so appending to the value never overwrites the following octet string
+	r.arena = arena
+	data := arena[start:len(arena):len(arena)]
+	r.record(data)
+
+	token := allocateToken(&r.tokens.octetStrings)
+	token.value = data
+
+	return token, nil
 }
 
 func (r *smlBinaryReader) readBoolean(tlf *binaryTypeLengthField) (smlToken, error) {
 	if tlf.dataLength != 2 {
-		return nil, &InvalidMessage{
-			error: fmt.Errorf("invalid data length %d for SML boolean", tlf.dataLength),
-		}
+		return nil, newInvalidMessage(ErrInvalidToken, "invalid data length %d for SML boolean", tlf.dataLength)
 	}
 
 	data, err := r.readBuffer(1)
@@ -278,13 +555,18 @@ func (r *smlBinaryReader) readBoolean(tlf *binaryTypeLengthField) (smlToken, err
 		return nil, err
 	}
 
-	return &smlBoolean{
-		value: data[0] != 0x00,
-	}, nil
+	token := allocateToken(&r.tokens.booleans)
+	token.value = data[0] != 0x00
+
+	return token, nil
 }
 
 func (r *smlBinaryReader) readNumber(tlf *binaryTypeLengthField) (smlToken, error) {
-	realDataLength := tlf.dataLength - 1
+	realDataLength := tlf.dataLength - tlf.headerLength
+
+	if realDataLength < 1 || realDataLength > 8 {
+		return nil, newInvalidMessage(ErrInvalidToken, "unsupported numeric SML type with type %1x and length %d", tlf.dataType, tlf.dataLength)
+	}
 
 	data, err := r.readBuffer(realDataLength)
 
@@ -292,80 +574,80 @@ func (r *smlBinaryReader) readNumber(tlf *binaryTypeLengthField) (smlToken, erro
 		return nil, err
 	}
 
-	// Fill up bytes...
-	if realDataLength == 3 {
-		realDataLength = 4
-	} else if realDataLength >= 5 && realDataLength <= 7 {
-		realDataLength = 8
-	}
+	var value uint64
 
-	for len(data) != realDataLength {
-		data = append([]byte{0}, data...)
+	for _, b := range data {
+		value = value<<8 | uint64(b)
 	}
 
-	dataReader := bytes.NewReader(data)
-	var token smlToken
-
+	// Numbers of uncommon lengths are extended to the next larger type
 	switch tlf.dataType {
 	// Signed
 	case 0x5:
-		switch realDataLength {
-		case 1:
-			var v smlSigned8
-			err = binary.Read(dataReader, binary.BigEndian, &v.value)
-			token = &v
-		case 2:
-			var v smlSigned16
-			err = binary.Read(dataReader, binary.BigEndian, &v.value)
-			token = &v
-		case 4:
-			var v smlSigned32
-			err = binary.Read(dataReader, binary.BigEndian, &v.value)
-			token = &v
-		case 8:
-			var v smlSigned64
-			err = binary.Read(dataReader, binary.BigEndian, &v.value)
-			token = &v
+		shift := uint(64 - 8*realDataLength)
+		value = uint64(int64(value<<shift) >> shift)
+
+		switch {
+		case realDataLength == 1:
+			token := allocateToken(&r.tokens.signed8)
+			token.value = int8(value)
+			return token, nil
+		case realDataLength == 2:
+			token := allocateToken(&r.tokens.signed16)
+			token.value = int16(value)
+			return token, nil
+		case realDataLength <= 4:
+			token := allocateToken(&r.tokens.signed32)
+			token.value = int32(value)
+			return token, nil
+		default:
+			token := allocateToken(&r.tokens.signed64)
+			token.value = int64(value)
+			return token, nil
 		}
 	// Unsigned
 	case 0x6:
-		switch realDataLength {
-		case 1:
-			var v smlUnsigned8
-			err = binary.Read(dataReader, binary.BigEndian, &v.value)
-			token = &v
-		case 2:
-			var v smlUnsigned16
-			err = binary.Read(dataReader, binary.BigEndian, &v.value)
-			token = &v
-		case 4:
-			var v smlUnsigned32
-			err = binary.Read(dataReader, binary.BigEndian, &v.value)
-			token = &v
-		case 8:
-			var v smlUnsigned64
-			err = binary.Read(dataReader, binary.BigEndian, &v.value)
-			token = &v
+		switch {
+		case realDataLength == 1:
+			token := allocateToken(&r.tokens.unsigned8)
+			token.value = uint8(value)
+			return token, nil
+		case realDataLength == 2:
+			token := allocateToken(&r.tokens.unsigned16)
+			token.value = uint16(value)
+			return token, nil
+		case realDataLength <= 4:
+			token := allocateToken(&r.tokens.unsigned32)
+			token.value = uint32(value)
+			return token, nil
+		default:
+			token := allocateToken(&r.tokens.unsigned64)
+			token.value = value
+			return token, nil
 		}
 	}
 
-	if err != nil {
-		return nil, err
-	}
-
-	if token == nil {
-		return nil, &InvalidMessage{
-			error: fmt.Errorf("unsupported numeric SML type with type %1x and length %d", tlf.dataType, tlf.dataLength),
-		}
-	}
-
-	return token, nil
+	return nil, newInvalidMessage(ErrInvalidToken, "unsupported numeric SML type with type %1x and length %d", tlf.dataType, tlf.dataLength)
 }
 
 func (r *smlBinaryReader) readList(tlf *binaryTypeLengthField) (smlToken, error) {
+	r.depth++
+	defer func() {
+		r.depth--
+	}()
+
+	if r.depth > r.options.MaxDepth {
+		return nil, newInvalidMessage(ErrLimitExceeded, "lists nested deeper than %d levels", r.options.MaxDepth)
+	}
+
+	// The type-length-field has already been recorded
+	start := len(r.payload) - tlf.headerLength
 	elementCount := tlf.dataLength
+	base := len(r.elements)
 
-	tokens := make([]smlToken, elementCount)
+	defer func() {
+		r.elements = r.elements[:base]
+	}()
 
 	for i := 0; i < elementCount; i++ {
 		token, err := r.readToken()
@@ -374,43 +656,181 @@ func (r *smlBinaryReader) readList(tlf *binaryTypeLengthField) (smlToken, error)
 			return nil, err
 		}
 
-		tokens[i] = token
+		r.elements = append(r.elements, token)
 	}
 
-	return &smlList{
-		value: tokens,
-	}, nil
+	tokens := r.tokens.listElements(elementCount)
+	copy(tokens, r.elements[base:])
+
+	list := allocateToken(&r.tokens.lists)
+	list.value = tokens
+	list.start = start
+	list.end = len(r.payload)
+
+	return list, nil
 }
 
-func (r *smlBinaryReader) readMessageBundleWithoutRetry() (*unparsedMessageBundle, error) {
-	r.doCrc = false
-	r.crc = 0
-	r.crcDataLength = 0
+// readMessage reads a token on the top level of a message bundle.
+// The CRC16 embedded into each message is verified against the bytes of the message preceding it.
+func (r *smlBinaryReader) readMessage() (smlToken, error) {
+	r.messageCrc = crc16.Init(r.crcTable)
+	r.recording = true
+	start := len(r.payload)
 
-	for {
-		_, err := r.readBuffer(1)
+	defer func() {
+		r.recording = false
+	}()
 
-		if err == foundBeginOfMessage {
-			break
+	tlf, err := r.readTypeLength()
+
+	if err != nil {
+		return nil, err
+	}
+
+	// Padding bytes or garbage, which is handled by the caller
+	if tlf.dataType != 0x7 {
+		return r.readTokenValue(&tlf)
+	}
+
+	// The CRC is embedded as fifth element, lists of other lengths cannot be verified
+	if tlf.dataLength != 6 {
+		return nil, newInvalidMessage(ErrStructSizeMismatch, "SML message must be a list of 6 elements, got %d", tlf.dataLength)
+	}
+
+	r.depth++
+	defer func() {
+		r.depth--
+	}()
+
+	tokens := r.tokens.listElements(tlf.dataLength)
+	var checksum uint16
+
+	for i := range tokens {
+		if i == 4 {
+			checksum = swapBytes(crc16.Complete(r.messageCrc, r.crcTable))
 		}
 
-		if err == nil {
-			continue
+		tokens[i], err = r.readToken()
+
+		if err != nil {
+			return nil, err
 		}
+	}
 
-		return nil, err
+	var expectedChecksum uint16
+
+	switch crc := tokens[4].(type) {
+	case *smlUnsigned16:
+		expectedChecksum = crc.value
+	case *smlUnsigned8:
+		expectedChecksum = uint16(crc.value)
+	default:
+		return nil, newInvalidMessage(ErrTypeMismatch, "expected message crc, but got %v", tokens[4])
+	}
+
+	end := len(r.payload)
+
+	if checksum != expectedChecksum {
+		err := r.relaxChecksum(RelaxationMessageCrc, r.options.SkipMessageCrc, expectedChecksum, checksum, newInvalidMessage(ErrCrcMismatch, "message crc: expected %04x, calculated %04x", expectedChecksum, checksum))
+
+		if err != nil {
+			r.failure = failureCrc
+			return nil, err
+		}
+
+		// The received encoding is not kept for messages with an invalid CRC, so it is calculated again when writing
+		end = start
 	}
 
-	message := &unparsedMessageBundle{
-		messages: make([]*smlList, 0),
+	list := allocateToken(&r.tokens.lists)
+	list.value = tokens
+	list.start = start
+	list.end = end
+
+	return list, nil
+}
+
+func (r *smlBinaryReader) relax(kind RelaxationKind, detail string) {
+	r.relaxations = append(r.relaxations, Relaxation{
+		Kind:   kind,
+		Detail: detail,
+	})
+}
+
+// relaxChecksum decides whether a checksum mismatch is accepted due to the options and returns err otherwise.
+func (r *smlBinaryReader) relaxChecksum(kind RelaxationKind, skip bool, expected uint16, calculated uint16, err error) error {
+	detail := fmt.Sprintf("expected %04x, calculated %04x", expected, calculated)
+
+	if r.options.AcceptSwappedCrc && swapBytes(calculated) == expected {
+		r.relax(RelaxationSwappedCrc, fmt.Sprintf("%s: %s", kind, detail))
+		return nil
 	}
 
+	if skip {
+		r.relax(kind, detail)
+		return nil
+	}
+
+	return err
+}
+
+func swapBytes(v uint16) uint16 {
+	return v&0x00FF<<8 | v&0xFF00>>8
+}
+
+func (r *smlBinaryReader) readMessageBundleWithoutRetry() (*unparsedMessageBundle, error) {
+	r.relaxations = nil
+
+	if r.beginPending {
+		// The begin of message marker was already consumed while reading the previous frame
+		r.beginPending = false
+	} else {
+		r.doCrc = false
+		r.crc = 0
+		r.crcDataLength = 0
+		r.frame = r.frame[:0]
+
+		for {
+			before := r.position()
+			_, err := r.readBuffer(1)
+
+			if err == foundBeginOfMessage {
+				break
+			}
+
+			// Stray end of message markers and invalid escape sequences are skipped like any other data
+			_, isEndOfMessage := err.(*foundEndOfMessage)
+			_, isInvalid := err.(*InvalidMessage)
+
+			if err == nil || isEndOfMessage || isInvalid {
+				r.statistics.BytesSkipped += r.position() - before
+				r.frameSkipped += r.position() - before
+				continue
+			}
+
+			return nil, err
+		}
+	}
+
+	// Invalid escape sequences skipped while searching for the begin of the frame do not belong to it
+	r.failure = failureDecode
+	r.tokens.reset()
+	r.payload = r.payload[:0]
+
+	message := &r.bundle
+	message.messages = message.messages[:0]
+	message.payload = nil
+	message.relaxations = nil
+	message.raw = nil
+	message.offsets = message.offsets[:0]
+
 	var endOfMessageMarker *foundEndOfMessage
 
 	endOfMessageCount := 0
 
 	for {
-		tok, err := r.readToken()
+		offset := r.position()
+		tok, err := r.readMessage()
 
 		if err != nil {
 			if marker, ok := err.(*foundEndOfMessage); ok {
@@ -428,49 +848,62 @@ func (r *smlBinaryReader) readMessageBundleWithoutRetry() (*unparsedMessageBundl
 
 			if endOfMessageCount > 3 {
 				// 0 to 3 zero-bytes may come
-				return nil, &InvalidMessage{
-					error: errors.New("excessive padding bytes found"),
-				}
+				r.failure = failurePadding
+				return nil, newInvalidMessage(ErrPadding, "more than 3 padding bytes found")
 			}
 
 			continue
 		}
 
 		if endOfMessageCount > 0 {
-			return nil, &InvalidMessage{
-				error: errors.New("unexpected data after end of message marker"),
-			}
+			return nil, newInvalidMessage(ErrPadding, "unexpected data after end of message marker")
 		}
 
 		list, ok := tok.(*smlList)
 
 		if !ok {
-			return nil, &InvalidMessage{
-				error: fmt.Errorf("expected SML list, but got %v", tok),
-			}
+			return nil, newInvalidMessage(ErrTypeMismatch, "expected SML list, but got %v", tok)
 		}
 
 		message.messages = append(message.messages, list)
+		message.offsets = append(message.offsets, offset)
 	}
 
 	if (endOfMessageMarker.crcDataLength-2)%4 != 0 {
-		return nil, &InvalidMessage{
-			error: fmt.Errorf("data must be divisible by 4"),
+		if !r.options.AcceptPaddingMismatch {
+			r.failure = failurePadding
+			return nil, newInvalidMessage(ErrPadding, "data must be divisible by 4")
 		}
+
+		r.relax(RelaxationPaddingMismatch, fmt.Sprintf("frame length %d is not divisible by 4", endOfMessageMarker.crcDataLength-2))
 	}
 
 	if endOfMessageMarker.countPaddingBytes != endOfMessageCount {
-		return nil, &InvalidMessage{
-			error: fmt.Errorf("expected %d padding bytes, found %d", endOfMessageMarker.countPaddingBytes, endOfMessageCount),
+		if !r.options.AcceptPaddingMismatch {
+			r.failure = failurePadding
+			return nil, newInvalidMessage(ErrPadding, "expected %d padding bytes, found %d", endOfMessageMarker.countPaddingBytes, endOfMessageCount)
 		}
+
+		r.relax(RelaxationPaddingMismatch, fmt.Sprintf("expected %d padding bytes, found %d", endOfMessageMarker.countPaddingBytes, endOfMessageCount))
 	}
 
 	if endOfMessageMarker.calculatedChecksum != endOfMessageMarker.expectedCheckSum {
-		return nil, &InvalidMessage{
-			error: fmt.Errorf("crc error: expected %02x, calculated %02x", endOfMessageMarker.expectedCheckSum, endOfMessageMarker.calculatedChecksum),
+		err := r.relaxChecksum(RelaxationFrameCrc, r.options.SkipFrameCrc, endOfMessageMarker.expectedCheckSum, endOfMessageMarker.calculatedChecksum, newInvalidMessage(ErrCrcMismatch, "transport crc: expected %04x, calculated %04x", endOfMessageMarker.expectedCheckSum, endOfMessageMarker.calculatedChecksum))
+
+		if err != nil {
+			r.failure = failureCrc
+			return nil, err
 		}
 	}
 
+	message.relaxations = r.relaxations
+	message.payload = r.payload
+	message.raw = r.frame
+	message.offset = r.frameOffset
+	message.skipped = r.frameSkipped
+	message.crc = endOfMessageMarker.expectedCheckSum
+	message.padding = endOfMessageMarker.countPaddingBytes
+	message.receivedAt = endOfMessageMarker.receivedAt
 	return message, nil
 }
 
@@ -479,17 +912,69 @@ func (r *smlBinaryReader) readMessageBundle() (*unparsedMessageBundle, error) {
 		msg, err := r.readMessageBundleWithoutRetry()
 
 		if err == nil {
+			r.frameSkipped = 0
 			return msg, nil
 		}
 
+		// Errors while searching for the begin of a frame only skip bytes
+		inFrame := r.doCrc
+
+		if err == foundBeginOfMessage {
+			// A new frame started before the current one was complete.
+			// The begin of message marker was the last thing recorded and starts the next frame.
+			marker := len(r.frame) - 8
+			invalid := newInvalidMessage(ErrIncompleteFrame, "unexpected begin of message inside frame")
+			invalid.setOffset(r.frameOffset)
+			r.discardFrame(r.failure, invalid, r.frame[:marker])
+
+			r.frame = append(r.frame[:0], r.frame[marker:]...)
+			r.beginPending = true
+			continue
+		}
+
 		if _, ok := err.(*foundEndOfMessage); ok {
+			if inFrame {
+				invalid := newInvalidMessage(ErrIncompleteFrame, "unexpected end of message inside SML message")
+				invalid.setOffset(r.position())
+				r.discardFrame(r.failure, invalid, r.frame)
+			}
+
 			continue
 		}
 
-		if _, ok := err.(*InvalidMessage); ok {
+		if invalid, ok := err.(*InvalidMessage); ok {
+			invalid.setOffset(r.position())
+
+			if inFrame {
+				r.discardFrame(r.failure, err, r.frame)
+			}
+
 			continue
 		}
 
 		return nil, err
 	}
 }
+
+// discardFrame counts a rejected frame and passes it to the diagnostics callback.
+func (r *smlBinaryReader) discardFrame(failure frameFailure, reason error, raw []byte) {
+	switch failure {
+	case failureCrc:
+		r.statistics.CrcFailures++
+	case failureEscape:
+		r.statistics.EscapeErrors++
+	case failurePadding:
+		r.statistics.PaddingErrors++
+	default:
+		r.statistics.DecodeFailures++
+	}
+
+	r.frameSkipped = 0
+
+	if r.options.OnDiscardedFrame != nil {
+		r.options.OnDiscardedFrame(DiscardedFrame{
+			Reason: reason,
+			Raw:    append([]byte(nil), raw...),
+		})
+	}
+}
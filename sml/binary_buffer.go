@@ -0,0 +1,70 @@
+package sml
+
+// ringBufferSize is the size of the receive buffer of a reader, which must be a power of two.
+const ringBufferSize = 4096
+
+// ringBuffer buffers the raw bytes read from the underlying reader without allocating.
+type ringBuffer struct {
+	data  []byte
+	start int
+	size  int
+
+	// A read into the free space is in progress, so the buffered bytes must not be moved
+	reading bool
+}
+
+func newRingBuffer() ringBuffer {
+	return ringBuffer{
+		data: make([]byte, ringBufferSize),
+	}
+}
+
+// len returns the number of buffered bytes.
+func (b *ringBuffer) len() int {
+	return b.size
+}
+
+// peek returns the buffered byte at offset i, which must be less than len.
+func (b *ringBuffer) peek(i int) byte {
+	return b.data[(b.start+i)&(len(b.data)-1)]
+}
+
+// contiguous returns the buffered bytes up to the end of the underlying array.
+// The slice is only valid until the buffer is filled again.
+func (b *ringBuffer) contiguous() []byte {
+	end := b.start + b.size
+
+	if end > len(b.data) {
+		end = len(b.data)
+	}
+
+	return b.data[b.start:end]
+}
+
+// discard drops n buffered bytes, which must not exceed len.
+func (b *ringBuffer) discard(n int) {
+	b.start = (b.start + n) & (len(b.data) - 1)
+	b.size -= n
+
+	// Start over at the beginning, so the next read is not split at the end of the array
+	if b.size == 0 && !b.reading {
+		b.start = 0
+	}
+}
+
+// free returns the contiguous free space after the buffered bytes, which is filled by the next read.
+func (b *ringBuffer) free() []byte {
+	end := (b.start + b.size) & (len(b.data) - 1)
+	free := len(b.data) - b.size
+
+	if end+free > len(b.data) {
+		free = len(b.data) - end
+	}
+
+	return b.data[end : end+free]
+}
+
+// commit adds n bytes read into the free space to the buffered bytes.
+func (b *ringBuffer) commit(n int) {
+	b.size += n
+}
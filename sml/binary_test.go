@@ -0,0 +1,360 @@
+package sml
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"io"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+// benchmarkFile resembles the file sent every second by an eHZ or DTZ meter over its optical interface.
+func benchmarkFile() *File {
+	serverId := []byte{0x0a, 0x01, 0x45, 0x4d, 0x48, 0x00, 0x00, 0x7f, 0x9e, 0x31}
+	secIndex := uint32(12345678)
+	status := uint32(0x00020204)
+
+	entry := func(obis []byte, unit Unit, scaler int8, value interface{}) *ListEntry {
+		return &ListEntry{
+			ObjName: obis,
+			Unit:    unit,
+			Scaler:  scaler,
+			Value:   value,
+		}
+	}
+
+	manufacturer := []byte("EMH")
+	energyIn := uint64(123456789)
+	energyOut := uint64(2345678)
+	tariff1 := uint64(123456789)
+	tariff2 := uint64(0)
+	power := int32(-3210)
+
+	valList := []*ListEntry{
+		entry([]byte{0x81, 0x81, 0xc7, 0x82, 0x03, 0xff}, 0, 0, &manufacturer),
+		entry([]byte{0x01, 0x00, 0x00, 0x00, 0x09, 0xff}, 0, 0, &serverId),
+		{
+			ObjName: []byte{0x01, 0x00, 0x01, 0x08, 0x00, 0xff},
+			Status:  &status,
+			Unit:    30,
+			Scaler:  -1,
+			Value:   &energyIn,
+		},
+		entry([]byte{0x01, 0x00, 0x02, 0x08, 0x00, 0xff}, 30, -1, &energyOut),
+		entry([]byte{0x01, 0x00, 0x01, 0x08, 0x01, 0xff}, 30, -1, &tariff1),
+		entry([]byte{0x01, 0x00, 0x01, 0x08, 0x02, 0xff}, 30, -1, &tariff2),
+		entry([]byte{0x01, 0x00, 0x10, 0x07, 0x00, 0xff}, 27, 0, &power),
+	}
+
+	return &File{
+		Messages: []*Message{
+			{
+				TransactionId: []byte{0x00, 0x5a, 0x8e, 0x01},
+				MessageBody: &PublicOpenResMessageBody{
+					ReqFileId: []byte{0x00, 0x5a, 0x8e, 0x02},
+					ServerId:  serverId,
+				},
+			},
+			{
+				TransactionId: []byte{0x00, 0x5a, 0x8e, 0x03},
+				MessageBody: &GetListResMessageBody{
+					ServerId:      serverId,
+					ListName:      []byte{0x01, 0x00, 0x62, 0x0a, 0xff, 0xff},
+					ActSensorTime: &Time{SecIndex: &secIndex},
+					ValList:       valList,
+				},
+			},
+			{
+				TransactionId: []byte{0x00, 0x5a, 0x8e, 0x04},
+				MessageBody:   &PublicCloseResMessageBody{},
+			},
+		},
+	}
+}
+
+func benchmarkFrame(tb testing.TB) []byte {
+	buf := &bytes.Buffer{}
+
+	if err := NewWriter(buf).WriteFile(benchmarkFile()); err != nil {
+		tb.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+// repeatingReader returns the same frame over and over again, in chunks like a serial-to-TCP bridge would.
+type repeatingReader struct {
+	frame  []byte
+	offset int
+}
+
+func (r *repeatingReader) Read(p []byte) (int, error) {
+	if len(p) > 64 {
+		p = p[:64]
+	}
+
+	n := 0
+
+	for n < len(p) {
+		c := copy(p[n:], r.frame[r.offset:])
+		n += c
+		r.offset = (r.offset + c) % len(r.frame)
+	}
+
+	return n, nil
+}
+
+func BenchmarkReadMessageBundle(b *testing.B) {
+	frame := benchmarkFrame(b)
+	reader := newSmlBinaryReader(&repeatingReader{frame: frame}, ReaderOptions{MaxAllocation: DefaultMaxAllocation, MaxDepth: DefaultMaxDepth, MaxFrameSize: DefaultMaxFrameSize})
+
+	b.SetBytes(int64(len(frame)))
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := reader.readMessageBundle(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkReadFile(b *testing.B) {
+	frame := benchmarkFrame(b)
+	reader := NewReader(&repeatingReader{frame: frame})
+
+	b.SetBytes(int64(len(frame)))
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := reader.ReadFile(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkReadFileContext(b *testing.B) {
+	frame := benchmarkFrame(b)
+	reader := NewReader(&repeatingReader{frame: frame})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	b.SetBytes(int64(len(frame)))
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := reader.ReadFileContext(ctx); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// fuzzReaderOptions are the options the fuzz targets read with: strict, and with every check relaxed so mutated
+// frames reach the decoder despite their checksums.
+var fuzzReaderOptions = []ReaderOptions{
+	{},
+	{
+		SkipFrameCrc:          true,
+		AcceptSwappedCrc:      true,
+		AcceptPaddingMismatch: true,
+		SkipMessageCrc:        true,
+		CoerceNumericWidths:   true,
+	},
+}
+
+// FuzzReadMessageBundle reads arbitrary streams. Invalid frames must be discarded without panicking, so the
+// reader only stops at the end of the stream. The corpus in testdata/fuzz contains the seeds.
+func FuzzReadMessageBundle(f *testing.F) {
+	f.Add(benchmarkFrame(f))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		for _, options := range fuzzReaderOptions {
+			options.MaxAllocation = DefaultMaxAllocation
+			options.MaxDepth = DefaultMaxDepth
+			options.MaxFrameSize = DefaultMaxFrameSize
+
+			reader := newSmlBinaryReader(bytes.NewReader(data), options)
+
+			for {
+				_, err := reader.readMessageBundle()
+
+				if err == io.EOF {
+					break
+				}
+
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			}
+		}
+	})
+}
+
+// TestReadListAnnouncedCount reads a frame of deeply nested lists, each announcing 0xFFFF elements. The memory
+// used must depend on the size of the frame, not on the announced element counts.
+func TestReadListAnnouncedCount(t *testing.T) {
+	frame := fuzzFrame(bytes.Repeat([]byte{0xff, 0x8f, 0x8f, 0x0f}, DefaultMaxDepth-1))
+	reader := newSmlBinaryReader(bytes.NewReader(frame), ReaderOptions{MaxAllocation: DefaultMaxAllocation, MaxDepth: DefaultMaxDepth, MaxFrameSize: DefaultMaxFrameSize})
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+
+	for {
+		_, err := reader.readMessageBundle()
+
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	runtime.ReadMemStats(&after)
+
+	if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 1<<20 {
+		t.Errorf("reading a frame of %d bytes allocated %d bytes", len(frame), allocated)
+	}
+}
+
+func TestReadMessageCrc(t *testing.T) {
+	openMessage := "05 00b1c2d1 6200 6200 72 630101 76 01 01 05 00b1c2d2 0b 0a01454d4800007f9e31 01 01"
+	closeMessage := "05 00b1c2d4 6200 6200 72 630201 71 01"
+
+	corrupt := func(message []byte) []byte {
+		// The CRC is followed by the end of message
+		message[len(message)-2] ^= 0xff
+		return message
+	}
+
+	tests := []struct {
+		name           string
+		messages       [][]byte
+		skipMessageCrc bool
+		wantErr        error
+		wantRelaxation bool
+	}{
+		{
+			name:     "valid",
+			messages: [][]byte{capturedMessage(t, openMessage), capturedMessage(t, closeMessage)},
+		},
+		{
+			name:     "first message corrupt",
+			messages: [][]byte{corrupt(capturedMessage(t, openMessage)), capturedMessage(t, closeMessage)},
+			wantErr:  ErrCrcMismatch,
+		},
+		{
+			name:     "last message corrupt",
+			messages: [][]byte{capturedMessage(t, openMessage), corrupt(capturedMessage(t, closeMessage))},
+			wantErr:  ErrCrcMismatch,
+		},
+		{
+			name:           "corrupt but skipped",
+			messages:       [][]byte{capturedMessage(t, openMessage), corrupt(capturedMessage(t, closeMessage))},
+			skipMessageCrc: true,
+			wantRelaxation: true,
+		},
+		{
+			name:     "message without crc",
+			messages: [][]byte{capturedMessage(t, openMessage), {0x75, 0x01, 0x62, 0x00, 0x62, 0x00, 0x01, 0x01}, capturedMessage(t, closeMessage)},
+			wantErr:  ErrStructSizeMismatch,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var discarded []DiscardedFrame
+
+			reader := NewReaderWithOptions(bytes.NewReader(fuzzFrame(bytes.Join(tt.messages, nil))), ReaderOptions{
+				SkipMessageCrc: tt.skipMessageCrc,
+				OnDiscardedFrame: func(frame DiscardedFrame) {
+					discarded = append(discarded, frame)
+				},
+			})
+
+			file, err := reader.ReadFile()
+
+			if tt.wantErr != nil {
+				if err != io.EOF {
+					t.Fatalf("ReadFile() = %v, want io.EOF", err)
+				}
+
+				if len(discarded) != 1 || !errors.Is(discarded[0].Reason, tt.wantErr) {
+					t.Fatalf("discarded %v, want a frame discarded with %v", discarded, tt.wantErr)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := len(file.Relaxations) == 1 && file.Relaxations[0].Kind == RelaxationMessageCrc; got != tt.wantRelaxation {
+				t.Errorf("Relaxations = %v, want message crc relaxation %t", file.Relaxations, tt.wantRelaxation)
+			}
+		})
+	}
+}
+
+func TestReadNumber(t *testing.T) {
+	tests := []struct {
+		encoded string
+		want    smlToken
+	}{
+		{"5280", &smlSigned8{-128}},
+		{"527f", &smlSigned8{127}},
+		{"53ff38", &smlSigned16{-200}},
+		// Integers of 3, 5, 6 and 7 bytes are sign-extended into the next larger type
+		{"54800000", &smlSigned32{-8388608}},
+		{"54ffffff", &smlSigned32{-1}},
+		{"547fffff", &smlSigned32{8388607}},
+		{"54000001", &smlSigned32{1}},
+		{"558000000000", &smlSigned32{-2147483648}},
+		{"568000000000", &smlSigned64{-549755813888}},
+		{"56ffffffff85", &smlSigned64{-123}},
+		{"567fffffffff", &smlSigned64{549755813887}},
+		{"560000001234", &smlSigned64{0x1234}},
+		{"57800000000000", &smlSigned64{-140737488355328}},
+		{"57fffffffffffe", &smlSigned64{-2}},
+		{"577fffffffffff", &smlSigned64{140737488355327}},
+		{"5880000000000000", &smlSigned64{-36028797018963968}},
+		{"58ffffffffffffff", &smlSigned64{-1}},
+		{"587fffffffffffff", &smlSigned64{36028797018963967}},
+		{"59ffffffffffffffff", &smlSigned64{-1}},
+		{"598000000000000000", &smlSigned64{-9223372036854775808}},
+		// Unsigned integers are never sign-extended
+		{"64ffffff", &smlUnsigned32{0xffffff}},
+		{"66ffffffffff", &smlUnsigned64{0xffffffffff}},
+		{"67ffffffffffff", &smlUnsigned64{0xffffffffffff}},
+		{"68ffffffffffffff", &smlUnsigned64{0xffffffffffffff}},
+		{"69ffffffffffffffff", &smlUnsigned64{0xffffffffffffffff}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.encoded, func(t *testing.T) {
+			data, err := hex.DecodeString(tt.encoded)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			r := newSmlBinaryReader(bytes.NewReader(data), ReaderOptions{MaxAllocation: DefaultMaxAllocation, MaxDepth: DefaultMaxDepth, MaxFrameSize: DefaultMaxFrameSize})
+			got, err := r.readToken()
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("readToken() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,12 +1,29 @@
 package sml
 
+import "time"
+
 type unparsedMessageBundle struct {
 	messages []*smlList
+	// The unescaped bytes of the messages, which the spans of the lists refer to
+	payload []byte
+	// The positions of the messages in the stream
+	offsets     []uint64
+	relaxations []Relaxation
+	// The escaped bytes of the frame including the begin and end of message markers.
+	// The bundle and its tokens are reused by the reader, so they are only valid until the next frame is read.
+	raw []byte
+	// The metadata of the frame, see Frame
+	offset     uint64
+	skipped    uint64
+	crc        uint16
+	padding    int
+	receivedAt time.Time
 }
 
 type binaryTypeLengthField struct {
-	dataType   uint8
-	dataLength int
+	dataType     uint8
+	dataLength   int
+	headerLength int
 }
 
 type smlToken interface {
@@ -54,7 +71,77 @@ type smlSigned64 struct {
 
 type smlList struct {
 	value []smlToken
+	// The span of the list in the payload of the bundle it has been read from
+	start, end int
+	// The encoding of a list, which is written instead of its elements, if set
+	raw []byte
 }
 
 type smlEndOfMessage struct {
 }
+
+// tokenAllocator hands out the tokens of a frame from slices, which are reused for the next frame.
+// Tokens are thus only valid until the next frame is read, everything kept by the decoder is copied.
+type tokenAllocator struct {
+	octetStrings []smlOctetString
+	booleans     []smlBoolean
+	unsigned8    []smlUnsigned8
+	unsigned16   []smlUnsigned16
+	unsigned32   []smlUnsigned32
+	unsigned64   []smlUnsigned64
+	signed8      []smlSigned8
+	signed16     []smlSigned16
+	signed32     []smlSigned32
+	signed64     []smlSigned64
+	lists        []smlList
+	elements     []smlToken
+}
+
+// endOfMessageToken is shared, as end of message tokens do not carry any data.
+var endOfMessageToken = &smlEndOfMessage{}
+
+func (a *tokenAllocator) reset() {
+	a.octetStrings = a.octetStrings[:0]
+	a.booleans = a.booleans[:0]
+	a.unsigned8 = a.unsigned8[:0]
+	a.unsigned16 = a.unsigned16[:0]
+	a.unsigned32 = a.unsigned32[:0]
+	a.unsigned64 = a.unsigned64[:0]
+	a.signed8 = a.signed8[:0]
+	a.signed16 = a.signed16[:0]
+	a.signed32 = a.signed32[:0]
+	a.signed64 = a.signed64[:0]
+	a.lists = a.lists[:0]
+	a.elements = a.elements[:0]
+}
+
+// allocateToken appends a zero token to the slice and returns a pointer to it.
+// Growing the slice leaves the previously returned tokens in the old array, so they stay valid.
+func allocateToken[T any](tokens *[]T) *T {
+	var zero T
+	*tokens = append(*tokens, zero)
+
+	return &(*tokens)[len(*tokens)-1]
+}
+
+// listElements returns a slice for the n elements of a list.
+func (a *tokenAllocator) listElements(n int) []smlToken {
+	if cap(a.elements)-len(a.elements) < n {
+		size := 2 * cap(a.elements)
+
+		if size < 64 {
+			size = 64
+		}
+
+		if size < n {
+			size = n
+		}
+
+		a.elements = make([]smlToken, 0, size)
+	}
+
+	start := len(a.elements)
+	a.elements = a.elements[:start+n]
+
+	return a.elements[start : start+n : start+n]
+}
@@ -0,0 +1,198 @@
+package sml
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/sigurn/crc16"
+)
+
+type smlBinaryWriter struct {
+	writer   io.Writer
+	crcTable *crc16.Table
+}
+
+func newSmlBinaryWriter(w io.Writer) *smlBinaryWriter {
+	return &smlBinaryWriter{
+		writer:   w,
+		crcTable: crc16.MakeTable(crc16.CRC16_X_25),
+	}
+}
+
+func (w *smlBinaryWriter) writeMessageBundle(bundle *unparsedMessageBundle) error {
+	payload := &bytes.Buffer{}
+
+	for _, m := range bundle.messages {
+		err := w.encodeMessage(payload, m)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	// The payload is padded with zero-bytes to a multiple of 4 bytes.
+	// Escaping does not change the alignment, as it always adds 4 bytes.
+	countPaddingBytes := (4 - payload.Len()%4) % 4
+
+	for i := 0; i < countPaddingBytes; i++ {
+		payload.WriteByte(0x00)
+	}
+
+	frame := &bytes.Buffer{}
+	frame.Write([]byte{0x1b, 0x1b, 0x1b, 0x1b, 0x01, 0x01, 0x01, 0x01})
+	w.escape(frame, payload.Bytes())
+	frame.Write([]byte{0x1b, 0x1b, 0x1b, 0x1b, 0x1a, byte(countPaddingBytes)})
+
+	checksum := w.checksum(frame.Bytes())
+	frame.WriteByte(byte(checksum >> 8))
+	frame.WriteByte(byte(checksum))
+
+	_, err := w.writer.Write(frame.Bytes())
+	return err
+}
+
+// checksum calculates the CRC16 in the byte order used by SML.
+func (w *smlBinaryWriter) checksum(data []byte) uint16 {
+	return swapBytes(crc16.Checksum(data, w.crcTable))
+}
+
+func (w *smlBinaryWriter) escape(buf *bytes.Buffer, data []byte) {
+	for i := 0; i < len(data); {
+		if i+4 <= len(data) && bytes.Equal(data[i:i+4], []byte{0x1b, 0x1b, 0x1b, 0x1b}) {
+			buf.Write([]byte{0x1b, 0x1b, 0x1b, 0x1b, 0x1b, 0x1b, 0x1b, 0x1b})
+			i += 4
+			continue
+		}
+
+		buf.WriteByte(data[i])
+		i++
+	}
+}
+
+func (w *smlBinaryWriter) encodeMessage(buf *bytes.Buffer, message *smlList) error {
+	if message.raw != nil {
+		buf.Write(message.raw)
+		return nil
+	}
+
+	if len(message.value) != 6 {
+		return fmt.Errorf("SML message must consist of 6 elements, got %d", len(message.value))
+	}
+
+	start := buf.Len()
+	w.encodeTypeLength(buf, 0x7, len(message.value), false)
+
+	// The CRC covers everything up to, but excluding, the CRC field itself
+	for _, tok := range message.value[0:4] {
+		err := w.encodeToken(buf, tok)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	err := w.encodeToken(buf, &smlUnsigned16{
+		value: w.checksum(buf.Bytes()[start:]),
+	})
+
+	if err != nil {
+		return err
+	}
+
+	return w.encodeToken(buf, &smlEndOfMessage{})
+}
+
+func (w *smlBinaryWriter) encodeTypeLength(buf *bytes.Buffer, dataType uint8, length int, lengthIncludesHeader bool) {
+	headerLength := 1
+
+	for {
+		total := length
+
+		if lengthIncludesHeader {
+			total += headerLength
+		}
+
+		if total < 1<<(4*headerLength) {
+			length = total
+			break
+		}
+
+		headerLength++
+	}
+
+	for i := headerLength - 1; i >= 0; i-- {
+		b := byte(length>>(4*i)) & 0x0F
+
+		if i == headerLength-1 {
+			b |= dataType << 4
+		}
+
+		if i != 0 {
+			b |= 0x80
+		}
+
+		buf.WriteByte(b)
+	}
+}
+
+func (w *smlBinaryWriter) encodeToken(buf *bytes.Buffer, token smlToken) error {
+	switch t := token.(type) {
+	case *smlEndOfMessage:
+		buf.WriteByte(0x00)
+	case *smlOctetString:
+		w.encodeTypeLength(buf, 0x0, len(t.value), true)
+		buf.Write(t.value)
+	case *smlBoolean:
+		w.encodeTypeLength(buf, 0x4, 1, true)
+
+		if t.value {
+			buf.WriteByte(0x01)
+		} else {
+			buf.WriteByte(0x00)
+		}
+	case *smlSigned8:
+		w.encodeNumber(buf, 0x5, uint64(t.value), 1)
+	case *smlSigned16:
+		w.encodeNumber(buf, 0x5, uint64(t.value), 2)
+	case *smlSigned32:
+		w.encodeNumber(buf, 0x5, uint64(t.value), 4)
+	case *smlSigned64:
+		w.encodeNumber(buf, 0x5, uint64(t.value), 8)
+	case *smlUnsigned8:
+		w.encodeNumber(buf, 0x6, uint64(t.value), 1)
+	case *smlUnsigned16:
+		w.encodeNumber(buf, 0x6, uint64(t.value), 2)
+	case *smlUnsigned32:
+		w.encodeNumber(buf, 0x6, uint64(t.value), 4)
+	case *smlUnsigned64:
+		w.encodeNumber(buf, 0x6, t.value, 8)
+	case *smlList:
+		if t.raw != nil {
+			buf.Write(t.raw)
+			break
+		}
+
+		w.encodeTypeLength(buf, 0x7, len(t.value), false)
+
+		for _, element := range t.value {
+			err := w.encodeToken(buf, element)
+
+			if err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("unsupported SML token %T", token)
+	}
+
+	return nil
+}
+
+func (w *smlBinaryWriter) encodeNumber(buf *bytes.Buffer, dataType uint8, value uint64, byteCount int) {
+	w.encodeTypeLength(buf, dataType, byteCount, true)
+
+	for i := byteCount - 1; i >= 0; i-- {
+		buf.WriteByte(byte(value >> (8 * i)))
+	}
+}
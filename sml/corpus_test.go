@@ -0,0 +1,303 @@
+package sml
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+var updateCorpus = flag.Bool("update-corpus", false, "write the generated seeds to testdata/fuzz")
+
+// capturePrefix starts the names of the seeds recorded from meters, which are added by cmd/anonymize-capture.
+const capturePrefix = "capture_"
+
+// corpusFile returns a file consisting of the bodies between a SML_PublicOpen.Res and a SML_PublicClose.Res message.
+func corpusFile(bodies ...MessageBody) *File {
+	f := &File{}
+	f.Messages = append(f.Messages, &Message{TransactionId: []byte{1}, MessageBody: &PublicOpenResMessageBody{ReqFileId: []byte{1}, ServerId: []byte{2}}})
+
+	for _, b := range bodies {
+		f.Messages = append(f.Messages, &Message{TransactionId: []byte{2}, MessageBody: b})
+	}
+
+	f.Messages = append(f.Messages, &Message{TransactionId: []byte{3}, MessageBody: &PublicCloseResMessageBody{}})
+	return f
+}
+
+// corpusFiles returns the files the seeds of both fuzz targets are generated from. They resemble the files of real
+// meters and add the messages and encodings not covered by the captures.
+func corpusFiles() map[string]*File {
+	serverId := []byte{0x0a, 0x01, 'E', 'M', 'H', 0x00, 0x00, 0x7a, 0x5e, 0x9c}
+	energy := uint64(123456789)
+	power := int16(-3210)
+	entryStatus := uint32(0x1c0104)
+
+	periodStatus := uint64(5)
+	listStatus := uint8(1)
+	value := int32(-7)
+	secIndex := uint32(1234)
+	timestamp := uint32(1700000000)
+	localTime := &Time{LocalTimestamp: &LocalTimestamp{Timestamp: 1700000000, LocalOffset: 60, SeasonTimeOffset: 60}}
+
+	parameter := uint32(42)
+	tupelStatus := uint8(2)
+	withRawdata := true
+
+	return map[string]*File{
+		// The list signature consists of escape bytes
+		"ehz_status_signature": {Messages: []*Message{
+			{TransactionId: []byte{1, 2, 3}, MessageBody: &PublicOpenResMessageBody{ReqFileId: []byte{9, 9}, ServerId: serverId}},
+			{TransactionId: []byte{1, 2, 4}, GroupNo: 1, MessageBody: &GetListResMessageBody{
+				ServerId:      serverId,
+				ListName:      []byte{1, 0, 98, 10, 255, 255},
+				ListSignature: bytes.Repeat([]byte{0x1b}, 48),
+				ValList: []*ListEntry{
+					{ObjName: []byte{1, 0, 1, 8, 0, 255}, Status: &entryStatus, Unit: UnitWattHour, Scaler: -1, Value: &energy},
+					{ObjName: []byte{1, 0, 16, 7, 0, 255}, Unit: UnitWatt, Value: &power},
+					{ObjName: []byte{1, 0, 96, 50, 1, 1}, Value: []byte("EMH")},
+				},
+			}},
+			{TransactionId: []byte{1, 2, 5}, MessageBody: &PublicCloseResMessageBody{}},
+		}},
+		"dtz_values": benchmarkFile(),
+		"profile": corpusFile(
+			&GetProfilePackResMessageBody{
+				ServerId:          []byte{1},
+				ActTime:           localTime,
+				RegPeriod:         900,
+				ParameterTreePath: [][]byte{{1, 0, 99, 1, 0, 255}},
+				HeaderList:        []*ProfObjHeaderEntry{{ObjName: []byte{1, 0, 1, 8, 0, 255}, Unit: UnitWattHour, Scaler: -1}},
+				PeriodList:        []*ProfObjPeriodEntry{{ValTime: &Time{SecIndex: &secIndex}, Status: &periodStatus, ValueList: []*ValueEntry{{Value: &value}}}},
+			},
+			&GetProfileListResMessageBody{
+				ServerId:          []byte{1},
+				ActTime:           &Time{Timestamp: &timestamp},
+				RegPeriod:         900,
+				ParameterTreePath: [][]byte{{1, 0, 99, 1, 0, 255}, {1}},
+				ValTime:           localTime,
+				Status:            &listStatus,
+				PeriodList:        []*PeriodEntry{{ObjName: []byte{1, 0, 1, 8, 0, 255}, Unit: UnitWattHour, Scaler: -1, Value: &value}},
+			},
+		),
+		"proc_parameter": corpusFile(&GetProcParameterResMessageBody{
+			ServerId:          []byte{1},
+			ParameterTreePath: [][]byte{{1, 2}},
+			ParameterTree: &Tree{ParameterName: []byte{1, 2}, ChildList: []*Tree{
+				{ParameterName: []byte{1, 0, 0, 0, 9, 255}, ParameterValue: &ProcParValue{Value: &parameter}},
+				{ParameterName: []byte{3}, ParameterValue: &ProcParValue{Time: localTime}, ChildList: []*Tree{{ParameterName: []byte{4}}}},
+				{ParameterName: []byte{5}, ParameterValue: &ProcParValue{TupelEntry: &TupelEntry{
+					ServerId: []byte{1},
+					SecIndex: &Time{SecIndex: &secIndex},
+					Status:   &tupelStatus,
+					UnitPA:   UnitWattHour,
+					ValuePA:  5,
+				}}},
+			}},
+		}),
+		"attention": corpusFile(&AttentionResMessageBody{
+			ServerId:     []byte{1},
+			AttentionNo:  []byte{0x81, 0x81, 0xc7, 0xc7, 0xfe, 0x02},
+			AttentionMsg: []byte("pin"),
+		}),
+		"requests": {Messages: []*Message{
+			{TransactionId: []byte{1}, MessageBody: &PublicOpenReqMessageBody{ClientId: []byte{1}, ReqFileId: []byte{2}, Username: []byte("u"), Password: []byte("p")}},
+			{TransactionId: []byte{2}, MessageBody: &GetListReqMessageBody{ClientId: []byte{1}}},
+			{TransactionId: []byte{3}, MessageBody: &GetProfilePackReqMessageBody{WithRawdata: withRawdata, ParameterTreePath: [][]byte{{1}}}},
+			{TransactionId: []byte{4}, MessageBody: &GetProcParameterReqMessageBody{ParameterTreePath: [][]byte{{1}}}},
+			{TransactionId: []byte{5}, MessageBody: &SetProcParameterReqMessageBody{ParameterTreePath: [][]byte{{1}}, ParameterTree: &Tree{ParameterName: []byte{1}}}},
+			{TransactionId: []byte{6}, MessageBody: &PublicCloseReqMessageBody{}},
+		}},
+		"unknown_body": corpusFile(&UnknownMessageBody{Tag: 0xf01, Tree: &ListNode{Elements: []Node{
+			&OctetStringNode{Value: []byte("abc")},
+			&BoolNode{Value: true},
+			&ListNode{},
+		}}}),
+	}
+}
+
+// corpusSeeds generates the seeds of the fuzz targets by their name. The seeds of FuzzReadMessageBundle are
+// complete streams, those of FuzzDeserializeMessageBundle the unescaped messages of a file.
+func corpusSeeds(tb testing.TB) map[string]map[string][]byte {
+	seeds := map[string]map[string][]byte{
+		"FuzzReadMessageBundle":        {},
+		"FuzzDeserializeMessageBundle": {},
+	}
+
+	frames := map[string][]byte{}
+
+	for name, f := range corpusFiles() {
+		buf := &bytes.Buffer{}
+
+		if err := NewWriter(buf).WriteFile(f); err != nil {
+			tb.Fatalf("%s: %v", name, err)
+		}
+
+		frames[name] = buf.Bytes()
+		seeds["FuzzReadMessageBundle"][name] = buf.Bytes()
+		seeds["FuzzDeserializeMessageBundle"][name] = fuzzPayload(tb, f)
+	}
+
+	seeds["FuzzReadMessageBundle"]["signed"] = signedFrame(tb)
+
+	ehz := frames["ehz_status_signature"]
+
+	stream := append([]byte{0x00, 0x1b, 0x42, 0x1b, 0x1b}, ehz...)
+	seeds["FuzzReadMessageBundle"]["garbage_and_two_frames"] = append(stream, frames["dtz_values"]...)
+
+	interrupted := append([]byte(nil), ehz[:len(ehz)/2]...)
+	seeds["FuzzReadMessageBundle"]["interrupted_frame"] = append(interrupted, frames["attention"]...)
+
+	crcMismatch := append([]byte(nil), frames["dtz_values"]...)
+	crcMismatch[len(crcMismatch)-1] ^= 0xff
+	seeds["FuzzReadMessageBundle"]["frame_crc_mismatch"] = crcMismatch
+
+	return seeds
+}
+
+// TestFuzzCorpus verifies that the corpus in testdata/fuzz has been generated from the current tree.
+// Run it with -update-corpus to write the seeds again, e.g. after changing the encoding of the writer.
+func TestFuzzCorpus(t *testing.T) {
+	for target, seeds := range corpusSeeds(t) {
+		dir := filepath.Join("testdata", "fuzz", target)
+
+		if *updateCorpus {
+			if err := os.MkdirAll(dir, 0o755); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		names := make([]string, 0, len(seeds))
+
+		for name := range seeds {
+			names = append(names, name)
+		}
+
+		sort.Strings(names)
+
+		for _, name := range names {
+			path := filepath.Join(dir, name)
+			want := fmt.Sprintf("go test fuzz v1\n[]byte(%q)\n", seeds[name])
+
+			if *updateCorpus {
+				if err := os.WriteFile(path, []byte(want), 0o644); err != nil {
+					t.Fatal(err)
+				}
+
+				continue
+			}
+
+			got, err := os.ReadFile(path)
+
+			if err != nil {
+				t.Errorf("%v, run the test with -update-corpus", err)
+				continue
+			}
+
+			if string(got) != want {
+				t.Errorf("%s does not match the generated seed, run the test with -update-corpus", path)
+			}
+		}
+
+		entries, err := os.ReadDir(dir)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, entry := range entries {
+			if strings.HasPrefix(entry.Name(), capturePrefix) {
+				continue
+			}
+
+			if _, ok := seeds[entry.Name()]; !ok {
+				t.Errorf("%s is not generated by corpusSeeds", filepath.Join(dir, entry.Name()))
+			}
+		}
+	}
+}
+
+// readSeed returns the input of a seed written in the corpus format of go test.
+func readSeed(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+
+	if len(lines) != 2 || lines[0] != "go test fuzz v1" || !strings.HasPrefix(lines[1], "[]byte(") || !strings.HasSuffix(lines[1], ")") {
+		return nil, fmt.Errorf("%s is not a seed consisting of a single []byte", path)
+	}
+
+	seed, err := strconv.Unquote(strings.TrimSuffix(strings.TrimPrefix(lines[1], "[]byte("), ")"))
+
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return []byte(seed), nil
+}
+
+// TestFuzzCaptures verifies that every frame recorded from a meter is read without being discarded and written
+// again as it has been received.
+func TestFuzzCaptures(t *testing.T) {
+	paths, err := filepath.Glob(filepath.Join("testdata", "fuzz", "FuzzReadMessageBundle", capturePrefix+"*"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(paths) == 0 {
+		t.Skip("no captures in testdata/fuzz, add them with cmd/anonymize-capture")
+	}
+
+	for _, path := range paths {
+		t.Run(filepath.Base(path), func(t *testing.T) {
+			stream, err := readSeed(path)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			reader := NewReaderWithOptions(bytes.NewReader(stream), ReaderOptions{
+				OnDiscardedFrame: func(frame DiscardedFrame) {
+					t.Errorf("discarded frame: %v", frame.Reason)
+				},
+			})
+
+			for {
+				file, err := reader.ReadFile()
+
+				if err == io.EOF {
+					break
+				}
+
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				buf := &bytes.Buffer{}
+
+				if err := NewWriter(buf).WriteFile(file); err != nil {
+					t.Fatal(err)
+				}
+
+				if !bytes.Equal(buf.Bytes(), file.Frame.Raw) {
+					t.Errorf("WriteFile() = %x, want the frame at offset %d %x", buf.Bytes(), file.Frame.Offset, file.Frame.Raw)
+				}
+			}
+
+			if reader.Statistics().FramesOk == 0 {
+				t.Error("capture does not contain any frames")
+			}
+		})
+	}
+}
@@ -1,19 +1,144 @@
 package sml
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
 
+// The kinds of invalid messages, which can be checked for with errors.Is.
+var (
+	// ErrCrcMismatch is the kind of frames or messages whose checksum does not match
+	ErrCrcMismatch = errors.New("crc mismatch")
+	// ErrEscape is the kind of frames containing an invalid escape sequence
+	ErrEscape = errors.New("escape error")
+	// ErrPadding is the kind of frames whose padding does not match the end of message marker
+	ErrPadding = errors.New("padding error")
+	// ErrIncompleteFrame is the kind of frames interrupted by the begin or end of message marker
+	ErrIncompleteFrame = errors.New("incomplete frame")
+	// ErrInvalidToken is the kind of type-length-fields and values which cannot be read
+	ErrInvalidToken = errors.New("invalid token")
+	// ErrLimitExceeded is the kind of frames exceeding ReaderOptions.MaxFrameSize or ReaderOptions.MaxDepth
+	ErrLimitExceeded = errors.New("limit exceeded")
+	// ErrTypeMismatch is the kind of values whose type does not match the one required
+	ErrTypeMismatch = errors.New("type mismatch")
+	// ErrStructSizeMismatch is the kind of lists with a different number of elements than the struct decoded into
+	ErrStructSizeMismatch = errors.New("struct size mismatch")
+	// ErrUnsupportedMessage is the kind of messages and choices with an alternative that cannot be decoded
+	ErrUnsupportedMessage = errors.New("unsupported message")
+	// ErrFileStructure is the kind of files not consisting of the required messages
+	ErrFileStructure = errors.New("invalid file structure")
+)
+
+// ErrReaderClosed is returned by a Reader which has been closed.
+var ErrReaderClosed = errors.New("reader closed")
+
+// InvalidMessage is returned when a message cannot be read or decoded.
 type InvalidMessage struct {
+	// Kind is one of the kinds like ErrCrcMismatch
+	Kind error
+	// Offset is the position in the stream at which the error was detected. Errors found while decoding a message
+	// refer to the beginning of the message.
+	Offset uint64
+	// Path is the field the error was found in, e.g. MessageBody.ValList[2].Value
+	Path string
+
 	error error
+	// hasOffset reports whether Offset has been set, as the offset of an error at the start of the stream is 0
+	hasOffset bool
+}
+
+func newInvalidMessage(kind error, format string, a ...interface{}) *InvalidMessage {
+	return &InvalidMessage{
+		Kind:  kind,
+		error: fmt.Errorf(format, a...),
+	}
+}
+
+func (i *InvalidMessage) Error() string {
+	s := "invalid message"
+
+	if i.hasOffset || i.Offset != 0 {
+		s += fmt.Sprintf(" at offset %d", i.Offset)
+	}
+
+	if i.Path != "" {
+		s += " in " + i.Path
+	}
+
+	return fmt.Sprintf("%s: %v: %v", s, i.Kind, i.error)
+}
+
+func (i *InvalidMessage) Unwrap() error {
+	return i.error
+}
+
+// Is reports whether the message is of the kind.
+func (i *InvalidMessage) Is(target error) bool {
+	return target == i.Kind
+}
+
+// setOffset sets the position in the stream the error refers to.
+func (i *InvalidMessage) setOffset(offset uint64) {
+	i.Offset = offset
+	i.hasOffset = true
+}
+
+// prependPath adds the field or slice index containing the current path.
+func (i *InvalidMessage) prependPath(segment string) {
+	switch {
+	case i.Path == "":
+		i.Path = segment
+	case strings.HasPrefix(i.Path, "["):
+		i.Path = segment + i.Path
+	default:
+		i.Path = segment + "." + i.Path
+	}
 }
 
-func (i InvalidMessage) Error() string {
-	return fmt.Sprintf("invalid message: %v", i.error)
+// prependPath adds the segment to the path of an invalid message.
+func prependPath(err error, segment string) error {
+	var invalid *InvalidMessage
+
+	if errors.As(err, &invalid) {
+		invalid.prependPath(segment)
+	}
+
+	return err
 }
 
+// InvalidFile is returned when the messages of a file cannot be decoded or do not form a valid file.
+// It unwraps to the *InvalidMessage, if a single message is invalid.
 type InvalidFile struct {
 	error error
 }
 
-func (i InvalidFile) Error() string {
+func (i *InvalidFile) Error() string {
 	return fmt.Sprintf("invalid SML file: %v", i.error)
 }
+
+func (i *InvalidFile) Unwrap() error {
+	return i.error
+}
+
+// ReadCancelled is returned by Reader.ReadFileContext, when the context is done before a file was read.
+// It unwraps to the error of the context.
+type ReadCancelled struct {
+	// MidFrame reports whether the reader was inside a frame. The partially read frame is discarded and
+	// the next read continues with the following frame.
+	MidFrame bool
+
+	err error
+}
+
+func (r *ReadCancelled) Error() string {
+	if r.MidFrame {
+		return fmt.Sprintf("read cancelled mid-frame: %v", r.err)
+	}
+
+	return fmt.Sprintf("read cancelled: %v", r.err)
+}
+
+func (r *ReadCancelled) Unwrap() error {
+	return r.err
+}
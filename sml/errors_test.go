@@ -0,0 +1,188 @@
+package sml
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+)
+
+var errorKinds = []error{
+	ErrCrcMismatch,
+	ErrEscape,
+	ErrPadding,
+	ErrIncompleteFrame,
+	ErrInvalidToken,
+	ErrLimitExceeded,
+	ErrTypeMismatch,
+	ErrStructSizeMismatch,
+	ErrUnsupportedMessage,
+	ErrFileStructure,
+}
+
+func TestErrorKinds(t *testing.T) {
+	frames := relaxationFrames(t)
+	valid := frames["valid"]
+	closeMessage := "05 00b1c2d4 6200 6200 72 630201 71 01"
+
+	file := func(openMessage string) []byte {
+		return fuzzFrame(append(capturedMessage(t, openMessage), capturedMessage(t, closeMessage)...))
+	}
+
+	tests := []struct {
+		name    string
+		frame   []byte
+		options ReaderOptions
+		kind    error
+		// Errors of a frame are passed to OnDiscardedFrame, errors of its messages are also returned by ReadFile
+		wantFile   bool
+		wantOffset uint64
+		wantPath   string
+	}{
+		{name: "crc", frame: frames["frame crc"], kind: ErrCrcMismatch, wantOffset: 76},
+		{name: "padding", frame: frames["padding mismatch"], kind: ErrPadding, wantOffset: 76},
+		{
+			name:       "escape",
+			frame:      append(append(append([]byte(nil), valid[:8]...), 0x1b, 0x1b, 0x1b, 0x1b, 0x02, 0x02, 0x02, 0x02), valid[8:]...),
+			kind:       ErrEscape,
+			wantOffset: 16,
+		},
+		{
+			// The error refers to the begin of message marker of the following frame, which is read afterwards
+			name:       "incomplete frame",
+			frame:      append(append([]byte(nil), valid[:20]...), valid...),
+			kind:       ErrIncompleteFrame,
+			wantOffset: 20,
+		},
+		{
+			name:       "invalid token",
+			frame:      file("05 00b1c2d1 6200 6200 72 630101 76 01 01 05 00b1c2d2 43 0101 01 01"),
+			kind:       ErrInvalidToken,
+			wantOffset: 31,
+		},
+		{name: "depth", frame: valid, options: ReaderOptions{MaxDepth: 1}, kind: ErrLimitExceeded, wantOffset: 19},
+		{name: "frame size", frame: valid, options: ReaderOptions{MaxFrameSize: 16}, kind: ErrLimitExceeded, wantOffset: 17},
+		{
+			name:       "type mismatch",
+			frame:      file("05 00b1c2d1 6200 6200 72 630101 76 01 01 05 00b1c2d2 6201 01 01"),
+			kind:       ErrTypeMismatch,
+			wantFile:   true,
+			wantOffset: 8,
+			wantPath:   "Messages[0].MessageBody.ServerId",
+		},
+		{
+			name:       "struct size mismatch",
+			frame:      file("05 00b1c2d1 6200 6200 72 630101 75 01 01 05 00b1c2d2 0b 0a01454d4800007f9e31 01"),
+			kind:       ErrStructSizeMismatch,
+			wantFile:   true,
+			wantOffset: 8,
+			wantPath:   "Messages[0].MessageBody",
+		},
+		{
+			name:       "unsupported message",
+			frame:      file("05 00b1c2d1 6200 6200 72 630101 76 01 01 05 00b1c2d2 0b 0a01454d4800007f9e31 72 6209 6500000001 01"),
+			kind:       ErrUnsupportedMessage,
+			wantFile:   true,
+			wantOffset: 8,
+			wantPath:   "Messages[0].MessageBody.RefTime",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var discarded []error
+
+			options := tt.options
+			options.OnDiscardedFrame = func(frame DiscardedFrame) {
+				discarded = append(discarded, frame.Reason)
+			}
+
+			_, err := NewReaderWithOptions(bytes.NewReader(tt.frame), options).ReadFile()
+
+			if len(discarded) != 1 {
+				t.Fatalf("discarded %d frames, want 1", len(discarded))
+			}
+
+			if tt.wantFile {
+				var invalidFile *InvalidFile
+
+				if !errors.As(err, &invalidFile) {
+					t.Fatalf("ReadFile() = %v, want an *InvalidFile", err)
+				}
+			} else if err != nil && err != io.EOF {
+				t.Fatalf("ReadFile() = %v, want the frame to be discarded", err)
+			}
+
+			// The kind and the details are kept through further wrapping
+			for _, err := range []error{discarded[0], fmt.Errorf("reading meter: %w", discarded[0])} {
+				for _, kind := range errorKinds {
+					if got := errors.Is(err, kind); got != (kind == tt.kind) {
+						t.Errorf("errors.Is(%v, %v) = %t", err, kind, got)
+					}
+				}
+
+				var invalid *InvalidMessage
+
+				if !errors.As(err, &invalid) {
+					t.Fatalf("errors.As(%v) found no *InvalidMessage", err)
+				}
+
+				if invalid.Kind != tt.kind || invalid.Offset != tt.wantOffset || invalid.Path != tt.wantPath {
+					t.Errorf("InvalidMessage = %v at offset %d in %q, want %v at offset %d in %q",
+						invalid.Kind, invalid.Offset, invalid.Path, tt.kind, tt.wantOffset, tt.wantPath)
+				}
+			}
+		})
+	}
+}
+
+func TestErrorFileStructure(t *testing.T) {
+	frame := fuzzFrame(capturedMessage(t, "05 00b1c2d4 6200 6200 72 630201 71 01"))
+
+	_, err := NewReader(bytes.NewReader(frame)).ReadFile()
+
+	var invalidFile *InvalidFile
+	var invalid *InvalidMessage
+
+	if !errors.As(err, &invalidFile) || !errors.Is(err, ErrFileStructure) {
+		t.Fatalf("ReadFile() = %v, want an *InvalidFile of kind %v", err, ErrFileStructure)
+	}
+
+	// The file is invalid as a whole, there is no single message to refer to
+	if errors.As(err, &invalid) {
+		t.Errorf("errors.As() found %v, want no *InvalidMessage", invalid)
+	}
+}
+
+func TestInvalidMessageError(t *testing.T) {
+	atOffset := func(offset uint64) *InvalidMessage {
+		invalid := newInvalidMessage(ErrInvalidToken, "unsupported type")
+		invalid.setOffset(offset)
+		return invalid
+	}
+
+	withPath := atOffset(0)
+	withPath.prependPath("[2]")
+	withPath.prependPath("ValList")
+
+	tests := []struct {
+		name    string
+		invalid *InvalidMessage
+		want    string
+	}{
+		{"unknown offset", newInvalidMessage(ErrInvalidToken, "unsupported type"), "invalid message: invalid token: unsupported type"},
+		{"offset 0", atOffset(0), "invalid message at offset 0: invalid token: unsupported type"},
+		{"offset", atOffset(42), "invalid message at offset 42: invalid token: unsupported type"},
+		{"exported offset", &InvalidMessage{Kind: ErrPadding, Offset: 7, error: errors.New("1 byte")}, "invalid message at offset 7: padding error: 1 byte"},
+		{"path", withPath, "invalid message at offset 0 in ValList[2]: invalid token: unsupported type"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.invalid.Error(); got != tt.want {
+				t.Errorf("Error() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,306 @@
+package sml
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"time"
+	"unicode"
+)
+
+// Files and messages are marshaled into objects with lower camel case keys. Their message bodies are converted by
+// reflection, adding the name of the body as type. Octet strings are hex encoded, except OBIS codes which are
+// rendered like 1-0:1.8.0*255, and values are marshaled with their type.
+// The MarshalYAML methods implement the Marshaler interface of gopkg.in/yaml.v3 without depending on it.
+
+// obisFields are the octet strings and lists of octet strings containing OBIS codes.
+var obisFields = map[string]bool{
+	"ObjName":           true,
+	"ParameterName":     true,
+	"ListName":          true,
+	"ParameterTreePath": true,
+	"ObjectList":        true,
+}
+
+// redactedFields are the octet strings which are never marshaled, like the passwords sniffed from the bus.
+var redactedFields = map[string]bool{
+	"Password": true,
+}
+
+// marshalExtender adds derived information to the marshaled fields of a struct.
+type marshalExtender interface {
+	marshalExtra(fields map[string]interface{})
+}
+
+func (f *File) MarshalJSON() ([]byte, error) {
+	return json.Marshal(f.marshalValue())
+}
+
+func (f *File) MarshalYAML() (interface{}, error) {
+	return f.marshalValue(), nil
+}
+
+func (f *File) marshalValue() interface{} {
+	messages := make([]interface{}, len(f.Messages))
+
+	for i, m := range f.Messages {
+		messages[i] = m.marshalValue()
+	}
+
+	relaxations := make([]string, len(f.Relaxations))
+
+	for i, r := range f.Relaxations {
+		relaxations[i] = r.String()
+	}
+
+	v := map[string]interface{}{
+		"messages":    messages,
+		"relaxations": relaxations,
+	}
+
+	if f.Frame.Raw != nil {
+		v["frame"] = map[string]interface{}{
+			"raw":        hex.EncodeToString(f.Frame.Raw),
+			"offset":     f.Frame.Offset,
+			"skipped":    f.Frame.Skipped,
+			"crc":        fmt.Sprintf("%04x", f.Frame.Crc),
+			"padding":    f.Frame.Padding,
+			"receivedAt": f.Frame.ReceivedAt.Format(time.RFC3339Nano),
+		}
+	}
+
+	return v
+}
+
+func (m *Message) MarshalJSON() ([]byte, error) {
+	return json.Marshal(m.marshalValue())
+}
+
+func (m *Message) MarshalYAML() (interface{}, error) {
+	return m.marshalValue(), nil
+}
+
+func (m *Message) marshalValue() interface{} {
+	return map[string]interface{}{
+		"transactionId": hex.EncodeToString(m.TransactionId),
+		"groupNo":       m.GroupNo,
+		"abortOnError":  m.AbortOnError,
+		"messageBody":   marshalMessageBody(m.MessageBody),
+		"crc16":         fmt.Sprintf("%04x", m.Crc16),
+	}
+}
+
+// marshalMessageBody marshals the fields of a body together with its type.
+func marshalMessageBody(body MessageBody) interface{} {
+	if body == nil {
+		return nil
+	}
+
+	v, ok := marshalReflect(reflect.ValueOf(body), "").(map[string]interface{})
+
+	if !ok {
+		return nil
+	}
+
+	v["type"] = messageBodyName(body)
+	return v
+}
+
+func (v Value) MarshalJSON() ([]byte, error) {
+	return json.Marshal(v.marshalValue())
+}
+
+func (v Value) MarshalYAML() (interface{}, error) {
+	return v.marshalValue(), nil
+}
+
+func (v Value) marshalValue() interface{} {
+	m := map[string]interface{}{
+		"type": v.kind.String(),
+	}
+
+	switch {
+	case v.kind == ValueKindNone:
+		m["value"] = nil
+	case v.kind == ValueKindBool:
+		m["value"] = v.bits != 0
+	case v.kind == ValueKindOctetString:
+		m["value"] = hex.EncodeToString(v.bytes)
+	case v.kind.IsSigned():
+		m["value"] = int64(v.bits)
+	default:
+		m["value"] = v.bits
+	}
+
+	return m
+}
+
+// marshalReflect converts a field into maps, slices and basic types, which are marshaled as they are.
+func marshalReflect(v reflect.Value, fieldName string) interface{} {
+	switch v.Kind() {
+	case reflect.Invalid:
+		return nil
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+
+		switch n := v.Interface().(type) {
+		case Node:
+			return marshalNode(n)
+		case *smlEndOfMessage:
+			return nil
+		}
+
+		return marshalReflect(v.Elem(), fieldName)
+	case reflect.Slice:
+		if v.IsNil() {
+			return nil
+		}
+
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			if redactedFields[fieldName] && v.Len() != 0 {
+				return "<redacted>"
+			}
+
+			if obisFields[fieldName] {
+				if s, err := ObisToString(v.Bytes()); err == nil {
+					return s
+				}
+			}
+
+			return hex.EncodeToString(v.Bytes())
+		}
+
+		elements := make([]interface{}, v.Len())
+
+		for i := range elements {
+			elements[i] = marshalReflect(v.Index(i), fieldName)
+		}
+
+		return elements
+	case reflect.Struct:
+		fields := make(map[string]interface{}, v.NumField())
+
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+
+			if !field.IsExported() {
+				continue
+			}
+
+			params, err := parseFieldParams(field)
+
+			if err == nil && params.implicitChoiceAllowList != nil {
+				if v.Field(i).IsNil() {
+					fields[lowerCamelCase(field.Name)] = nil
+				} else {
+					fields[lowerCamelCase(field.Name)] = NewValue(v.Field(i).Interface(), 0).marshalValue()
+				}
+
+				continue
+			}
+
+			fields[lowerCamelCase(field.Name)] = marshalReflect(v.Field(i), field.Name)
+		}
+
+		if v.CanAddr() {
+			if extender, ok := v.Addr().Interface().(marshalExtender); ok {
+				extender.marshalExtra(fields)
+			}
+		}
+
+		return fields
+	default:
+		return v.Interface()
+	}
+}
+
+func marshalNode(n Node) interface{} {
+	switch t := n.(type) {
+	case *OctetStringNode:
+		return NewValue(t.Value, 0).marshalValue()
+	case *BoolNode:
+		return NewValue(t.Value, 0).marshalValue()
+	case *IntegerNode:
+		return t.Value.marshalValue()
+	case *ListNode:
+		elements := make([]interface{}, len(t.Elements))
+
+		for i, e := range t.Elements {
+			elements[i] = marshalNode(e)
+		}
+
+		return elements
+	}
+
+	return nil
+}
+
+func lowerCamelCase(s string) string {
+	r := []rune(s)
+
+	// Keep acronyms like CRC in the same case
+	for i := 0; i < len(r) && unicode.IsUpper(r[i]); i++ {
+		if i > 0 && i+1 < len(r) && unicode.IsLower(r[i+1]) {
+			break
+		}
+
+		r[i] = unicode.ToLower(r[i])
+	}
+
+	return string(r)
+}
+
+func (e *ListEntry) marshalExtra(fields map[string]interface{}) {
+	if obis, err := ObisFromBytes(e.ObjName); err == nil && obis.Name() != "" {
+		fields["name"] = obis.Name()
+	}
+
+	if symbol := e.Unit.Symbol(); symbol != "" {
+		fields["unitSymbol"] = symbol
+	}
+
+	if scaled, ok := e.TypedValue().Scaled(); ok {
+		f, _ := scaled.Float64()
+		fields["scaledValue"] = f
+	}
+
+	marshalStatusFlags(fields, e.TypedStatus)
+}
+
+func (e *ProfObjPeriodEntry) marshalExtra(fields map[string]interface{}) {
+	marshalStatusFlags(fields, e.TypedStatus)
+}
+
+func (p *GetProfileListResMessageBody) marshalExtra(fields map[string]interface{}) {
+	marshalStatusFlags(fields, p.TypedStatus)
+}
+
+func (e *TupelEntry) marshalExtra(fields map[string]interface{}) {
+	marshalStatusFlags(fields, e.TypedStatus)
+}
+
+// marshalStatusFlags adds the names of the known flags of a status word, if it has been transmitted.
+func marshalStatusFlags(fields map[string]interface{}, typedStatus func() (Status, bool)) {
+	status, ok := typedStatus()
+
+	if !ok {
+		return
+	}
+
+	flags := make([]string, 0)
+
+	for _, f := range status.Flags() {
+		flags = append(flags, f.String())
+	}
+
+	fields["statusFlags"] = flags
+}
+
+func (t *Time) marshalExtra(fields map[string]interface{}) {
+	if goTime, ok := t.Time(); ok {
+		fields["time"] = goTime.Format(time.RFC3339)
+	}
+}
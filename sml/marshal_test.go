@@ -0,0 +1,301 @@
+package sml
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestMarshalJSON(t *testing.T) {
+	file, err := NewReader(bytes.NewReader(capturedFrame(t))).ReadFile()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := json.Marshal(file.Messages[1])
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `{
+		"abortOnError": 0,
+		"crc16": "31ba",
+		"groupNo": 0,
+		"messageBody": {
+			"actGatewayTime": null,
+			"actSensorTime": {"localTimestamp": null, "secIndex": 12345678, "timestamp": null},
+			"clientId": null,
+			"listName": "1-0:98.10.255*255",
+			"listSignature": null,
+			"serverId": "0a01454d4800007f9e31",
+			"type": "SML_GetList.Res",
+			"valList": [
+				{
+					"name": "Manufacturer ID",
+					"objName": "129-129:199.130.3*255",
+					"scaler": 0,
+					"status": null,
+					"unit": 0,
+					"valTime": null,
+					"value": {"type": "octet string", "value": "454d48"},
+					"valueSignature": null
+				},
+				{
+					"name": "Device ID",
+					"objName": "1-0:0.0.9*255",
+					"scaler": 0,
+					"status": null,
+					"unit": 0,
+					"valTime": null,
+					"value": {"type": "octet string", "value": "0a01454d4800007f9e31"},
+					"valueSignature": null
+				},
+				{
+					"name": "Energy import",
+					"objName": "1-0:1.8.0*255",
+					"scaledValue": 4660,
+					"scaler": 0,
+					"status": null,
+					"unit": 30,
+					"unitSymbol": "Wh",
+					"valTime": null,
+					"value": {"type": "int64", "value": 4660},
+					"valueSignature": null
+				},
+				{
+					"name": "Energy export",
+					"objName": "1-0:2.8.0*255",
+					"scaledValue": 2.3,
+					"scaler": -1,
+					"status": null,
+					"unit": 30,
+					"unitSymbol": "Wh",
+					"valTime": null,
+					"value": {"type": "int64", "value": 23},
+					"valueSignature": null
+				},
+				{
+					"name": "Active power",
+					"objName": "1-0:16.7.0*255",
+					"scaledValue": -3090,
+					"scaler": 0,
+					"status": null,
+					"unit": 27,
+					"unitSymbol": "W",
+					"valTime": null,
+					"value": {"type": "int32", "value": -3090},
+					"valueSignature": null
+				}
+			]
+		},
+		"transactionId": "00b1c2d3"
+	}`
+
+	var gotValue, wantValue interface{}
+
+	if err := json.Unmarshal(got, &gotValue); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := json.Unmarshal([]byte(want), &wantValue); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(gotValue, wantValue) {
+		t.Errorf("MarshalJSON() = %s, want %s", got, want)
+	}
+}
+
+func TestMarshalYAML(t *testing.T) {
+	file, err := NewReader(bytes.NewReader(capturedFrame(t))).ReadFile()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := yaml.Marshal(file.Messages[0])
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `abortOnError: 0
+crc16: 1b48
+groupNo: 0
+messageBody:
+    clientId: null
+    codepage: null
+    refTime: null
+    reqFileId: 00b1c2d2
+    serverId: 0a01454d4800007f9e31
+    smlVersion: 0
+    type: SML_PublicOpen.Res
+transactionId: 00b1c2d1
+`
+
+	if string(got) != want {
+		t.Errorf("MarshalYAML() = %s, want %s", got, want)
+	}
+}
+
+func TestMarshalFile(t *testing.T) {
+	file, err := NewReader(bytes.NewReader(capturedFrame(t))).ReadFile()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jsonData, err := json.Marshal(file)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	yamlData, err := yaml.Marshal(file)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var fromJSON, fromYAML map[string]interface{}
+
+	if err := json.Unmarshal(jsonData, &fromJSON); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := yaml.Unmarshal(yamlData, &fromYAML); err != nil {
+		t.Fatal(err)
+	}
+
+	// Both formats share the same structure
+	for name, v := range map[string]map[string]interface{}{"JSON": fromJSON, "YAML": fromYAML} {
+		t.Run(name, func(t *testing.T) {
+			if got, want := sortedKeys(v), []string{"frame", "messages", "relaxations"}; !reflect.DeepEqual(got, want) {
+				t.Errorf("keys = %v, want %v", got, want)
+			}
+
+			frame, _ := v["frame"].(map[string]interface{})
+
+			if got, want := sortedKeys(frame), []string{"crc", "offset", "padding", "raw", "receivedAt", "skipped"}; !reflect.DeepEqual(got, want) {
+				t.Errorf("frame keys = %v, want %v", got, want)
+			}
+
+			if relaxations, ok := v["relaxations"].([]interface{}); !ok || len(relaxations) != 0 {
+				t.Errorf("relaxations = %#v, want an empty list", v["relaxations"])
+			}
+
+			messages, _ := v["messages"].([]interface{})
+			var types []string
+
+			for _, m := range messages {
+				body, _ := m.(map[string]interface{})["messageBody"].(map[string]interface{})
+				types = append(types, body["type"].(string))
+			}
+
+			if want := []string{"SML_PublicOpen.Res", "SML_GetList.Res", "SML_PublicClose.Res"}; !reflect.DeepEqual(types, want) {
+				t.Errorf("message types = %v, want %v", types, want)
+			}
+		})
+	}
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+
+	for k := range m {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+	return keys
+}
+
+func TestMarshalObisLists(t *testing.T) {
+	body := &GetProfileListReqMessageBody{}
+
+	if err := decodeHex(t, "79 0b 0a01454d4800007f9e31 01 01 42 01 01 01 72 07 8181c78201ff 07 0100630100ff 72 07 0100010800ff 07 0100020800ff 01", body); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := json.Marshal(&Message{MessageBody: body})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var message struct {
+		MessageBody struct {
+			ParameterTreePath []string
+			ObjectList        []string
+		}
+	}
+
+	if err := json.Unmarshal(got, &message); err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []string{"129-129:199.130.1*255", "1-0:99.1.0*255"}; !reflect.DeepEqual(message.MessageBody.ParameterTreePath, want) {
+		t.Errorf("parameterTreePath = %v, want %v", message.MessageBody.ParameterTreePath, want)
+	}
+
+	if want := []string{"1-0:1.8.0*255", "1-0:2.8.0*255"}; !reflect.DeepEqual(message.MessageBody.ObjectList, want) {
+		t.Errorf("objectList = %v, want %v", message.MessageBody.ObjectList, want)
+	}
+}
+
+func TestMarshalRedactsPasswords(t *testing.T) {
+	message := &Message{
+		MessageBody: &PublicOpenReqMessageBody{
+			ReqFileId: []byte{0x01},
+			Username:  []byte("user"),
+			Password:  []byte("secret"),
+		},
+	}
+
+	got, err := json.Marshal(message)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if bytes.Contains(got, []byte("secret")) || bytes.Contains(got, []byte(hex.EncodeToString([]byte("secret")))) {
+		t.Errorf("json.Marshal() = %s, contains the password", got)
+	}
+
+	var decoded struct {
+		MessageBody struct {
+			Username string
+			Password string
+		}
+	}
+
+	if err := json.Unmarshal(got, &decoded); err != nil {
+		t.Fatal(err)
+	}
+
+	if decoded.MessageBody.Password != "<redacted>" {
+		t.Errorf("password = %q, want <redacted>", decoded.MessageBody.Password)
+	}
+
+	// The username is not redacted
+	if want := hex.EncodeToString([]byte("user")); decoded.MessageBody.Username != want {
+		t.Errorf("username = %q, want %q", decoded.MessageBody.Username, want)
+	}
+
+	yamlGot, err := yaml.Marshal(message)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if bytes.Contains(yamlGot, []byte(hex.EncodeToString([]byte("secret")))) {
+		t.Errorf("yaml.Marshal() = %s, contains the password", yamlGot)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"reflect"
+	"strconv"
 	"strings"
 )
 
@@ -11,73 +12,91 @@ type fieldParams struct {
 	optional                bool
 	choiceHandler           string
 	implicitChoiceAllowList []ImplicitChoiceHandler
+	hasTag                  bool
+	tag                     uint32
 }
 
 type ChoiceHandler func(k string, keyToken smlToken) (interface{}, error)
 
-func smlMessageChoiceHandler(k string, keyToken smlToken) (interface{}, error) {
-	if k == "SML_MessageBody" {
-		var valueId uint32
-		foundValue := false
+// smlMessageChoiceHandler decodes the built-in and registered message bodies.
+var smlMessageChoiceHandler = newMessageChoiceHandler(nil)
+
+// newMessageChoiceHandler returns a choice handler which additionally decodes the message bodies of a reader.
+func newMessageChoiceHandler(readerBodies map[uint32]MessageBodyFactory) ChoiceHandler {
+	return func(k string, keyToken smlToken) (interface{}, error) {
+		if k != "SML_MessageBody" {
+			return nil, fmt.Errorf("unsupported choice %s", k)
+		}
 
 		// It SHOULD be an uint32, however, it MAY be encoded with fewer bits, when no ambiguity is created
-		t, ok := keyToken.(*smlUnsigned32)
+		valueId, err := deserializeChoiceTag(keyToken)
 
-		if !ok {
-			t2, ok := keyToken.(*smlUnsigned16)
-
-			if !ok {
-				t3, ok := keyToken.(*smlUnsigned8)
-
-				if !ok {
-					// fall through
-				} else {
-					valueId = uint32(t3.value)
-					foundValue = true
-				}
-			} else {
-				valueId = uint32(t2.value)
-				foundValue = true
-			}
-		} else {
-			valueId = t.value
-			foundValue = true
+		if err != nil {
+			return nil, err
 		}
 
-		if !foundValue {
-			return nil, InvalidMessage{fmt.Errorf("expected uint32, got %v", keyToken)}
+		if factory, ok := lookupMessageBody(valueId, readerBodies); ok {
+			return factory(), nil
 		}
 
-		switch valueId {
-		case 0x101:
-			return &PublicOpenResMessageBody{}, nil
-		case 0x201:
-			return &PublicCloseResMessageBody{}, nil
-		case 0x701:
-			return &GetListResMessageBody{}, nil
-		}
+		return &UnknownMessageBody{Tag: valueId}, nil
+	}
+}
 
-		return nil, InvalidMessage{fmt.Errorf("unsupported SML message %08x", valueId)}
+func deserializeChoiceTag(keyToken smlToken) (uint32, error) {
+	switch t := keyToken.(type) {
+	case *smlUnsigned32:
+		return t.value, nil
+	case *smlUnsigned16:
+		return uint32(t.value), nil
+	case *smlUnsigned8:
+		return uint32(t.value), nil
 	}
 
-	return nil, fmt.Errorf("unsupported choice %s", k)
+	return 0, newInvalidMessage(ErrTypeMismatch, "expected uint32 as tag of choice, got %v", keyToken)
 }
 
-func deserializeMessageBundle(bundle *unparsedMessageBundle) (*File, error) {
+// decoder holds the state of deserializing a single message bundle.
+type decoder struct {
+	choiceHandler       ChoiceHandler
+	plans               *planCache
+	coerceNumericWidths bool
+	relaxations         []Relaxation
+	// The unescaped bytes of the messages, which the received encodings of the decoded structs are sliced from
+	payload []byte
+}
+
+func deserializeMessageBundle(bundle *unparsedMessageBundle, options *ReaderOptions) (*File, error) {
+	d := &decoder{
+		choiceHandler:       newMessageChoiceHandler(options.MessageBodies),
+		plans:               decodePlans,
+		coerceNumericWidths: options.CoerceNumericWidths,
+		// The payload is reused by the reader, the received encodings of all structs share a single copy
+		payload: append([]byte(nil), bundle.payload...),
+	}
+
 	msgs := make([]*Message, 0)
 
-	for _, bundleList := range bundle.messages {
+	for i, bundleList := range bundle.messages {
 		m := &Message{}
 
-		err := deserializeField(reflect.ValueOf(m).Elem(), fieldParams{
+		err := d.deserializeField(reflect.ValueOf(m).Elem(), fieldParams{
 			optional: false,
-		}, bundleList, smlMessageChoiceHandler)
+		}, bundleList)
 
 		if err != nil {
-			if _, ok := err.(*InvalidMessage); !ok {
+			var invalid *InvalidMessage
+
+			if !errors.As(err, &invalid) {
 				return nil, err
 			}
 
+			invalid.prependPath(fmt.Sprintf("Messages[%d]", i))
+
+			if i < len(bundle.offsets) {
+				invalid.setOffset(bundle.offsets[i])
+			}
+
 			return nil, &InvalidFile{
 				error: err,
 			}
@@ -88,101 +107,108 @@ func deserializeMessageBundle(bundle *unparsedMessageBundle) (*File, error) {
 
 	if len(msgs) < 2 {
 		return nil, &InvalidFile{
-			errors.New("SML file must contain at least two messages"),
+			fmt.Errorf("%w: SML file must contain at least two messages", ErrFileStructure),
 		}
 	}
 
-	if _, ok := msgs[0].MessageBody.(*PublicOpenResMessageBody); !ok {
+	_, isRequest := msgs[0].MessageBody.(*PublicOpenReqMessageBody)
+	_, isResponse := msgs[0].MessageBody.(*PublicOpenResMessageBody)
+
+	if !isRequest && !isResponse {
 		return nil, &InvalidFile{
-			errors.New("SML file must begin with a SML_PublicOpen.Res message"),
+			fmt.Errorf("%w: SML file must begin with a SML_PublicOpen.Req or SML_PublicOpen.Res message", ErrFileStructure),
 		}
 	}
 
-	if _, ok := msgs[len(msgs)-1].MessageBody.(*PublicCloseResMessageBody); !ok {
-		return nil, &InvalidFile{
-			errors.New("SML file must end with a SML_PublicClose.Res message"),
+	if isRequest {
+		if _, ok := msgs[len(msgs)-1].MessageBody.(*PublicCloseReqMessageBody); !ok {
+			return nil, &InvalidFile{
+				fmt.Errorf("%w: SML file beginning with a SML_PublicOpen.Req message must end with a SML_PublicClose.Req message", ErrFileStructure),
+			}
+		}
+	} else {
+		if _, ok := msgs[len(msgs)-1].MessageBody.(*PublicCloseResMessageBody); !ok {
+			return nil, &InvalidFile{
+				fmt.Errorf("%w: SML file must end with a SML_PublicClose.Res message", ErrFileStructure),
+			}
 		}
 	}
 
 	for _, m := range msgs[1 : len(msgs)-1] {
-		_, isPublicOpen := m.MessageBody.(*PublicOpenResMessageBody)
-		_, isPublicClose := m.MessageBody.(*PublicCloseResMessageBody)
-
-		if isPublicOpen || isPublicClose {
+		switch m.MessageBody.(type) {
+		case *PublicOpenReqMessageBody, *PublicOpenResMessageBody, *PublicCloseReqMessageBody, *PublicCloseResMessageBody:
 			return nil, &InvalidFile{
-				errors.New("SML file must not contain a SML_PublicOpen.Res or SML_PublicClose.Res message in the middle of the file"),
+				fmt.Errorf("%w: SML file must not contain a SML_PublicOpen or SML_PublicClose message in the middle of the file", ErrFileStructure),
 			}
 		}
 	}
 
 	return &File{
-		Messages: msgs,
+		Messages:    msgs,
+		Relaxations: append(bundle.relaxations, d.relaxations...),
+
+		messageBodies: options.MessageBodies,
 	}, nil
 }
 
-func deserializeField(v reflect.Value, params fieldParams, token smlToken, choiceHandler ChoiceHandler) error {
-	var err error
-
-	switch v.Kind() {
-	case reflect.Slice:
-		if v.Type().Elem().Kind() == reflect.Uint8 {
-			bytes, err := deserializeOctetString(token)
+func (d *decoder) deserializeField(v reflect.Value, params fieldParams, token smlToken) error {
+	return d.decode(d.plans.get(v.Type()), v, &params, token)
+}
 
-			if err != nil {
-				return err
-			}
+// isAbsent reports whether the token is an empty octet string, which marks optional fields as not present.
+func isAbsent(params *fieldParams, token smlToken) bool {
+	octetString, ok := token.(*smlOctetString)
 
-			if len(bytes) != 0 || !params.optional {
-				v.Set(reflect.MakeSlice(v.Type(), len(bytes), len(bytes)))
-				reflect.Copy(v, reflect.ValueOf(bytes))
-			}
+	return ok && params.optional && len(octetString.value) == 0
+}
 
-			return nil
-		} else if (v.Type().Elem().Kind() == reflect.Pointer && v.Type().Elem().Elem().Kind() == reflect.Struct) || v.Type().Elem().Kind() == reflect.Interface {
-			// In any case, we need list
-			list, ok := token.(*smlList)
+func (d *decoder) decode(plan *decodePlan, v reflect.Value, params *fieldParams, token smlToken) error {
+	switch plan.kind {
+	case planOctetString:
+		bytes, err := deserializeOctetString(token)
 
-			if !ok {
-				return InvalidMessage{fmt.Errorf("deserializing a slice of pointers to structs or interfaces requires a list")}
-			}
+		if err != nil {
+			return err
+		}
 
-			slice := reflect.MakeSlice(reflect.SliceOf(v.Type().Elem()), 0, len(list.value))
+		if len(bytes) != 0 || !params.optional {
+			v.Set(reflect.MakeSlice(plan.typ, len(bytes), len(bytes)))
+			reflect.Copy(v, reflect.ValueOf(bytes))
+		}
 
-			for _, listElement := range list.value {
-				if v.Type().Elem().Kind() == reflect.Interface {
-					var value interface{}
+		return nil
+	case planList:
+		if isAbsent(params, token) {
+			return nil
+		}
 
-					err = deserializeField(reflect.ValueOf(value), params, listElement, choiceHandler)
+		// In any case, we need list
+		list, ok := token.(*smlList)
 
-					if err != nil {
-						return err
-					}
+		if !ok {
+			return newInvalidMessage(ErrTypeMismatch, "deserializing a slice of pointers to structs, interfaces or octet strings requires a list, got %v", token)
+		}
 
-					slice = reflect.Append(slice, reflect.ValueOf(value))
-				} else {
-					value := reflect.New(v.Type().Elem().Elem())
-					err = deserializeField(value.Elem(), params, listElement, choiceHandler)
+		slice := reflect.MakeSlice(plan.typ, len(list.value), len(list.value))
 
-					if err != nil {
-						return err
-					}
+		for i, listElement := range list.value {
+			element := slice.Index(i)
 
-					slice = reflect.Append(slice, value)
-				}
+			if plan.elemIsPointer {
+				element.Set(reflect.New(plan.elem.typ))
+				element = element.Elem()
 			}
 
-			v.Set(slice)
-			return nil
-		} else {
-			return fmt.Errorf("unsupported slice element type %v", v.Type().Elem().Kind())
-		}
-	case reflect.Struct:
-		for i := 0; i < v.Type().NumField(); i++ {
-			if !v.Type().Field(i).IsExported() {
-				return errors.New("struct contains unexported fields")
+			err := d.decode(plan.elem, element, params, listElement)
+
+			if err != nil {
+				return prependPath(err, fmt.Sprintf("[%d]", i))
 			}
 		}
 
+		v.Set(slice)
+		return nil
+	case planStruct:
 		list, ok := token.(*smlList)
 
 		if !ok {
@@ -190,41 +216,55 @@ func deserializeField(v reflect.Value, params fieldParams, token smlToken, choic
 				return nil
 			}
 
-			return &InvalidMessage{errors.New("struct needs to be decoded upon a list")}
+			return newInvalidMessage(ErrTypeMismatch, "struct %s needs to be decoded upon a list, got %v", plan.typ.Name(), token)
 		}
 
-		if len(list.value) != v.Type().NumField() {
-			return &InvalidMessage{errors.New("struct size mismatch against decoded data")}
+		if len(list.value) != len(plan.fields) {
+			return newInvalidMessage(ErrStructSizeMismatch, "struct %s has %d fields, got a list with %d elements", plan.typ.Name(), len(plan.fields), len(list.value))
 		}
 
-		for i := 0; i < v.Type().NumField(); i++ {
-			fieldName := v.Type().Field(i).Name
-			_ = fieldName
+		relaxations := len(d.relaxations)
 
-			p, err := parseFieldParams(v.Type().Field(i))
+		for i := range plan.fields {
+			field := &plan.fields[i]
+			err := d.decode(field.plan, v.Field(field.index), &field.params, list.value[i])
 
 			if err != nil {
-				return err
+				return prependPath(err, plan.typ.Field(field.index).Name)
 			}
+		}
 
-			err = deserializeField(v.Field(i), p, list.value[i], choiceHandler)
+		// Coerced values would be written with the received widths, so the encoding is only kept if nothing was relaxed
+		if plan.received && len(d.relaxations) == relaxations && list.end > list.start && list.end <= len(d.payload) {
+			setReceived(v, d.payload[list.start:list.end:list.end])
+		}
 
-			if err != nil {
-				return err
-			}
+		return nil
+	case planTaggedChoice:
+		return d.decodeTaggedChoice(plan, v, params, token)
+	case planPointer:
+		if isAbsent(params, token) {
+			return nil
 		}
 
+		value := reflect.New(plan.elem.typ)
+		err := d.decode(plan.elem, value.Elem(), params, token)
+
+		if err != nil {
+			return err
+		}
+
+		v.Set(value)
 		return nil
 
 	// Choice
-	case reflect.Interface:
+	case planInterface:
 		if params.implicitChoiceAllowList != nil {
-			return decodeImplicitChoice(v, params, token)
+			return decodeImplicitChoice(v, *params, token)
 		}
 
 		if params.choiceHandler == "" {
-			v.Set(reflect.ValueOf(token))
-			return nil
+			return decodeUntypedInterface(plan, v, token)
 		}
 
 		choiceList, ok := token.(*smlList)
@@ -234,147 +274,144 @@ func deserializeField(v reflect.Value, params fieldParams, token smlToken, choic
 				return nil
 			}
 
-			return InvalidMessage{errors.New("choice must be deserialized using a list with 2 elements")}
+			return newInvalidMessage(ErrTypeMismatch, "choice must be deserialized using a list with 2 elements, got %v", token)
 		}
 
-		interfaceValue, err := choiceHandler(params.choiceHandler, choiceList.value[0])
+		interfaceValue, err := d.choiceHandler(params.choiceHandler, choiceList.value[0])
 
 		if err != nil {
 			return err
 		}
 
+		// The content of unknown messages is kept as it is
+		if unknown, ok := interfaceValue.(*UnknownMessageBody); ok {
+			unknown.Tree, err = newNode(choiceList.value[1])
+
+			if err != nil {
+				return err
+			}
+
+			v.Set(reflect.ValueOf(unknown))
+			return nil
+		}
+
 		interfaceValueReflect := reflect.ValueOf(interfaceValue)
 
 		if interfaceValueReflect.Kind() != reflect.Pointer || interfaceValueReflect.Elem().Kind() != reflect.Struct {
-			return errors.New("choice handler must return a pointer to a struct")
+			return newInvalidMessage(ErrUnsupportedMessage, "choice handler must return a pointer to a struct, got %T", interfaceValue)
 		}
 
 		v.Set(interfaceValueReflect)
 
-		return deserializeField(v.Elem().Elem(), params, choiceList.value[1], choiceHandler)
-	case reflect.Uint8:
-		tok, ok := token.(*smlUnsigned8)
+		return d.decode(d.plans.get(interfaceValueReflect.Type().Elem()), v.Elem().Elem(), params, choiceList.value[1])
+	case planBool:
+		tok, ok := token.(*smlBoolean)
 
 		if !ok {
-			if octetString, ok := token.(*smlOctetString); ok && params.optional && len(octetString.value) == 0 {
-				tok = &smlUnsigned8{
-					value: 0,
-				}
-			} else {
-				return &InvalidMessage{fmt.Errorf("type mismatch. expected %s, got %v", "uint8", token)}
+			if !isAbsent(params, token) {
+				return newInvalidMessage(ErrTypeMismatch, "expected bool, got %v", token)
 			}
-		}
-
-		v.SetUint(uint64(tok.value))
-		return nil
-	case reflect.Uint16:
-		tok, ok := token.(*smlUnsigned16)
 
-		if !ok {
-			if octetString, ok := token.(*smlOctetString); ok && params.optional && len(octetString.value) == 0 {
-				tok = &smlUnsigned16{
-					value: 0,
-				}
-			} else {
-				return &InvalidMessage{fmt.Errorf("type mismatch. expected %s, got %v", "uint16", token)}
+			tok = &smlBoolean{
+				value: false,
 			}
 		}
 
-		v.SetUint(uint64(tok.value))
+		v.SetBool(tok.value)
 		return nil
-	case reflect.Uint32:
-		tok, ok := token.(*smlUnsigned32)
-
-		if !ok {
-			if octetString, ok := token.(*smlOctetString); ok && params.optional && len(octetString.value) == 0 {
-				tok = &smlUnsigned32{
-					value: 0,
-				}
-			} else {
-				return &InvalidMessage{fmt.Errorf("type mismatch. expected %s, got %v", "uint32", token)}
-			}
+	case planInteger:
+		if d.coerceNumericWidths && d.coerceInteger(v, token) {
+			return nil
 		}
 
-		v.SetUint(uint64(tok.value))
-		return nil
-	case reflect.Uint64:
-		tok, ok := token.(*smlUnsigned64)
+		value, signed, width, ok := integerToken(token)
 
-		if !ok {
-			if octetString, ok := token.(*smlOctetString); ok && params.optional && len(octetString.value) == 0 {
-				tok = &smlUnsigned64{
-					value: 0,
-				}
-			} else {
-				return &InvalidMessage{fmt.Errorf("type mismatch. expected %s, got %v", "uint64", token)}
+		if !ok || signed != plan.signed || width != plan.width {
+			if !isAbsent(params, token) {
+				return newInvalidMessage(ErrTypeMismatch, "expected %s, got %v", plan.typ.Kind(), token)
 			}
-		}
 
-		v.SetUint(tok.value)
-		return nil
-	case reflect.Int8:
-		tok, ok := token.(*smlSigned8)
+			value = 0
+		}
 
-		if !ok {
-			if octetString, ok := token.(*smlOctetString); ok && params.optional && len(octetString.value) == 0 {
-				tok = &smlSigned8{
-					value: 0,
-				}
-			} else {
-				return &InvalidMessage{fmt.Errorf("type mismatch. expected %s, got %v", "int8", token)}
-			}
+		if plan.signed {
+			// Sign-extend the raw bits of the token
+			shift := uint(64 - 8*plan.width)
+			v.SetInt(int64(value<<shift) >> shift)
+		} else {
+			v.SetUint(value)
 		}
 
-		v.SetInt(int64(tok.value))
 		return nil
-	case reflect.Int16:
-		tok, ok := token.(*smlSigned16)
+	default:
+		return plan.err
+	}
+}
 
-		if !ok {
-			if octetString, ok := token.(*smlOctetString); ok && params.optional && len(octetString.value) == 0 {
-				tok = &smlSigned16{
-					value: 0,
-				}
-			} else {
-				return &InvalidMessage{fmt.Errorf("type mismatch. expected %s, got %v", "int16", token)}
-			}
+// decodeUntypedInterface stores a token in an interface without a choice. The tokens are reused by the reader, so
+// they are converted into a token tree. Only the end of message marker is kept, as it does not carry any data.
+func decodeUntypedInterface(plan *decodePlan, v reflect.Value, token smlToken) error {
+	var value interface{} = token
+
+	if _, ok := token.(*smlEndOfMessage); !ok {
+		node, err := newNode(token)
+
+		if err != nil {
+			return err
 		}
 
-		v.SetInt(int64(tok.value))
-		return nil
-	case reflect.Int32:
-		tok, ok := token.(*smlSigned32)
+		value = node
+	}
 
-		if !ok {
-			if octetString, ok := token.(*smlOctetString); ok && params.optional && len(octetString.value) == 0 {
-				tok = &smlSigned32{
-					value: 0,
-				}
-			} else {
-				return &InvalidMessage{fmt.Errorf("type mismatch. expected %s, got %v", "int32", token)}
-			}
+	if !reflect.TypeOf(value).AssignableTo(plan.typ) {
+		return newInvalidMessage(ErrTypeMismatch, "%T can not be stored in %v", value, plan.typ)
+	}
+
+	v.Set(reflect.ValueOf(value))
+	return nil
+}
+
+// isTaggedChoice reports whether the struct represents a choice whose alternatives are selected by the tag of its fields.
+// Exactly one of the fields is set after decoding, so all of them must be pointers, interfaces or slices.
+func isTaggedChoice(t reflect.Type) bool {
+	if t.NumField() == 0 {
+		return false
+	}
+
+	p, err := parseFieldParams(t.Field(0))
+
+	return err == nil && p.hasTag
+}
+
+func (d *decoder) decodeTaggedChoice(plan *decodePlan, v reflect.Value, params *fieldParams, token smlToken) error {
+	choiceList, ok := token.(*smlList)
+
+	if !ok || len(choiceList.value) != 2 {
+		if _, ok := token.(*smlOctetString); params.optional && ok {
+			return nil
 		}
 
-		v.SetInt(int64(tok.value))
-		return nil
-	case reflect.Int64:
-		tok, ok := token.(*smlSigned64)
+		return newInvalidMessage(ErrTypeMismatch, "choice must be deserialized using a list with 2 elements, got %v", token)
+	}
 
-		if !ok {
-			if octetString, ok := token.(*smlOctetString); ok && params.optional && len(octetString.value) == 0 {
-				tok = &smlSigned64{
-					value: 0,
-				}
-			} else {
-				return &InvalidMessage{fmt.Errorf("type mismatch. expected %s, got %v", "int64", token)}
-			}
+	tag, err := deserializeChoiceTag(choiceList.value[0])
+
+	if err != nil {
+		return err
+	}
+
+	for i := range plan.fields {
+		field := &plan.fields[i]
+
+		if field.params.tag != tag {
+			continue
 		}
 
-		v.SetInt(tok.value)
-		return nil
-	default:
-		return fmt.Errorf("unsupported reflection type %v", v.Kind())
+		err := d.decode(field.plan, v.Field(field.index), &field.params, choiceList.value[1])
+		return prependPath(err, plan.typ.Field(field.index).Name)
 	}
+
+	return newInvalidMessage(ErrUnsupportedMessage, "unsupported tag %02x for choice %s", tag, plan.typ.Name())
 }
 
 func parseFieldParams(v reflect.StructField) (fieldParams, error) {
@@ -407,6 +444,19 @@ func parseFieldParams(v reflect.StructField) (fieldParams, error) {
 			}
 
 			p.implicitChoiceAllowList = list
+		case "tag":
+			if len(kvSplit) != 2 {
+				return fieldParams{}, errors.New("tag requires value")
+			}
+
+			tag, err := strconv.ParseUint(kvSplit[1], 0, 32)
+
+			if err != nil {
+				return fieldParams{}, err
+			}
+
+			p.hasTag = true
+			p.tag = uint32(tag)
 		default:
 			return fieldParams{}, fmt.Errorf("unkown tag value %s", v)
 		}
@@ -415,11 +465,15 @@ func parseFieldParams(v reflect.StructField) (fieldParams, error) {
 	return p, nil
 }
 
+func isOctetStringType(t reflect.Type) bool {
+	return t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8
+}
+
 func deserializeOctetString(token smlToken) ([]byte, error) {
 	octetString, ok := token.(*smlOctetString)
 
 	if !ok {
-		return nil, &InvalidMessage{fmt.Errorf("expected octet string, got %v", token)}
+		return nil, newInvalidMessage(ErrTypeMismatch, "expected octet string, got %v", token)
 	}
 
 	return octetString.value, nil
@@ -1,7 +1,6 @@
 package sml
 
 import (
-	"errors"
 	"fmt"
 	"reflect"
 )
@@ -62,7 +61,7 @@ func decodeImplicitChoice(v reflect.Value, params fieldParams, token smlToken) e
 		}
 	}
 
-	return errors.New("no implicit choice handler matched")
+	return newInvalidMessage(ErrTypeMismatch, "no implicit choice handler matched %v", token)
 }
 
 func decodeImplicitChoiceBoolean(v reflect.Value, token smlToken) (bool, error) {
@@ -72,7 +71,9 @@ func decodeImplicitChoiceBoolean(v reflect.Value, token smlToken) (bool, error)
 		return false, nil
 	}
 
-	v.SetBool(t.value)
+	val := reflect.New(reflect.TypeOf(t.value))
+	val.Elem().SetBool(t.value)
+	v.Set(val)
 	return true, nil
 }
 
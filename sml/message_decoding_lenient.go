@@ -0,0 +1,98 @@
+package sml
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// coerceInteger decodes an integer token into an integer field of a different width or signedness.
+// Integers of the same width are reinterpreted, as this is what firmware mixing up signedness does,
+// all others are only decoded if the value fits into the field.
+func (d *decoder) coerceInteger(v reflect.Value, token smlToken) bool {
+	var fieldSigned bool
+
+	switch v.Kind() {
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		fieldSigned = true
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		fieldSigned = false
+	default:
+		return false
+	}
+
+	fieldWidth := int(v.Type().Size())
+	value, tokenSigned, tokenWidth, ok := integerToken(token)
+
+	if !ok || (tokenSigned == fieldSigned && tokenWidth == fieldWidth) {
+		return false
+	}
+
+	if tokenWidth == fieldWidth {
+		if fieldSigned {
+			v.SetInt(int64(value))
+		} else {
+			v.SetUint(value)
+		}
+	} else {
+		// Sign-extend into 64 bits to compare against the range of the field
+		signedValue := int64(value)
+
+		if tokenSigned && tokenWidth < 8 {
+			shift := uint(64 - 8*tokenWidth)
+			signedValue = signedValue << shift >> shift
+		}
+
+		if fieldSigned {
+			if (!tokenSigned && value > 1<<63-1) || v.OverflowInt(signedValue) {
+				return false
+			}
+
+			v.SetInt(signedValue)
+		} else {
+			if (tokenSigned && signedValue < 0) || v.OverflowUint(value) {
+				return false
+			}
+
+			v.SetUint(value)
+		}
+	}
+
+	d.relaxations = append(d.relaxations, Relaxation{
+		Kind:   RelaxationNumericWidth,
+		Detail: fmt.Sprintf("decoded %s as %s", integerTokenName(tokenSigned, tokenWidth), v.Type()),
+	})
+
+	return true
+}
+
+// integerToken returns the raw bits of an integer token together with its signedness and width in bytes.
+func integerToken(token smlToken) (value uint64, signed bool, width int, ok bool) {
+	switch t := token.(type) {
+	case *smlSigned8:
+		return uint64(uint8(t.value)), true, 1, true
+	case *smlSigned16:
+		return uint64(uint16(t.value)), true, 2, true
+	case *smlSigned32:
+		return uint64(uint32(t.value)), true, 4, true
+	case *smlSigned64:
+		return uint64(t.value), true, 8, true
+	case *smlUnsigned8:
+		return uint64(t.value), false, 1, true
+	case *smlUnsigned16:
+		return uint64(t.value), false, 2, true
+	case *smlUnsigned32:
+		return uint64(t.value), false, 4, true
+	case *smlUnsigned64:
+		return t.value, false, 8, true
+	}
+
+	return 0, false, 0, false
+}
+
+func integerTokenName(signed bool, width int) string {
+	if signed {
+		return fmt.Sprintf("int%d", width*8)
+	}
+
+	return fmt.Sprintf("uint%d", width*8)
+}
@@ -0,0 +1,180 @@
+package sml
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+type planKind int
+
+const (
+	planOctetString planKind = iota
+	planList
+	planStruct
+	planTaggedChoice
+	planPointer
+	planInterface
+	planBool
+	planInteger
+	planUnsupported
+)
+
+// decodePlan is the decoding of a Go type compiled from its reflection type and the sml tags of its fields.
+type decodePlan struct {
+	kind planKind
+	typ  reflect.Type
+
+	// The plan of the elements of lists and of the value pointers refer to
+	elem *decodePlan
+	// List elements are pointers to elem, which are allocated while decoding
+	elemIsPointer bool
+
+	// The fields of structs and tagged choices
+	fields []fieldPlan
+	// The struct embeds a receivedEncoding as first field
+	received bool
+
+	// The signedness and width in bytes of integers
+	signed bool
+	width  int
+
+	// Types which can not be decoded fail with this error, once data for them is decoded
+	err error
+}
+
+type fieldPlan struct {
+	index  int
+	params fieldParams
+	plan   *decodePlan
+}
+
+// planCache holds the compiled plans of all types decoded so far.
+type planCache struct {
+	plans sync.Map
+}
+
+// decodePlans is shared by all readers, as plans only depend on the type.
+var decodePlans = &planCache{}
+
+func (c *planCache) get(t reflect.Type) *decodePlan {
+	if p, ok := c.plans.Load(t); ok {
+		return p.(*decodePlan)
+	}
+
+	// Recursive types refer to their plan before it is complete, so all plans of a compilation are published
+	// together once they are complete.
+	compiled := make(map[reflect.Type]*decodePlan)
+	p := c.compile(t, compiled)
+
+	for compiledType, compiledPlan := range compiled {
+		c.plans.LoadOrStore(compiledType, compiledPlan)
+	}
+
+	return p
+}
+
+func (c *planCache) compile(t reflect.Type, compiled map[reflect.Type]*decodePlan) *decodePlan {
+	if p, ok := c.plans.Load(t); ok {
+		return p.(*decodePlan)
+	}
+
+	if p, ok := compiled[t]; ok {
+		return p
+	}
+
+	p := &decodePlan{
+		typ: t,
+	}
+
+	compiled[t] = p
+
+	switch t.Kind() {
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			p.kind = planOctetString
+		} else if t.Elem().Kind() == reflect.Pointer && t.Elem().Elem().Kind() == reflect.Struct {
+			p.kind = planList
+			p.elem = c.compile(t.Elem().Elem(), compiled)
+			p.elemIsPointer = true
+		} else if t.Elem().Kind() == reflect.Interface || isOctetStringType(t.Elem()) {
+			p.kind = planList
+			p.elem = c.compile(t.Elem(), compiled)
+		} else {
+			p.kind = planUnsupported
+			p.err = fmt.Errorf("unsupported slice element type %v", t.Elem().Kind())
+		}
+	case reflect.Struct:
+		c.compileStruct(p, compiled)
+	case reflect.Pointer:
+		p.kind = planPointer
+		p.elem = c.compile(t.Elem(), compiled)
+	case reflect.Interface:
+		p.kind = planInterface
+	case reflect.Bool:
+		p.kind = planBool
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		p.kind = planInteger
+		p.width = int(t.Size())
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		p.kind = planInteger
+		p.signed = true
+		p.width = int(t.Size())
+	default:
+		p.kind = planUnsupported
+		p.err = fmt.Errorf("unsupported reflection type %v", t.Kind())
+	}
+
+	return p
+}
+
+func (c *planCache) compileStruct(p *decodePlan, compiled map[reflect.Type]*decodePlan) {
+	p.kind = planStruct
+
+	p.received = p.typ.NumField() != 0 && p.typ.Field(0).Type == receivedEncodingType
+
+	for i := 0; i < p.typ.NumField(); i++ {
+		if i == 0 && p.received {
+			continue
+		}
+
+		if !p.typ.Field(i).IsExported() {
+			p.kind = planUnsupported
+			p.err = errors.New("struct contains unexported fields")
+			return
+		}
+	}
+
+	if isTaggedChoice(p.typ) {
+		p.kind = planTaggedChoice
+	}
+
+	p.fields = make([]fieldPlan, 0, p.typ.NumField())
+
+	for i := 0; i < p.typ.NumField(); i++ {
+		// The received encoding is not transmitted
+		if i == 0 && p.received {
+			continue
+		}
+
+		params, err := parseFieldParams(p.typ.Field(i))
+
+		if err != nil {
+			p.kind = planUnsupported
+			p.err = err
+			return
+		}
+
+		// Alternatives of tagged choices without a tag can never be decoded
+		if p.kind == planTaggedChoice && !params.hasTag {
+			continue
+		}
+
+		p.fields = append(p.fields, fieldPlan{
+			index:  i,
+			params: params,
+			plan:   c.compile(p.typ.Field(i).Type, compiled),
+		})
+	}
+}
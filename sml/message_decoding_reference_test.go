@@ -0,0 +1,244 @@
+package sml
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// referenceDecoder is the decoder used before the decoding plans were introduced. It walks the reflection types and
+// parses the sml tags of every field of every decoded message. It is kept as reference for the benchmarks and to
+// verify that the plans decode the same values.
+type referenceDecoder struct {
+	choiceHandler ChoiceHandler
+}
+
+func (d *referenceDecoder) deserializeField(v reflect.Value, params fieldParams, token smlToken) error {
+	switch v.Kind() {
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			bytes, err := deserializeOctetString(token)
+
+			if err != nil {
+				return err
+			}
+
+			if len(bytes) != 0 || !params.optional {
+				v.Set(reflect.MakeSlice(v.Type(), len(bytes), len(bytes)))
+				reflect.Copy(v, reflect.ValueOf(bytes))
+			}
+
+			return nil
+		} else if (v.Type().Elem().Kind() == reflect.Pointer && v.Type().Elem().Elem().Kind() == reflect.Struct) || v.Type().Elem().Kind() == reflect.Interface || isOctetStringType(v.Type().Elem()) {
+			if isAbsent(&params, token) {
+				return nil
+			}
+
+			list, ok := token.(*smlList)
+
+			if !ok {
+				return newInvalidMessage(ErrTypeMismatch, "deserializing a slice of pointers to structs, interfaces or octet strings requires a list, got %v", token)
+			}
+
+			slice := reflect.MakeSlice(reflect.SliceOf(v.Type().Elem()), len(list.value), len(list.value))
+
+			for i, listElement := range list.value {
+				element := slice.Index(i)
+
+				if element.Kind() == reflect.Pointer {
+					element.Set(reflect.New(v.Type().Elem().Elem()))
+					element = element.Elem()
+				}
+
+				if err := d.deserializeField(element, params, listElement); err != nil {
+					return err
+				}
+			}
+
+			v.Set(slice)
+			return nil
+		}
+
+		return fmt.Errorf("unsupported slice element type %v", v.Type().Elem().Kind())
+	case reflect.Struct:
+		first := 0
+
+		// The received encoding is not transmitted
+		if hasReceivedEncoding(v) {
+			first = 1
+		}
+
+		for i := first; i < v.Type().NumField(); i++ {
+			if !v.Type().Field(i).IsExported() {
+				return errors.New("struct contains unexported fields")
+			}
+		}
+
+		if isTaggedChoice(v.Type()) {
+			return d.deserializeTaggedChoice(v, params, token)
+		}
+
+		list, ok := token.(*smlList)
+
+		if !ok {
+			if _, ok := token.(*smlOctetString); params.optional && ok {
+				return nil
+			}
+
+			return newInvalidMessage(ErrTypeMismatch, "struct %s needs to be decoded upon a list, got %v", v.Type().Name(), token)
+		}
+
+		element := 0
+
+		for i := first; i < v.Type().NumField(); i++ {
+			p, err := parseFieldParams(v.Type().Field(i))
+
+			if err != nil {
+				return err
+			}
+
+			if element >= len(list.value) {
+				return newInvalidMessage(ErrStructSizeMismatch, "struct %s has more fields than the list has elements", v.Type().Name())
+			}
+
+			if err := d.deserializeField(v.Field(i), p, list.value[element]); err != nil {
+				return err
+			}
+
+			element++
+		}
+
+		if element != len(list.value) {
+			return newInvalidMessage(ErrStructSizeMismatch, "struct %s has fewer fields than the list has elements", v.Type().Name())
+		}
+
+		return nil
+	case reflect.Pointer:
+		if isAbsent(&params, token) {
+			return nil
+		}
+
+		value := reflect.New(v.Type().Elem())
+
+		if err := d.deserializeField(value.Elem(), params, token); err != nil {
+			return err
+		}
+
+		v.Set(value)
+		return nil
+	case reflect.Interface:
+		if params.implicitChoiceAllowList != nil {
+			return decodeImplicitChoice(v, params, token)
+		}
+
+		if params.choiceHandler == "" {
+			return decodeUntypedInterface(&decodePlan{typ: v.Type()}, v, token)
+		}
+
+		choiceList, ok := token.(*smlList)
+
+		if !ok || len(choiceList.value) != 2 {
+			if _, ok := token.(*smlOctetString); params.optional && ok {
+				return nil
+			}
+
+			return newInvalidMessage(ErrTypeMismatch, "choice must be deserialized using a list with 2 elements, got %v", token)
+		}
+
+		interfaceValue, err := d.choiceHandler(params.choiceHandler, choiceList.value[0])
+
+		if err != nil {
+			return err
+		}
+
+		if unknown, ok := interfaceValue.(*UnknownMessageBody); ok {
+			unknown.Tree, err = newNode(choiceList.value[1])
+
+			if err != nil {
+				return err
+			}
+
+			v.Set(reflect.ValueOf(unknown))
+			return nil
+		}
+
+		interfaceValueReflect := reflect.ValueOf(interfaceValue)
+
+		if interfaceValueReflect.Kind() != reflect.Pointer || interfaceValueReflect.Elem().Kind() != reflect.Struct {
+			return errors.New("choice handler must return a pointer to a struct")
+		}
+
+		v.Set(interfaceValueReflect)
+
+		return d.deserializeField(v.Elem().Elem(), params, choiceList.value[1])
+	case reflect.Bool:
+		tok, ok := token.(*smlBoolean)
+
+		if !ok {
+			if !isAbsent(&params, token) {
+				return newInvalidMessage(ErrTypeMismatch, "expected bool, got %v", token)
+			}
+
+			tok = &smlBoolean{}
+		}
+
+		v.SetBool(tok.value)
+		return nil
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		value, signed, width, ok := integerToken(token)
+		wantSigned := v.Kind() >= reflect.Int8 && v.Kind() <= reflect.Int64
+
+		if !ok || signed != wantSigned || width != int(v.Type().Size()) {
+			if !isAbsent(&params, token) {
+				return newInvalidMessage(ErrTypeMismatch, "expected %s, got %v", v.Kind(), token)
+			}
+
+			value = 0
+		}
+
+		if wantSigned {
+			shift := uint(64 - 8*width)
+			v.SetInt(int64(value<<shift) >> shift)
+		} else {
+			v.SetUint(value)
+		}
+
+		return nil
+	default:
+		return fmt.Errorf("unsupported reflection type %v", v.Kind())
+	}
+}
+
+func (d *referenceDecoder) deserializeTaggedChoice(v reflect.Value, params fieldParams, token smlToken) error {
+	choiceList, ok := token.(*smlList)
+
+	if !ok || len(choiceList.value) != 2 {
+		if _, ok := token.(*smlOctetString); params.optional && ok {
+			return nil
+		}
+
+		return newInvalidMessage(ErrTypeMismatch, "choice must be deserialized using a list with 2 elements, got %v", token)
+	}
+
+	tag, err := deserializeChoiceTag(choiceList.value[0])
+
+	if err != nil {
+		return err
+	}
+
+	for i := 0; i < v.Type().NumField(); i++ {
+		p, err := parseFieldParams(v.Type().Field(i))
+
+		if err != nil {
+			return err
+		}
+
+		if !p.hasTag || p.tag != tag {
+			continue
+		}
+
+		return d.deserializeField(v.Field(i), p, choiceList.value[1])
+	}
+
+	return newInvalidMessage(ErrUnsupportedMessage, "unsupported tag %02x for choice %s", tag, v.Type().Name())
+}
@@ -0,0 +1,372 @@
+package sml
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// decodeHex decodes a single unescaped SML element into the value v points to.
+func decodeHex(tb testing.TB, s string, v interface{}) error {
+	data, err := hex.DecodeString(strings.ReplaceAll(s, " ", ""))
+
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	r := newSmlBinaryReader(bytes.NewReader(data), ReaderOptions{
+		MaxAllocation: DefaultMaxAllocation,
+		MaxDepth:      DefaultMaxDepth,
+		MaxFrameSize:  DefaultMaxFrameSize,
+	})
+
+	token, err := r.readToken()
+
+	if err != nil {
+		return err
+	}
+
+	d := &decoder{
+		choiceHandler: smlMessageChoiceHandler,
+		plans:         decodePlans,
+	}
+
+	return d.deserializeField(reflect.ValueOf(v).Elem(), fieldParams{}, token)
+}
+
+// benchmarkGetListRes returns the token of the SML_GetList.Res of the benchmark frame.
+func benchmarkGetListRes(tb testing.TB) smlToken {
+	frame := benchmarkFrame(tb)
+	bundle, err := newSmlBinaryReader(bytes.NewReader(frame), ReaderOptions{MaxAllocation: DefaultMaxAllocation, MaxDepth: DefaultMaxDepth, MaxFrameSize: DefaultMaxFrameSize}).readMessageBundle()
+
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	// The second element of the choice of the second message is the SML_GetList.Res
+	return bundle.messages[1].value[3].(*smlList).value[1]
+}
+
+func benchmarkDeserializeGetListRes(b *testing.B, deserialize func(v reflect.Value, token smlToken) error) {
+	body := benchmarkGetListRes(b)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		var v GetListResMessageBody
+
+		if err := deserialize(reflect.ValueOf(&v).Elem(), body); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkDeserializeGetListResReflective measures the decoder walking the types for every message, which has been
+// replaced by the plans.
+func BenchmarkDeserializeGetListResReflective(b *testing.B) {
+	d := &referenceDecoder{choiceHandler: smlMessageChoiceHandler}
+
+	benchmarkDeserializeGetListRes(b, func(v reflect.Value, token smlToken) error {
+		return d.deserializeField(v, fieldParams{}, token)
+	})
+}
+
+// BenchmarkDeserializeGetListResUncached compiles the plans for every message.
+func BenchmarkDeserializeGetListResUncached(b *testing.B) {
+	benchmarkDeserializeGetListRes(b, func(v reflect.Value, token smlToken) error {
+		d := &decoder{choiceHandler: smlMessageChoiceHandler, plans: &planCache{}}
+		return d.deserializeField(v, fieldParams{}, token)
+	})
+}
+
+func BenchmarkDeserializeGetListResCached(b *testing.B) {
+	d := &decoder{choiceHandler: smlMessageChoiceHandler, plans: decodePlans}
+
+	benchmarkDeserializeGetListRes(b, func(v reflect.Value, token smlToken) error {
+		return d.deserializeField(v, fieldParams{}, token)
+	})
+}
+
+func TestDecodePlansMatchReference(t *testing.T) {
+	body := benchmarkGetListRes(t)
+
+	var want, got GetListResMessageBody
+	reference := &referenceDecoder{choiceHandler: smlMessageChoiceHandler}
+
+	if err := reference.deserializeField(reflect.ValueOf(&want).Elem(), fieldParams{}, body); err != nil {
+		t.Fatal(err)
+	}
+
+	d := &decoder{choiceHandler: smlMessageChoiceHandler, plans: &planCache{}}
+
+	if err := d.deserializeField(reflect.ValueOf(&got).Elem(), fieldParams{}, body); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("plans decoded\n%v\nreference decoded\n%v", &got, &want)
+	}
+}
+
+// fuzzFrame wraps the unescaped messages of a file into a frame with valid padding and transport CRC.
+func fuzzFrame(payload []byte) []byte {
+	w := newSmlBinaryWriter(nil)
+	countPaddingBytes := (4 - len(payload)%4) % 4
+
+	frame := &bytes.Buffer{}
+	frame.Write(beginOfMessageMarker)
+	w.escape(frame, append(payload, make([]byte, countPaddingBytes)...))
+	frame.Write([]byte{0x1b, 0x1b, 0x1b, 0x1b, 0x1a, byte(countPaddingBytes)})
+
+	checksum := w.checksum(frame.Bytes())
+	frame.WriteByte(byte(checksum >> 8))
+	frame.WriteByte(byte(checksum))
+
+	return frame.Bytes()
+}
+
+// fuzzPayload returns the unescaped messages of a file.
+func fuzzPayload(tb testing.TB, f *File) []byte {
+	bundle, err := serializeMessageBundle(f)
+
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	buf := &bytes.Buffer{}
+	w := newSmlBinaryWriter(buf)
+
+	for _, m := range bundle.messages {
+		if err := w.encodeMessage(buf, m); err != nil {
+			tb.Fatal(err)
+		}
+	}
+
+	return buf.Bytes()
+}
+
+// FuzzDeserializeMessageBundle decodes arbitrary messages. The input is framed with a valid transport CRC and
+// the message CRCs are skipped, so mutations reach the decoder. Decoded files are formatted, marshaled and
+// encoded again, as all of these process the decoded data. The corpus in testdata/fuzz contains the seeds.
+func FuzzDeserializeMessageBundle(f *testing.F) {
+	f.Add(fuzzPayload(f, benchmarkFile()))
+
+	f.Fuzz(func(t *testing.T, payload []byte) {
+		for _, coerce := range []bool{false, true} {
+			options := ReaderOptions{
+				MaxAllocation:       DefaultMaxAllocation,
+				MaxDepth:            DefaultMaxDepth,
+				MaxFrameSize:        DefaultMaxFrameSize,
+				SkipMessageCrc:      true,
+				CoerceNumericWidths: coerce,
+			}
+
+			bundle, err := newSmlBinaryReader(bytes.NewReader(fuzzFrame(payload)), options).readMessageBundle()
+
+			if err == io.EOF {
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			file, err := deserializeMessageBundle(bundle, &options)
+
+			if err != nil {
+				var invalid *InvalidFile
+
+				if !errors.As(err, &invalid) {
+					t.Fatalf("unexpected error: %v", err)
+				}
+
+				continue
+			}
+
+			_ = file.String()
+			_ = file.IsRequest()
+			_ = file.AttentionErrors()
+			_ = (*Verifier)(nil).VerifyAll(file)
+
+			if _, err := json.Marshal(file); err != nil {
+				t.Fatalf("failed to marshal decoded file: %v", err)
+			}
+
+			// Decoded files are not necessarily valid, e.g. required fields may be absent
+			_ = NewWriter(io.Discard).WriteFile(file)
+		}
+	})
+}
+
+// implicitChoiceExamples contains a value for every alternative of an implicit choice.
+var implicitChoiceExamples = map[string]func(n int) interface{}{
+	"bool":         func(n int) interface{} { v := n%2 == 0; return &v },
+	"octet_string": func(n int) interface{} { return []byte{byte(n), 0x1b} },
+	"int8":         func(n int) interface{} { v := -int8(n); return &v },
+	"int16":        func(n int) interface{} { v := -int16(n) << 8; return &v },
+	"int32":        func(n int) interface{} { v := -int32(n) << 24; return &v },
+	"int64":        func(n int) interface{} { v := -int64(n) << 56; return &v },
+	"uint8":        func(n int) interface{} { v := uint8(n); return &v },
+	"uint16":       func(n int) interface{} { v := uint16(n) << 8; return &v },
+	"uint32":       func(n int) interface{} { v := uint32(n) << 24; return &v },
+	"uint64":       func(n int) interface{} { v := uint64(n) << 56; return &v },
+}
+
+// populate sets every field of v to a value depending on n, choosing different alternatives of the choices.
+// The tag is the sml struct tag of the field v is stored in.
+func populate(tb testing.TB, v reflect.Value, tag string, n *int, depth int) {
+	*n++
+
+	switch v.Kind() {
+	case reflect.Pointer:
+		v.Set(reflect.New(v.Type().Elem()))
+		populate(tb, v.Elem(), tag, n, depth)
+	case reflect.Interface:
+		var alternatives []string
+
+		for _, option := range strings.Split(tag, ",") {
+			if strings.HasPrefix(option, "implicit_choice:") {
+				alternatives = strings.Split(option, ":")[1:]
+			}
+		}
+
+		if alternatives == nil {
+			tb.Fatalf("interface %v is not an implicit choice", v.Type())
+		}
+
+		v.Set(reflect.ValueOf(implicitChoiceExamples[alternatives[*n%len(alternatives)]](*n)))
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			v.SetBytes([]byte{byte(*n), 0x1b, 0x1b, 0x1b, 0x1b})
+			return
+		}
+
+		// Trees are nested a few levels only
+		if depth > 2 {
+			return
+		}
+
+		v.Set(reflect.MakeSlice(v.Type(), 2, 2))
+
+		for i := 0; i < v.Len(); i++ {
+			populate(tb, v.Index(i), "", n, depth+1)
+		}
+	case reflect.Struct:
+		if isTaggedChoice(v.Type()) {
+			i := *n % v.NumField()
+			populate(tb, v.Field(i), v.Type().Field(i).Tag.Get("sml"), n, depth)
+			return
+		}
+
+		for i := 0; i < v.NumField(); i++ {
+			// The received encoding is set by the decoder
+			if v.Type().Field(i).IsExported() {
+				populate(tb, v.Field(i), v.Type().Field(i).Tag.Get("sml"), n, depth)
+			}
+		}
+	case reflect.Bool:
+		v.SetBool(*n%2 == 0)
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		v.SetInt(-int64(*n))
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		v.SetUint(uint64(*n))
+	default:
+		tb.Fatalf("unsupported kind %v", v.Kind())
+	}
+}
+
+// TestDecodePlans encodes a populated body of every message type and checks that decoding it with the plans
+// results in the same struct, both with freshly compiled and with the shared plans.
+func TestDecodePlans(t *testing.T) {
+	for _, factory := range builtinMessageBodies {
+		body := factory()
+		t.Run(messageBodyName(body), func(t *testing.T) {
+			for variant := 0; variant < 4; variant++ {
+				n := variant
+				populate(t, reflect.ValueOf(body).Elem(), "", &n, 0)
+
+				token, err := newEncoder(nil).serializeField(reflect.ValueOf(body).Elem(), fieldParams{}, nil)
+
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				for _, plans := range []*planCache{{}, decodePlans} {
+					d := &decoder{
+						choiceHandler: smlMessageChoiceHandler,
+						plans:         plans,
+					}
+
+					decoded := factory()
+
+					if err := d.deserializeField(reflect.ValueOf(decoded).Elem(), fieldParams{}, token); err != nil {
+						t.Fatal(err)
+					}
+
+					if !reflect.DeepEqual(decoded, body) {
+						t.Errorf("decoded\n%v\nwant\n%v", decoded, body)
+					}
+				}
+			}
+		})
+	}
+}
+
+type vendorTreeBody struct {
+	ServerId []byte
+	Value    interface{}
+}
+
+func (b *vendorTreeBody) String() string {
+	return fmt.Sprintf("Value = %v", b.Value)
+}
+
+// TestDecodeUntypedInterface checks that interfaces without a choice keep their value after the reader has reused
+// its tokens for the next frame.
+func TestDecodeUntypedInterface(t *testing.T) {
+	options := ReaderOptions{
+		MessageBodies: map[uint32]MessageBodyFactory{
+			testReaderTag: func() MessageBody { return &vendorTreeBody{} },
+		},
+	}
+
+	reader := NewReaderWithOptions(bytes.NewReader(append(vendorFrame(t, testReaderTag), capturedFrame(t)...)), options)
+	file, err := reader.ReadFile()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := reader.ReadFile(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := &IntegerNode{Value: NewValue(uint32(42), 0)}
+
+	if got := file.Messages[1].MessageBody.(*vendorTreeBody).Value; !reflect.DeepEqual(got, want) {
+		t.Errorf("Value = %#v, want %#v", got, want)
+	}
+
+	if _, ok := file.Messages[1].EndOfMessage.(*smlEndOfMessage); !ok {
+		t.Errorf("EndOfMessage = %T, want the end of message marker", file.Messages[1].EndOfMessage)
+	}
+
+	// The token tree is encoded again
+	buf := &bytes.Buffer{}
+	file.Messages[1].receivedEncoding = receivedEncoding{}
+
+	if err := NewWriter(buf).WriteFile(file); err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(buf.Bytes(), vendorFrame(t, testReaderTag)) {
+		t.Errorf("WriteFile() = %x, want %x", buf.Bytes(), vendorFrame(t, testReaderTag))
+	}
+}
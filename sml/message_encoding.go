@@ -0,0 +1,405 @@
+package sml
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+type choiceEncoder func(k string, value interface{}) (smlToken, error)
+
+// smlMessageChoiceEncoder encodes the built-in and registered message bodies.
+var smlMessageChoiceEncoder = newMessageChoiceEncoder(nil)
+
+// newMessageChoiceEncoder returns a choice encoder which additionally encodes the message bodies of a reader.
+func newMessageChoiceEncoder(readerBodies map[uint32]MessageBodyFactory) choiceEncoder {
+	return func(k string, value interface{}) (smlToken, error) {
+		if k != "SML_MessageBody" {
+			return nil, fmt.Errorf("unsupported choice %s", k)
+		}
+
+		var valueId uint32
+
+		switch v := value.(type) {
+		case *PublicOpenReqMessageBody:
+			valueId = 0x100
+		case *PublicOpenResMessageBody:
+			valueId = 0x101
+		case *PublicCloseReqMessageBody:
+			valueId = 0x200
+		case *PublicCloseResMessageBody:
+			valueId = 0x201
+		case *GetProfilePackReqMessageBody:
+			valueId = 0x300
+		case *GetProfilePackResMessageBody:
+			valueId = 0x301
+		case *GetProfileListReqMessageBody:
+			valueId = 0x400
+		case *GetProfileListResMessageBody:
+			valueId = 0x401
+		case *GetProcParameterReqMessageBody:
+			valueId = 0x500
+		case *GetProcParameterResMessageBody:
+			valueId = 0x501
+		case *SetProcParameterReqMessageBody:
+			valueId = 0x600
+		case *GetListReqMessageBody:
+			valueId = 0x700
+		case *GetListResMessageBody:
+			valueId = 0x701
+		case *AttentionResMessageBody:
+			valueId = 0xFF01
+		case *UnknownMessageBody:
+			valueId = v.Tag
+		default:
+			tag, ok := lookupMessageBodyTag(value, readerBodies)
+
+			if !ok {
+				return nil, fmt.Errorf("unsupported SML message %T", value)
+			}
+
+			valueId = tag
+		}
+
+		return &smlUnsigned32{
+			value: valueId,
+		}, nil
+	}
+}
+
+// encoder holds the state of serializing a file.
+type encoder struct {
+	choiceEncoder choiceEncoder
+}
+
+func newEncoder(readerBodies map[uint32]MessageBodyFactory) *encoder {
+	return &encoder{
+		choiceEncoder: newMessageChoiceEncoder(readerBodies),
+	}
+}
+
+func serializeMessageBundle(file *File) (*unparsedMessageBundle, error) {
+	e := newEncoder(file.messageBodies)
+
+	bundle := &unparsedMessageBundle{
+		messages: make([]*smlList, 0, len(file.Messages)),
+	}
+
+	for _, m := range file.Messages {
+		var received smlToken
+
+		// Messages which have not been modified since they have been read are written as they have been received
+		if raw, unchanged := unchangedReceived(reflect.ValueOf(m).Elem()); unchanged {
+			bundle.messages = append(bundle.messages, &smlList{raw: raw})
+			continue
+		} else if raw != nil {
+			received = readReceived(raw)
+		}
+
+		// The CRC is calculated by the binary writer, the end of message marker is always the same
+		msg := *m
+		msg.Crc16 = 0
+		msg.EndOfMessage = &smlEndOfMessage{}
+		msg.receivedEncoding = receivedEncoding{}
+
+		token, err := e.serializeField(reflect.ValueOf(&msg).Elem(), fieldParams{
+			optional: false,
+		}, received)
+
+		if err != nil {
+			return nil, err
+		}
+
+		bundle.messages = append(bundle.messages, token.(*smlList))
+	}
+
+	return bundle, nil
+}
+
+// receivedElement returns the i-th element of a received list with n elements. It returns nil, if the received
+// token is not such a list, e.g. because the field has not been read.
+func receivedElement(received smlToken, i int, n int) smlToken {
+	list, ok := received.(*smlList)
+
+	if !ok || len(list.value) != n {
+		return nil
+	}
+
+	return list.value[i]
+}
+
+// receivedChoice returns the value of a received choice, if it has been received with the given tag.
+func receivedChoice(received smlToken, tag uint32) smlToken {
+	receivedTag, err := deserializeChoiceTag(receivedElement(received, 0, 2))
+
+	if err != nil || receivedTag != tag {
+		return nil
+	}
+
+	return receivedElement(received, 1, 2)
+}
+
+// serializeField encodes a field. The received token is the encoding the field has been read from, if known.
+// Zero values of optional fields are left out, unless they have been received explicitly.
+func (e *encoder) serializeField(v reflect.Value, params fieldParams, received smlToken) (smlToken, error) {
+	switch v.Kind() {
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return &smlOctetString{
+				value: v.Bytes(),
+			}, nil
+		} else if (v.Type().Elem().Kind() == reflect.Pointer && v.Type().Elem().Elem().Kind() == reflect.Struct) || v.Type().Elem().Kind() == reflect.Interface || isOctetStringType(v.Type().Elem()) {
+			if v.IsNil() && params.optional {
+				return &smlOctetString{}, nil
+			}
+
+			list := &smlList{
+				value: make([]smlToken, v.Len()),
+			}
+
+			for i := 0; i < v.Len(); i++ {
+				element := v.Index(i)
+
+				if element.Kind() == reflect.Pointer {
+					if element.IsNil() {
+						return nil, errors.New("slices must not contain nil pointers")
+					}
+
+					element = element.Elem()
+				}
+
+				token, err := e.serializeField(element, params, receivedElement(received, i, v.Len()))
+
+				if err != nil {
+					return nil, err
+				}
+
+				list.value[i] = token
+			}
+
+			return list, nil
+		} else {
+			return nil, fmt.Errorf("unsupported slice element type %v", v.Type().Elem().Kind())
+		}
+	case reflect.Struct:
+		if isTaggedChoice(v.Type()) {
+			return e.serializeTaggedChoice(v, received)
+		}
+
+		first := 0
+
+		// Structs which have not been modified since they have been read are written as they have been received
+		if hasReceivedEncoding(v) {
+			if raw, unchanged := unchangedReceived(v); unchanged {
+				return &smlList{raw: raw}, nil
+			} else if raw != nil {
+				received = readReceived(raw)
+			}
+
+			// The received encoding is not transmitted
+			first = 1
+		}
+
+		fields := make([]int, 0, v.Type().NumField())
+		params := make([]fieldParams, 0, v.Type().NumField())
+
+		for i := first; i < v.Type().NumField(); i++ {
+			if !v.Type().Field(i).IsExported() {
+				return nil, errors.New("struct contains unexported fields")
+			}
+
+			p, err := parseFieldParams(v.Type().Field(i))
+
+			if err != nil {
+				return nil, err
+			}
+
+			fields = append(fields, i)
+			params = append(params, p)
+		}
+
+		list := &smlList{
+			value: make([]smlToken, len(fields)),
+		}
+
+		for j, i := range fields {
+			token, err := e.serializeField(v.Field(i), params[j], receivedElement(received, j, len(fields)))
+
+			if err != nil {
+				return nil, err
+			}
+
+			list.value[j] = token
+		}
+
+		return list, nil
+
+	case reflect.Pointer:
+		if v.IsNil() {
+			if params.optional {
+				return &smlOctetString{}, nil
+			}
+
+			return nil, errors.New("non-optional value is missing")
+		}
+
+		return e.serializeField(v.Elem(), params, received)
+
+	// Choice
+	case reflect.Interface:
+		if v.IsNil() {
+			if params.optional {
+				return &smlOctetString{}, nil
+			}
+
+			return nil, errors.New("non-optional value is missing")
+		}
+
+		if params.implicitChoiceAllowList != nil {
+			return encodeImplicitChoice(v.Elem())
+		}
+
+		if params.choiceHandler == "" {
+			if node, ok := v.Interface().(Node); ok {
+				return node.token()
+			}
+
+			return v.Interface(), nil
+		}
+
+		keyToken, err := e.choiceEncoder(params.choiceHandler, v.Interface())
+
+		if err != nil {
+			return nil, err
+		}
+
+		if v.Elem().Kind() != reflect.Pointer || v.Elem().Elem().Kind() != reflect.Struct {
+			return nil, errors.New("choice value must be a pointer to a struct")
+		}
+
+		var valueToken smlToken
+
+		if unknown, ok := v.Interface().(*UnknownMessageBody); ok {
+			if unknown.Tree == nil {
+				return nil, errors.New("unknown message body must contain a tree")
+			}
+
+			valueToken, err = unknown.Tree.token()
+		} else {
+			tag, _ := deserializeChoiceTag(keyToken)
+			valueToken, err = e.serializeField(v.Elem().Elem(), params, receivedChoice(received, tag))
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		return &smlList{
+			value: []smlToken{keyToken, valueToken},
+		}, nil
+	case reflect.Bool:
+		if params.optional && !v.Bool() && isAbsent(&params, received) {
+			return &smlOctetString{}, nil
+		}
+
+		return &smlBoolean{
+			value: v.Bool(),
+		}, nil
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if params.optional && v.IsZero() && (received == nil || isAbsent(&params, received)) {
+			return &smlOctetString{}, nil
+		}
+
+		return encodeNumber(v)
+	default:
+		return nil, fmt.Errorf("unsupported reflection type %v", v.Kind())
+	}
+}
+
+func (e *encoder) serializeTaggedChoice(v reflect.Value, received smlToken) (smlToken, error) {
+	for i := 0; i < v.Type().NumField(); i++ {
+		switch v.Field(i).Kind() {
+		case reflect.Pointer, reflect.Interface, reflect.Slice:
+		default:
+			return nil, fmt.Errorf("alternatives of choice %s must be nillable", v.Type().Name())
+		}
+
+		if v.Field(i).IsNil() {
+			continue
+		}
+
+		p, err := parseFieldParams(v.Type().Field(i))
+
+		if err != nil {
+			return nil, err
+		}
+
+		valueToken, err := e.serializeField(v.Field(i), p, receivedChoice(received, p.tag))
+
+		if err != nil {
+			return nil, err
+		}
+
+		var keyToken smlToken = &smlUnsigned32{value: p.tag}
+
+		if p.tag <= 0xFF {
+			keyToken = &smlUnsigned8{value: uint8(p.tag)}
+		}
+
+		return &smlList{
+			value: []smlToken{keyToken, valueToken},
+		}, nil
+	}
+
+	return nil, fmt.Errorf("no alternative of choice %s is set", v.Type().Name())
+}
+
+func encodeNumber(v reflect.Value) (smlToken, error) {
+	switch v.Kind() {
+	case reflect.Uint8:
+		return &smlUnsigned8{value: uint8(v.Uint())}, nil
+	case reflect.Uint16:
+		return &smlUnsigned16{value: uint16(v.Uint())}, nil
+	case reflect.Uint32:
+		return &smlUnsigned32{value: uint32(v.Uint())}, nil
+	case reflect.Uint64:
+		return &smlUnsigned64{value: v.Uint()}, nil
+	case reflect.Int8:
+		return &smlSigned8{value: int8(v.Int())}, nil
+	case reflect.Int16:
+		return &smlSigned16{value: int16(v.Int())}, nil
+	case reflect.Int32:
+		return &smlSigned32{value: int32(v.Int())}, nil
+	case reflect.Int64:
+		return &smlSigned64{value: v.Int()}, nil
+	default:
+		return nil, fmt.Errorf("unsupported numeric type %v", v.Kind())
+	}
+}
+
+func encodeImplicitChoice(v reflect.Value) (smlToken, error) {
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return nil, errors.New("implicit choice must not contain a nil pointer")
+		}
+
+		v = v.Elem()
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		return &smlBoolean{
+			value: v.Bool(),
+		}, nil
+	case reflect.Slice:
+		if v.Type().Elem().Kind() != reflect.Uint8 {
+			return nil, fmt.Errorf("unsupported implicit choice type %v", v.Type())
+		}
+
+		return &smlOctetString{
+			value: v.Bytes(),
+		}, nil
+	default:
+		return encodeNumber(v)
+	}
+}
@@ -0,0 +1,180 @@
+package sml
+
+import (
+	"bytes"
+	"reflect"
+)
+
+// receivedEncoding keeps the encoding a struct has been read from. It is embedded as first field into the structs
+// which are written as they have been received as long as they are not modified, so the widths and explicitly
+// transmitted default values chosen by the meter are kept.
+type receivedEncoding struct {
+	// The unescaped encoding, nil if the struct has not been read
+	raw []byte
+	// The fingerprint of the struct right after decoding it
+	fingerprint uint64
+}
+
+var receivedEncodingType = reflect.TypeOf(receivedEncoding{})
+
+// receiver is implemented by the pointers to structs embedding a receivedEncoding.
+type receiver interface {
+	setReceived(raw []byte, fingerprint uint64)
+}
+
+func (r *receivedEncoding) setReceived(raw []byte, fingerprint uint64) {
+	r.raw = raw
+	r.fingerprint = fingerprint
+}
+
+// hasReceivedEncoding reports whether a struct embeds a receivedEncoding.
+func hasReceivedEncoding(v reflect.Value) bool {
+	return v.Kind() == reflect.Struct && v.NumField() != 0 && v.Field(0).Type() == receivedEncodingType
+}
+
+// setReceived stores the encoding of a decoded struct together with its fingerprint.
+// Nested structs have been decoded before, so their stored fingerprints are used.
+func setReceived(v reflect.Value, raw []byte) {
+	v.Addr().Interface().(receiver).setReceived(raw, fingerprint(v, true))
+}
+
+// unchangedReceived returns the encoding of a struct that has been read and whether the struct is still unmodified.
+func unchangedReceived(v reflect.Value) ([]byte, bool) {
+	received := v.Field(0)
+	raw := received.Field(0).Bytes()
+
+	if len(raw) == 0 {
+		return nil, false
+	}
+
+	return raw, fingerprint(v, false) == received.Field(1).Uint()
+}
+
+const (
+	fingerprintOffset = 14695981039346656037
+	fingerprintPrime  = 1099511628211
+)
+
+// fingerprint hashes the fields of a struct embedding a receivedEncoding with FNV-1a. Nested structs embedding one
+// contribute their own fingerprint, which is taken from their receivedEncoding if stored is set, or computed.
+func fingerprint(v reflect.Value, stored bool) uint64 {
+	h := uint64(fingerprintOffset)
+
+	for i := 1; i < v.NumField(); i++ {
+		h = hashValue(h, v.Field(i), stored)
+	}
+
+	return h
+}
+
+func hashUint(h uint64, x uint64) uint64 {
+	for i := 0; i < 8; i++ {
+		h = (h ^ (x & 0xff)) * fingerprintPrime
+		x >>= 8
+	}
+
+	return h
+}
+
+func hashBytes(h uint64, b []byte) uint64 {
+	h = hashUint(h, uint64(len(b)))
+
+	for _, c := range b {
+		h = (h ^ uint64(c)) * fingerprintPrime
+	}
+
+	return h
+}
+
+func hashString(h uint64, s string) uint64 {
+	h = hashUint(h, uint64(len(s)))
+
+	for i := 0; i < len(s); i++ {
+		h = (h ^ uint64(s[i])) * fingerprintPrime
+	}
+
+	return h
+}
+
+func hashValue(h uint64, v reflect.Value, stored bool) uint64 {
+	h = hashUint(h, uint64(v.Kind()))
+
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return hashUint(h, 0)
+		}
+
+		if v.Kind() == reflect.Interface {
+			h = hashString(h, v.Elem().Type().String())
+		}
+
+		return hashValue(h, v.Elem(), stored)
+	case reflect.Slice:
+		if v.IsNil() {
+			return hashUint(h, 0)
+		}
+
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return hashBytes(hashUint(h, 1), v.Bytes())
+		}
+
+		h = hashUint(h, uint64(v.Len())+1)
+
+		for i := 0; i < v.Len(); i++ {
+			h = hashValue(h, v.Index(i), stored)
+		}
+
+		return h
+	case reflect.Struct:
+		if hasReceivedEncoding(v) {
+			received := v.Field(0)
+
+			if stored && received.Field(0).Len() != 0 {
+				return hashUint(h, received.Field(1).Uint())
+			}
+
+			return hashUint(h, fingerprint(v, stored))
+		}
+
+		for i := 0; i < v.NumField(); i++ {
+			h = hashValue(h, v.Field(i), stored)
+		}
+
+		return h
+	case reflect.Bool:
+		if v.Bool() {
+			return hashUint(h, 1)
+		}
+
+		return hashUint(h, 0)
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return hashUint(h, uint64(v.Int()))
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return hashUint(h, v.Uint())
+	case reflect.String:
+		return hashString(h, v.String())
+	}
+
+	return h
+}
+
+// readReceived reads the tokens of the encoding of a modified struct, which are used as hints for encoding it again.
+func readReceived(raw []byte) smlToken {
+	escaped := &bytes.Buffer{}
+	newSmlBinaryWriter(nil).escape(escaped, raw)
+
+	r := newSmlBinaryReader(bytes.NewReader(escaped.Bytes()), ReaderOptions{
+		MaxAllocation: DefaultMaxAllocation,
+		MaxDepth:      DefaultMaxDepth,
+		MaxFrameSize:  DefaultMaxFrameSize,
+	})
+
+	token, err := r.readToken()
+
+	if err != nil {
+		return nil
+	}
+
+	return token
+}
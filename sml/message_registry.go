@@ -0,0 +1,140 @@
+package sml
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// MessageBodyFactory returns a new message body to decode a message into. The body must be a pointer to a
+// struct, whose fields are decoded in order using their sml struct tags like the built-in message bodies.
+type MessageBodyFactory func() MessageBody
+
+var builtinMessageBodies = map[uint32]MessageBodyFactory{
+	0x100:  func() MessageBody { return &PublicOpenReqMessageBody{} },
+	0x101:  func() MessageBody { return &PublicOpenResMessageBody{} },
+	0x200:  func() MessageBody { return &PublicCloseReqMessageBody{} },
+	0x201:  func() MessageBody { return &PublicCloseResMessageBody{} },
+	0x300:  func() MessageBody { return &GetProfilePackReqMessageBody{} },
+	0x301:  func() MessageBody { return &GetProfilePackResMessageBody{} },
+	0x400:  func() MessageBody { return &GetProfileListReqMessageBody{} },
+	0x401:  func() MessageBody { return &GetProfileListResMessageBody{} },
+	0x500:  func() MessageBody { return &GetProcParameterReqMessageBody{} },
+	0x501:  func() MessageBody { return &GetProcParameterResMessageBody{} },
+	0x600:  func() MessageBody { return &SetProcParameterReqMessageBody{} },
+	0x700:  func() MessageBody { return &GetListReqMessageBody{} },
+	0x701:  func() MessageBody { return &GetListResMessageBody{} },
+	0xFF01: func() MessageBody { return &AttentionResMessageBody{} },
+}
+
+var builtinMessageBodyNames = map[reflect.Type]string{
+	reflect.TypeOf(&PublicOpenReqMessageBody{}):       "SML_PublicOpen.Req",
+	reflect.TypeOf(&PublicOpenResMessageBody{}):       "SML_PublicOpen.Res",
+	reflect.TypeOf(&PublicCloseReqMessageBody{}):      "SML_PublicClose.Req",
+	reflect.TypeOf(&PublicCloseResMessageBody{}):      "SML_PublicClose.Res",
+	reflect.TypeOf(&GetProfilePackReqMessageBody{}):   "SML_GetProfilePack.Req",
+	reflect.TypeOf(&GetProfilePackResMessageBody{}):   "SML_GetProfilePack.Res",
+	reflect.TypeOf(&GetProfileListReqMessageBody{}):   "SML_GetProfileList.Req",
+	reflect.TypeOf(&GetProfileListResMessageBody{}):   "SML_GetProfileList.Res",
+	reflect.TypeOf(&GetProcParameterReqMessageBody{}): "SML_GetProcParameter.Req",
+	reflect.TypeOf(&GetProcParameterResMessageBody{}): "SML_GetProcParameter.Res",
+	reflect.TypeOf(&SetProcParameterReqMessageBody{}): "SML_SetProcParameter.Req",
+	reflect.TypeOf(&GetListReqMessageBody{}):          "SML_GetList.Req",
+	reflect.TypeOf(&GetListResMessageBody{}):          "SML_GetList.Res",
+	reflect.TypeOf(&AttentionResMessageBody{}):        "SML_Attention.Res",
+	reflect.TypeOf(&UnknownMessageBody{}):             "unknown",
+}
+
+// messageBodyName returns the name of a body defined by the SML specification, or the Go type name of others.
+func messageBodyName(body MessageBody) string {
+	t := reflect.TypeOf(body)
+
+	if name, ok := builtinMessageBodyNames[t]; ok {
+		return name
+	}
+
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	return t.Name()
+}
+
+var messageBodyRegistryLock sync.RWMutex
+
+// messageBodyRegistry contains the bodies added by RegisterMessageBody
+var messageBodyRegistry = map[uint32]MessageBodyFactory{}
+
+// messageBodyTags maps the types of the registered bodies to their tag for encoding
+var messageBodyTags = map[reflect.Type]uint32{}
+
+// RegisterMessageBody adds a vendor specific message body, which is then decoded by all readers and encoded by
+// all writers. Bodies can be registered for a single reader in ReaderOptions.MessageBodies instead.
+// It panics if the tag belongs to a message body defined by the SML specification or is already registered,
+// or if the factory does not return a pointer to a struct.
+func RegisterMessageBody(tag uint32, factory MessageBodyFactory) {
+	if _, ok := builtinMessageBodies[tag]; ok {
+		panic(fmt.Sprintf("sml: message body %08x is defined by the SML specification", tag))
+	}
+
+	t, err := messageBodyType(factory)
+
+	if err != nil {
+		panic(fmt.Sprintf("sml: message body %08x: %v", tag, err))
+	}
+
+	messageBodyRegistryLock.Lock()
+	defer messageBodyRegistryLock.Unlock()
+
+	if _, ok := messageBodyRegistry[tag]; ok {
+		panic(fmt.Sprintf("sml: message body %08x registered twice", tag))
+	}
+
+	messageBodyRegistry[tag] = factory
+	messageBodyTags[t] = tag
+}
+
+func messageBodyType(factory MessageBodyFactory) (reflect.Type, error) {
+	t := reflect.TypeOf(factory())
+
+	if t == nil || t.Kind() != reflect.Pointer || t.Elem().Kind() != reflect.Struct {
+		return nil, fmt.Errorf("factory must return a pointer to a struct, got %v", t)
+	}
+
+	return t, nil
+}
+
+// lookupMessageBody returns the factory for a tag. The bodies of the reader take precedence over the registered
+// ones, the bodies defined by the SML specification can not be replaced.
+func lookupMessageBody(tag uint32, readerBodies map[uint32]MessageBodyFactory) (MessageBodyFactory, bool) {
+	if factory, ok := builtinMessageBodies[tag]; ok {
+		return factory, true
+	}
+
+	if factory, ok := readerBodies[tag]; ok {
+		return factory, true
+	}
+
+	messageBodyRegistryLock.RLock()
+	defer messageBodyRegistryLock.RUnlock()
+
+	factory, ok := messageBodyRegistry[tag]
+	return factory, ok
+}
+
+// lookupMessageBodyTag returns the tag of a message body of the reader or a registered one.
+func lookupMessageBodyTag(body interface{}, readerBodies map[uint32]MessageBodyFactory) (uint32, bool) {
+	t := reflect.TypeOf(body)
+
+	for tag, factory := range readerBodies {
+		if reflect.TypeOf(factory()) == t {
+			return tag, true
+		}
+	}
+
+	messageBodyRegistryLock.RLock()
+	defer messageBodyRegistryLock.RUnlock()
+
+	tag, ok := messageBodyTags[t]
+	return tag, ok
+}
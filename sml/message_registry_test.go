@@ -0,0 +1,208 @@
+package sml
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+type vendorCounterBody struct {
+	ServerId []byte
+	Counter  uint32
+}
+
+func (b *vendorCounterBody) String() string {
+	return fmt.Sprintf("Counter = %d", b.Counter)
+}
+
+type vendorStateBody struct {
+	ServerId []byte
+	State    uint32
+}
+
+func (b *vendorStateBody) String() string {
+	return fmt.Sprintf("State = %d", b.State)
+}
+
+// The tags are vendor specific, the registry is shared by all tests
+const (
+	testRegisteredTag = 0x80000101
+	testReaderTag     = 0x80000201
+)
+
+func init() {
+	RegisterMessageBody(testRegisteredTag, func() MessageBody { return &vendorCounterBody{} })
+}
+
+// vendorFrame contains a message with the given tag between the SML_PublicOpen.Res and SML_PublicClose.Res messages.
+func vendorFrame(tb testing.TB, tag uint32) []byte {
+	var payload []byte
+
+	payload = append(payload, capturedMessage(tb,
+		"05 00b1c2d0 6200 6200 72 630101 76 01 01 05 00b1c2d1 0b 0a01454d4800007f9e31 01 01")...)
+	payload = append(payload, capturedMessage(tb,
+		fmt.Sprintf("05 00b1c2d1 6200 6200 72 65%08x 72 0b 0a01454d4800007f9e31 65 0000002a", tag))...)
+	payload = append(payload, capturedMessage(tb,
+		"05 00b1c2d2 6200 6200 72 630201 71 01")...)
+
+	return fuzzFrame(payload)
+}
+
+func recoverPanic(f func()) (message string) {
+	defer func() {
+		if r := recover(); r != nil {
+			message = fmt.Sprint(r)
+		}
+	}()
+
+	f()
+	return ""
+}
+
+func TestRegisterMessageBody(t *testing.T) {
+	frame := vendorFrame(t, testRegisteredTag)
+
+	file, err := NewReader(bytes.NewReader(frame)).ReadFile()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body, ok := file.Messages[1].MessageBody.(*vendorCounterBody)
+
+	if !ok || body.Counter != 42 || hex.EncodeToString(body.ServerId) != "0a01454d4800007f9e31" {
+		t.Fatalf("MessageBody = %#v, want the registered body", file.Messages[1].MessageBody)
+	}
+
+	if name := messageBodyName(body); name != "vendorCounterBody" {
+		t.Errorf("messageBodyName() = %q, want the type name", name)
+	}
+
+	// The modified message is encoded again using the tag of the registered body
+	body.Counter = 43
+
+	buf := &bytes.Buffer{}
+
+	if err := NewWriter(buf).WriteFile(file); err != nil {
+		t.Fatal(err)
+	}
+
+	written, err := NewReader(bytes.NewReader(buf.Bytes())).ReadFile()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if body, ok := written.Messages[1].MessageBody.(*vendorCounterBody); !ok || body.Counter != 43 {
+		t.Errorf("MessageBody = %#v, want the modified body", written.Messages[1].MessageBody)
+	}
+}
+
+func TestRegisterMessageBodyPanics(t *testing.T) {
+	tests := []struct {
+		name    string
+		tag     uint32
+		factory MessageBodyFactory
+		want    string
+	}{
+		{
+			name:    "registered twice",
+			tag:     testRegisteredTag,
+			factory: func() MessageBody { return &vendorStateBody{} },
+			want:    "registered twice",
+		},
+		{
+			name:    "specified",
+			tag:     0x701,
+			factory: func() MessageBody { return &vendorStateBody{} },
+			want:    "defined by the SML specification",
+		},
+		{
+			name:    "nil",
+			tag:     0x80000301,
+			factory: func() MessageBody { return nil },
+			want:    "must return a pointer to a struct",
+		},
+		{
+			name:    "not a struct",
+			tag:     0x80000302,
+			factory: func() MessageBody { return &vendorTagBody{} },
+			want:    "must return a pointer to a struct",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := recoverPanic(func() {
+				RegisterMessageBody(tt.tag, tt.factory)
+			})
+
+			if !strings.Contains(got, tt.want) {
+				t.Errorf("RegisterMessageBody() panic = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	// The failed registrations have not changed the registry
+	if factory, ok := lookupMessageBody(testRegisteredTag, nil); !ok || fmt.Sprintf("%T", factory()) != "*sml.vendorCounterBody" {
+		t.Errorf("lookupMessageBody() = %T, want the body registered first", factory())
+	}
+
+	if _, ok := lookupMessageBody(0x80000301, nil); ok {
+		t.Error("lookupMessageBody() found a body whose registration failed")
+	}
+}
+
+// vendorTagBody is a message body, which is not a struct.
+type vendorTagBody []byte
+
+func (b *vendorTagBody) String() string {
+	return hex.EncodeToString(*b)
+}
+
+func TestReaderMessageBodies(t *testing.T) {
+	options := ReaderOptions{
+		MessageBodies: map[uint32]MessageBodyFactory{
+			testReaderTag:     func() MessageBody { return &vendorStateBody{} },
+			testRegisteredTag: func() MessageBody { return &vendorStateBody{} },
+			// The bodies defined by the SML specification can not be replaced
+			0x201: func() MessageBody { return &vendorStateBody{} },
+		},
+	}
+
+	tests := []struct {
+		name    string
+		tag     uint32
+		options ReaderOptions
+		want    string
+	}{
+		{name: "reader body", tag: testReaderTag, options: options, want: "*sml.vendorStateBody"},
+		{name: "other reader", tag: testReaderTag, want: "*sml.UnknownMessageBody"},
+		{name: "precedence over registered body", tag: testRegisteredTag, options: options, want: "*sml.vendorStateBody"},
+		{name: "registered body", tag: testRegisteredTag, want: "*sml.vendorCounterBody"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file, err := NewReaderWithOptions(bytes.NewReader(vendorFrame(t, tt.tag)), tt.options).ReadFile()
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := fmt.Sprintf("%T", file.Messages[1].MessageBody); got != tt.want {
+				t.Errorf("MessageBody = %s, want %s", got, tt.want)
+			}
+
+			if got := fmt.Sprintf("%T", file.Messages[2].MessageBody); got != "*sml.PublicCloseResMessageBody" {
+				t.Errorf("MessageBody = %s, want *sml.PublicCloseResMessageBody", got)
+			}
+
+			if unknown, ok := file.Messages[1].MessageBody.(*UnknownMessageBody); ok && unknown.Tag != tt.tag {
+				t.Errorf("Tag = %08x, want %08x", unknown.Tag, tt.tag)
+			}
+		})
+	}
+}
@@ -3,10 +3,42 @@ package sml
 import (
 	"encoding/hex"
 	"fmt"
+	"reflect"
+	"time"
 )
 
 type File struct {
 	Messages []*Message
+
+	// Relaxations lists the checks that failed, but have been accepted due to the ReaderOptions
+	Relaxations []Relaxation
+
+	// Frame describes the transport frame the file has been read from, it is empty for files not read by a Reader
+	Frame Frame
+
+	// The message bodies of the reader the file has been read with, so they can be encoded again
+	messageBodies map[uint32]MessageBodyFactory
+}
+
+// Frame is the metadata of a SML transport frame.
+type Frame struct {
+	// Raw contains the escaped bytes of the frame, from the begin of message marker up to the CRC
+	Raw []byte
+	// Offset is the position of the begin of message marker in the stream
+	Offset uint64
+	// Skipped is the number of bytes skipped between the previous frame, valid or not, and the begin of the frame
+	Skipped uint64
+	// Crc is the transport checksum
+	Crc uint16
+	// Padding is the number of zero-bytes added to the messages
+	Padding int
+	// ReceivedAt is the time the end of message marker has been read
+	ReceivedAt time.Time
+}
+
+func (f Frame) String() string {
+	return fmt.Sprintf("%d bytes at offset %d after %d skipped bytes, padding %d, crc %04x, received at %s",
+		len(f.Raw), f.Offset, f.Skipped, f.Padding, f.Crc, f.ReceivedAt.Format(time.RFC3339Nano))
 }
 
 func (f *File) String() string {
@@ -23,7 +55,38 @@ func (f *File) String() string {
 	return s
 }
 
+// IsRequest reports whether the file has been sent by a client, i.e. begins with a SML_PublicOpen.Req message.
+func (f *File) IsRequest() bool {
+	if len(f.Messages) == 0 {
+		return false
+	}
+
+	_, ok := f.Messages[0].MessageBody.(*PublicOpenReqMessageBody)
+	return ok
+}
+
+// AttentionErrors returns the errors reported by all SML_Attention.Res messages within the file.
+func (f *File) AttentionErrors() []*AttentionError {
+	var errs []*AttentionError
+
+	for _, m := range f.Messages {
+		attention, ok := m.MessageBody.(*AttentionResMessageBody)
+
+		if !ok {
+			continue
+		}
+
+		if err := attention.Err(); err != nil {
+			errs = append(errs, err.(*AttentionError))
+		}
+	}
+
+	return errs
+}
+
 type Message struct {
+	receivedEncoding
+
 	TransactionId []byte
 	GroupNo       uint8
 	AbortOnError  uint8
@@ -49,13 +112,31 @@ type MessageBody interface {
 	fmt.Stringer
 }
 
+// UnknownMessageBody is a message body with a tag not known to the decoder. Its content is kept as token tree,
+// so the other messages of the file can still be used.
+type UnknownMessageBody struct {
+	Tag  uint32
+	Tree Node
+}
+
+func (u *UnknownMessageBody) String() string {
+	s := fmt.Sprintf("Unknown message %08x = {\n", u.Tag)
+
+	if u.Tree != nil {
+		s += prefixMultilineString(u.Tree.String(), " ") + "\n"
+	}
+
+	s += "}"
+	return s
+}
+
 type PublicOpenResMessageBody struct {
 	Codepage   []byte `sml:"optional"`
 	ClientId   []byte `sml:"optional"`
 	ReqFileId  []byte
 	ServerId   []byte
-	RefTime    interface{} `sml:"optional"`
-	SmlVersion uint8       `sml:"optional"`
+	RefTime    *Time `sml:"optional"`
+	SmlVersion uint8 `sml:"optional"`
 }
 
 func (p *PublicOpenResMessageBody) String() string {
@@ -64,7 +145,8 @@ func (p *PublicOpenResMessageBody) String() string {
 	s += fmt.Sprintf(" Codepage = %s\n", hex.EncodeToString(p.Codepage))
 	s += fmt.Sprintf(" ClientId = %s\n", hex.EncodeToString(p.ClientId))
 	s += fmt.Sprintf(" ReqFileId = %s\n", hex.EncodeToString(p.ReqFileId))
-	s += fmt.Sprintf(" ServerId = %s\n", hex.EncodeToString(p.ServerId))
+	s += fmt.Sprintf(" ServerId = %s\n", stringServerId(p.ServerId))
+	s += fmt.Sprintf(" RefTime = %s\n", stringTime(p.RefTime))
 	s += fmt.Sprintf(" SmlVersion = %02x\n", p.SmlVersion)
 
 	s += "}"
@@ -83,21 +165,24 @@ func (p *PublicCloseResMessageBody) String() string {
 }
 
 type GetListResMessageBody struct {
+	receivedEncoding
+
 	ClientId       []byte `sml:"optional"`
 	ServerId       []byte
-	ListName       []byte      `sml:"optional"`
-	ActSensorTime  interface{} `sml:"optional"`
+	ListName       []byte `sml:"optional"`
+	ActSensorTime  *Time  `sml:"optional"`
 	ValList        []*ListEntry
-	ListSignature  []byte      `sml:"optional"`
-	ActGatewayTime interface{} `sml:"optional"`
+	ListSignature  []byte `sml:"optional"`
+	ActGatewayTime *Time  `sml:"optional"`
 }
 
 func (p *GetListResMessageBody) String() string {
 	s := "SML_GetList.Res = {\n"
 
 	s += fmt.Sprintf(" ClientId = %s\n", hex.EncodeToString(p.ClientId))
-	s += fmt.Sprintf(" ServerId = %s\n", hex.EncodeToString(p.ServerId))
+	s += fmt.Sprintf(" ServerId = %s\n", stringServerId(p.ServerId))
 	s += fmt.Sprintf(" ListName = %s\n", hex.EncodeToString(p.ListName))
+	s += fmt.Sprintf(" ActSensorTime = %s\n", stringTime(p.ActSensorTime))
 
 	s += " ValList = [\n"
 
@@ -106,15 +191,18 @@ func (p *GetListResMessageBody) String() string {
 	}
 
 	s += " ]\n"
+	s += fmt.Sprintf(" ActGatewayTime = %s\n", stringTime(p.ActGatewayTime))
 	s += "}"
 	return s
 }
 
 type ListEntry struct {
+	receivedEncoding
+
 	ObjName        []byte
 	Status         interface{} `sml:"implicit_choice:uint8:uint16:uint32:uint64,optional"`
-	ValTime        interface{} `sml:"optional"`
-	Unit           uint8       `sml:"optional"`
+	ValTime        *Time       `sml:"optional"`
+	Unit           Unit        `sml:"optional"`
 	Scaler         int8        `sml:"optional"`
 	Value          interface{} `sml:"implicit_choice:bool:octet_string:int8:int16:int32:int64:uint8:uint16:uint32:uint64"`
 	ValueSignature []byte      `sml:"optional"`
@@ -123,52 +211,397 @@ type ListEntry struct {
 func (e *ListEntry) String() string {
 	s := "ListEntry = {\n"
 
-	obis, err := ObisToString(e.ObjName)
+	s += fmt.Sprintf(" ObjName = %s\n", stringObjName(e.ObjName))
+	s += fmt.Sprintf(" Status = %s\n", stringStatus(e.Status))
+	s += fmt.Sprintf(" ValTime = %s\n", stringTime(e.ValTime))
+	s += fmt.Sprintf(" Unit = %s\n", e.Unit)
+	s += fmt.Sprintf(" Scaler = %d\n", e.Scaler)
+	s += fmt.Sprintf(" Value = %s\n", e.stringValue())
+	s += fmt.Sprintf(" ValueSignature = %s\n", hex.EncodeToString(e.ValueSignature))
 
-	if err != nil {
-		obis = hex.EncodeToString(e.ObjName)
+	s += "}"
+	return s
+}
+
+func (e *ListEntry) stringValue() string {
+	return stringValue(e.Value)
+}
+
+// TypedValue returns the value together with the scaler of the entry.
+func (e *ListEntry) TypedValue() Value {
+	return NewValue(e.Value, e.Scaler)
+}
+
+// TypedStatus returns the status word of the entry, if it has been transmitted.
+func (e *ListEntry) TypedStatus() (Status, bool) {
+	return NewStatus(e.Status)
+}
+
+type GetProfilePackResMessageBody struct {
+	ServerId          []byte
+	ActTime           *Time
+	RegPeriod         uint32
+	ParameterTreePath [][]byte
+	HeaderList        []*ProfObjHeaderEntry
+	PeriodList        []*ProfObjPeriodEntry
+	Rawdata           []byte `sml:"optional"`
+	ProfileSignature  []byte `sml:"optional"`
+}
+
+func (p *GetProfilePackResMessageBody) String() string {
+	s := "SML_GetProfilePack.Res = {\n"
+
+	s += fmt.Sprintf(" ServerId = %s\n", stringServerId(p.ServerId))
+	s += fmt.Sprintf(" ActTime = %s\n", stringTime(p.ActTime))
+	s += fmt.Sprintf(" RegPeriod = %d\n", p.RegPeriod)
+	s += fmt.Sprintf(" ParameterTreePath = %s\n", stringTreePath(p.ParameterTreePath))
+
+	s += " HeaderList = [\n"
+
+	for _, h := range p.HeaderList {
+		s += prefixMultilineString(h.String(), "  ") + "\n"
+	}
+
+	s += " ]\n"
+	s += " PeriodList = [\n"
+
+	for _, e := range p.PeriodList {
+		s += prefixMultilineString(e.String(), "  ") + "\n"
+	}
+
+	s += " ]\n"
+	s += fmt.Sprintf(" Rawdata = %s\n", hex.EncodeToString(p.Rawdata))
+	s += fmt.Sprintf(" ProfileSignature = %s\n", hex.EncodeToString(p.ProfileSignature))
+
+	s += "}"
+	return s
+}
+
+type ProfObjHeaderEntry struct {
+	ObjName []byte
+	Unit    Unit
+	Scaler  int8
+}
+
+func (h *ProfObjHeaderEntry) String() string {
+	s := "ProfObjHeaderEntry = {\n"
+
+	s += fmt.Sprintf(" ObjName = %s\n", stringObjName(h.ObjName))
+	s += fmt.Sprintf(" Unit = %s\n", h.Unit)
+	s += fmt.Sprintf(" Scaler = %d\n", h.Scaler)
+
+	s += "}"
+	return s
+}
+
+type ProfObjPeriodEntry struct {
+	ValTime         *Time
+	Status          interface{} `sml:"implicit_choice:uint8:uint16:uint32:uint64"`
+	ValueList       []*ValueEntry
+	PeriodSignature []byte `sml:"optional"`
+}
+
+func (e *ProfObjPeriodEntry) String() string {
+	s := "ProfObjPeriodEntry = {\n"
+
+	s += fmt.Sprintf(" ValTime = %s\n", stringTime(e.ValTime))
+	s += fmt.Sprintf(" Status = %s\n", stringStatus(e.Status))
+	s += " ValueList = [\n"
+
+	for _, v := range e.ValueList {
+		s += prefixMultilineString(v.String(), "  ") + "\n"
+	}
+
+	s += " ]\n"
+	s += fmt.Sprintf(" PeriodSignature = %s\n", hex.EncodeToString(e.PeriodSignature))
+
+	s += "}"
+	return s
+}
+
+// TypedStatus returns the status word of the period entry, if it is an unsigned integer.
+func (e *ProfObjPeriodEntry) TypedStatus() (Status, bool) {
+	return NewStatus(e.Status)
+}
+
+type ValueEntry struct {
+	Value          interface{} `sml:"implicit_choice:bool:octet_string:int8:int16:int32:int64:uint8:uint16:uint32:uint64"`
+	ValueSignature []byte      `sml:"optional"`
+}
+
+func (e *ValueEntry) String() string {
+	s := "ValueEntry = {\n"
+
+	s += fmt.Sprintf(" Value = %s\n", stringValue(e.Value))
+	s += fmt.Sprintf(" ValueSignature = %s\n", hex.EncodeToString(e.ValueSignature))
+
+	s += "}"
+	return s
+}
+
+type GetProfileListResMessageBody struct {
+	ServerId          []byte
+	ActTime           *Time
+	RegPeriod         uint32
+	ParameterTreePath [][]byte
+	ValTime           *Time
+	Status            interface{} `sml:"implicit_choice:uint8:uint16:uint32:uint64"`
+	PeriodList        []*PeriodEntry
+	Rawdata           []byte `sml:"optional"`
+	PeriodSignature   []byte `sml:"optional"`
+}
+
+func (p *GetProfileListResMessageBody) String() string {
+	s := "SML_GetProfileList.Res = {\n"
+
+	s += fmt.Sprintf(" ServerId = %s\n", stringServerId(p.ServerId))
+	s += fmt.Sprintf(" ActTime = %s\n", stringTime(p.ActTime))
+	s += fmt.Sprintf(" RegPeriod = %d\n", p.RegPeriod)
+	s += fmt.Sprintf(" ParameterTreePath = %s\n", stringTreePath(p.ParameterTreePath))
+	s += fmt.Sprintf(" ValTime = %s\n", stringTime(p.ValTime))
+	s += fmt.Sprintf(" Status = %s\n", stringStatus(p.Status))
+
+	s += " PeriodList = [\n"
+
+	for _, e := range p.PeriodList {
+		s += prefixMultilineString(e.String(), "  ") + "\n"
 	}
 
-	s += fmt.Sprintf(" ObjName = %s\n", obis)
-	s += fmt.Sprintf(" Unit = %d\n", e.Unit)
+	s += " ]\n"
+	s += fmt.Sprintf(" Rawdata = %s\n", hex.EncodeToString(p.Rawdata))
+	s += fmt.Sprintf(" PeriodSignature = %s\n", hex.EncodeToString(p.PeriodSignature))
+
+	s += "}"
+	return s
+}
+
+// TypedStatus returns the status word of the period, if it is an unsigned integer.
+func (p *GetProfileListResMessageBody) TypedStatus() (Status, bool) {
+	return NewStatus(p.Status)
+}
+
+type PeriodEntry struct {
+	ObjName        []byte
+	Unit           Unit
+	Scaler         int8
+	Value          interface{} `sml:"implicit_choice:bool:octet_string:int8:int16:int32:int64:uint8:uint16:uint32:uint64"`
+	ValueSignature []byte      `sml:"optional"`
+}
+
+// TypedValue returns the value together with the scaler of the entry.
+func (e *PeriodEntry) TypedValue() Value {
+	return NewValue(e.Value, e.Scaler)
+}
+
+func (e *PeriodEntry) String() string {
+	s := "PeriodEntry = {\n"
+
+	s += fmt.Sprintf(" ObjName = %s\n", stringObjName(e.ObjName))
+	s += fmt.Sprintf(" Unit = %s\n", e.Unit)
 	s += fmt.Sprintf(" Scaler = %d\n", e.Scaler)
-	s += fmt.Sprintf(" Value = %s\n", e.stringValue())
+	s += fmt.Sprintf(" Value = %s\n", stringValue(e.Value))
 	s += fmt.Sprintf(" ValueSignature = %s\n", hex.EncodeToString(e.ValueSignature))
 
 	s += "}"
 	return s
 }
 
-func (e *ListEntry) stringValue() string {
-	if e.Value == nil {
-		return "null"
-	} else if v, ok := e.Value.(*string); ok {
-		return "(string) " + *v
-	} else if v, ok := e.Value.(*bool); ok {
-		if *v {
-			return "(bool) True"
-		} else {
-			return "(bool) False"
+func stringObjName(objName []byte) string {
+	obis, err := ObisFromBytes(objName)
+
+	if err != nil {
+		return hex.EncodeToString(objName)
+	}
+
+	if name := obis.Name(); name != "" {
+		return fmt.Sprintf("%s (%s)", obis, name)
+	}
+
+	return obis.String()
+}
+
+func stringTreePath(path [][]byte) string {
+	s := "["
+
+	for i, p := range path {
+		if i != 0 {
+			s += ", "
 		}
-	} else if v, ok := e.Value.([]byte); ok {
-		return "(octet string) " + hex.EncodeToString(v)
-	} else if v, ok := e.Value.(*uint8); ok {
-		return "(uint8) " + fmt.Sprintf("%d", *v)
-	} else if v, ok := e.Value.(*uint16); ok {
-		return "(uint16) " + fmt.Sprintf("%d", *v)
-	} else if v, ok := e.Value.(*uint32); ok {
-		return "(uint32) " + fmt.Sprintf("%d", *v)
-	} else if v, ok := e.Value.(*uint64); ok {
-		return "(uint64) " + fmt.Sprintf("%d", *v)
-	} else if v, ok := e.Value.(*int8); ok {
-		return "(int8) " + fmt.Sprintf("%d", *v)
-	} else if v, ok := e.Value.(*int16); ok {
-		return "(int16) " + fmt.Sprintf("%d", *v)
-	} else if v, ok := e.Value.(*int32); ok {
-		return "(int32) " + fmt.Sprintf("%d", *v)
-	} else if v, ok := e.Value.(*int64); ok {
-		return "(int64) " + fmt.Sprintf("%d", *v)
-	}
-
-	return fmt.Sprintf("(unknown) %s", e.Value)
+
+		s += stringObjName(p)
+	}
+
+	return s + "]"
+}
+
+func stringValue(value interface{}) string {
+	v := NewValue(value, 0)
+
+	// Absent optional fields are nil pointers
+	if r := reflect.ValueOf(value); r.Kind() == reflect.Pointer && r.IsNil() {
+		return v.String()
+	}
+
+	if v.Kind() == ValueKindNone && value != nil {
+		return fmt.Sprintf("(unknown) %v", value)
+	}
+
+	return v.String()
+}
+
+type GetProcParameterResMessageBody struct {
+	ServerId          []byte
+	ParameterTreePath [][]byte
+	ParameterTree     *Tree
+}
+
+func (p *GetProcParameterResMessageBody) String() string {
+	s := "SML_GetProcParameter.Res = {\n"
+
+	s += fmt.Sprintf(" ServerId = %s\n", stringServerId(p.ServerId))
+	s += fmt.Sprintf(" ParameterTreePath = %s\n", stringTreePath(p.ParameterTreePath))
+	s += fmt.Sprintf(" ParameterTree = {\n%s\n }\n", prefixMultilineString(p.ParameterTree.String(), "  "))
+
+	s += "}"
+	return s
+}
+
+type Tree struct {
+	ParameterName  []byte
+	ParameterValue *ProcParValue `sml:"optional"`
+	ChildList      []*Tree       `sml:"optional"`
+}
+
+func (t *Tree) String() string {
+	s := "Tree = {\n"
+
+	s += fmt.Sprintf(" ParameterName = %s\n", stringObjName(t.ParameterName))
+
+	if t.ParameterValue != nil {
+		s += fmt.Sprintf(" ParameterValue = {\n%s\n }\n", prefixMultilineString(t.ParameterValue.String(), "  "))
+	}
+
+	if t.ChildList != nil {
+		s += " ChildList = [\n"
+
+		for _, c := range t.ChildList {
+			s += prefixMultilineString(c.String(), "  ") + "\n"
+		}
+
+		s += " ]\n"
+	}
+
+	s += "}"
+	return s
+}
+
+type ProcParValue struct {
+	Value       interface{}  `sml:"tag:0x01,implicit_choice:bool:octet_string:int8:int16:int32:int64:uint8:uint16:uint32:uint64"`
+	PeriodEntry *PeriodEntry `sml:"tag:0x02"`
+	TupelEntry  *TupelEntry  `sml:"tag:0x03"`
+	Time        *Time        `sml:"tag:0x04"`
+}
+
+func (p *ProcParValue) String() string {
+	if p.PeriodEntry != nil {
+		return p.PeriodEntry.String()
+	} else if p.TupelEntry != nil {
+		return p.TupelEntry.String()
+	} else if p.Time != nil {
+		return fmt.Sprintf("Time = %s", p.Time)
+	}
+
+	return fmt.Sprintf("Value = %s", stringValue(p.Value))
+}
+
+type TupelEntry struct {
+	ServerId        []byte
+	SecIndex        *Time
+	Status          interface{} `sml:"implicit_choice:uint8:uint16:uint32:uint64"`
+	UnitPA          Unit
+	ScalerPA        int8
+	ValuePA         int64
+	UnitR1          Unit
+	ScalerR1        int8
+	ValueR1         int64
+	UnitR4          Unit
+	ScalerR4        int8
+	ValueR4         int64
+	SignaturePAR1R4 []byte
+	UnitMA          Unit
+	ScalerMA        int8
+	ValueMA         int64
+	UnitR2          Unit
+	ScalerR2        int8
+	ValueR2         int64
+	UnitR3          Unit
+	ScalerR3        int8
+	ValueR3         int64
+	SignatureMAR2R3 []byte
+}
+
+func (e *TupelEntry) String() string {
+	s := "TupelEntry = {\n"
+
+	s += fmt.Sprintf(" ServerId = %s\n", stringServerId(e.ServerId))
+	s += fmt.Sprintf(" SecIndex = %s\n", stringTime(e.SecIndex))
+	s += fmt.Sprintf(" Status = %s\n", stringStatus(e.Status))
+	s += fmt.Sprintf(" +A = %d * 10^%d (unit %s)\n", e.ValuePA, e.ScalerPA, e.UnitPA)
+	s += fmt.Sprintf(" +R1 = %d * 10^%d (unit %s)\n", e.ValueR1, e.ScalerR1, e.UnitR1)
+	s += fmt.Sprintf(" +R4 = %d * 10^%d (unit %s)\n", e.ValueR4, e.ScalerR4, e.UnitR4)
+	s += fmt.Sprintf(" Signature(+A, +R1, +R4) = %s\n", hex.EncodeToString(e.SignaturePAR1R4))
+	s += fmt.Sprintf(" -A = %d * 10^%d (unit %s)\n", e.ValueMA, e.ScalerMA, e.UnitMA)
+	s += fmt.Sprintf(" -R2 = %d * 10^%d (unit %s)\n", e.ValueR2, e.ScalerR2, e.UnitR2)
+	s += fmt.Sprintf(" -R3 = %d * 10^%d (unit %s)\n", e.ValueR3, e.ScalerR3, e.UnitR3)
+	s += fmt.Sprintf(" Signature(-A, -R2, -R3) = %s\n", hex.EncodeToString(e.SignatureMAR2R3))
+
+	s += "}"
+	return s
+}
+
+// TypedStatus returns the status word of the tupel entry, if it is an unsigned integer.
+func (e *TupelEntry) TypedStatus() (Status, bool) {
+	return NewStatus(e.Status)
+}
+
+type AttentionResMessageBody struct {
+	ServerId         []byte
+	AttentionNo      []byte
+	AttentionMsg     []byte `sml:"optional"`
+	AttentionDetails *Tree  `sml:"optional"`
+}
+
+func (p *AttentionResMessageBody) String() string {
+	s := "SML_Attention.Res = {\n"
+
+	s += fmt.Sprintf(" ServerId = %s\n", stringServerId(p.ServerId))
+
+	if name, ok := AttentionName(p.AttentionNo); ok {
+		s += fmt.Sprintf(" AttentionNo = %s (%s)\n", hex.EncodeToString(p.AttentionNo), name)
+	} else {
+		s += fmt.Sprintf(" AttentionNo = %s\n", hex.EncodeToString(p.AttentionNo))
+	}
+
+	s += fmt.Sprintf(" AttentionMsg = %q\n", string(p.AttentionMsg))
+
+	if p.AttentionDetails != nil {
+		s += fmt.Sprintf(" AttentionDetails = {\n%s\n }\n", prefixMultilineString(p.AttentionDetails.String(), "  "))
+	}
+
+	s += "}"
+	return s
+}
+
+// Err returns an *AttentionError when the attention number signals an error, nil for acknowledgements.
+func (p *AttentionResMessageBody) Err() error {
+	if !isAttentionError(p.AttentionNo) {
+		return nil
+	}
+
+	return &AttentionError{
+		ServerId:    p.ServerId,
+		AttentionNo: p.AttentionNo,
+		Message:     p.AttentionMsg,
+		Details:     p.AttentionDetails,
+	}
 }
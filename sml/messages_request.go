@@ -0,0 +1,165 @@
+package sml
+
+import (
+	"encoding/hex"
+	"fmt"
+)
+
+type PublicOpenReqMessageBody struct {
+	Codepage   []byte `sml:"optional"`
+	ClientId   []byte
+	ReqFileId  []byte
+	ServerId   []byte `sml:"optional"`
+	Username   []byte `sml:"optional"`
+	Password   []byte `sml:"optional"`
+	SmlVersion uint8  `sml:"optional"`
+}
+
+func (p *PublicOpenReqMessageBody) String() string {
+	s := "SML_PublicOpen.Req = {\n"
+
+	s += fmt.Sprintf(" Codepage = %s\n", hex.EncodeToString(p.Codepage))
+	s += fmt.Sprintf(" ClientId = %s\n", hex.EncodeToString(p.ClientId))
+	s += fmt.Sprintf(" ReqFileId = %s\n", hex.EncodeToString(p.ReqFileId))
+	s += fmt.Sprintf(" ServerId = %s\n", stringServerId(p.ServerId))
+	s += stringCredentials(p.Username, p.Password)
+	s += fmt.Sprintf(" SmlVersion = %02x\n", p.SmlVersion)
+
+	s += "}"
+	return s
+}
+
+type PublicCloseReqMessageBody struct {
+	GlobalSignature []byte `sml:"optional"`
+}
+
+func (p *PublicCloseReqMessageBody) String() string {
+	s := "SML_PublicClose.Req = {\n"
+	s += fmt.Sprintf(" GlobalSignature = %s\n", hex.EncodeToString(p.GlobalSignature))
+	s += "}"
+	return s
+}
+
+type GetProfilePackReqMessageBody struct {
+	ServerId          []byte `sml:"optional"`
+	Username          []byte `sml:"optional"`
+	Password          []byte `sml:"optional"`
+	WithRawdata       bool   `sml:"optional"`
+	BeginTime         *Time  `sml:"optional"`
+	EndTime           *Time  `sml:"optional"`
+	ParameterTreePath [][]byte
+	ObjectList        [][]byte `sml:"optional"`
+	DasDetails        *Tree    `sml:"optional"`
+}
+
+func (p *GetProfilePackReqMessageBody) String() string {
+	return "SML_GetProfilePack.Req = " + stringProfileReq(p.ServerId, p.Username, p.Password, p.WithRawdata, p.BeginTime, p.EndTime, p.ParameterTreePath, p.ObjectList, p.DasDetails)
+}
+
+type GetProfileListReqMessageBody struct {
+	ServerId          []byte `sml:"optional"`
+	Username          []byte `sml:"optional"`
+	Password          []byte `sml:"optional"`
+	WithRawdata       bool   `sml:"optional"`
+	BeginTime         *Time  `sml:"optional"`
+	EndTime           *Time  `sml:"optional"`
+	ParameterTreePath [][]byte
+	ObjectList        [][]byte `sml:"optional"`
+	DasDetails        *Tree    `sml:"optional"`
+}
+
+func (p *GetProfileListReqMessageBody) String() string {
+	return "SML_GetProfileList.Req = " + stringProfileReq(p.ServerId, p.Username, p.Password, p.WithRawdata, p.BeginTime, p.EndTime, p.ParameterTreePath, p.ObjectList, p.DasDetails)
+}
+
+type GetProcParameterReqMessageBody struct {
+	ServerId          []byte `sml:"optional"`
+	Username          []byte `sml:"optional"`
+	Password          []byte `sml:"optional"`
+	ParameterTreePath [][]byte
+	Attribute         []byte `sml:"optional"`
+}
+
+func (p *GetProcParameterReqMessageBody) String() string {
+	s := "SML_GetProcParameter.Req = {\n"
+
+	s += fmt.Sprintf(" ServerId = %s\n", stringServerId(p.ServerId))
+	s += stringCredentials(p.Username, p.Password)
+	s += fmt.Sprintf(" ParameterTreePath = %s\n", stringTreePath(p.ParameterTreePath))
+	s += fmt.Sprintf(" Attribute = %s\n", hex.EncodeToString(p.Attribute))
+
+	s += "}"
+	return s
+}
+
+type SetProcParameterReqMessageBody struct {
+	ServerId          []byte `sml:"optional"`
+	Username          []byte `sml:"optional"`
+	Password          []byte `sml:"optional"`
+	ParameterTreePath [][]byte
+	ParameterTree     *Tree
+}
+
+func (p *SetProcParameterReqMessageBody) String() string {
+	s := "SML_SetProcParameter.Req = {\n"
+
+	s += fmt.Sprintf(" ServerId = %s\n", stringServerId(p.ServerId))
+	s += stringCredentials(p.Username, p.Password)
+	s += fmt.Sprintf(" ParameterTreePath = %s\n", stringTreePath(p.ParameterTreePath))
+	s += fmt.Sprintf(" ParameterTree = {\n%s\n }\n", prefixMultilineString(p.ParameterTree.String(), "  "))
+
+	s += "}"
+	return s
+}
+
+type GetListReqMessageBody struct {
+	ClientId []byte
+	ServerId []byte `sml:"optional"`
+	Username []byte `sml:"optional"`
+	Password []byte `sml:"optional"`
+	ListName []byte `sml:"optional"`
+}
+
+func (p *GetListReqMessageBody) String() string {
+	s := "SML_GetList.Req = {\n"
+
+	s += fmt.Sprintf(" ClientId = %s\n", hex.EncodeToString(p.ClientId))
+	s += fmt.Sprintf(" ServerId = %s\n", stringServerId(p.ServerId))
+	s += stringCredentials(p.Username, p.Password)
+	s += fmt.Sprintf(" ListName = %s\n", hex.EncodeToString(p.ListName))
+
+	s += "}"
+	return s
+}
+
+func stringProfileReq(serverId []byte, username []byte, password []byte, withRawdata bool, beginTime *Time, endTime *Time, parameterTreePath [][]byte, objectList [][]byte, dasDetails *Tree) string {
+	s := "{\n"
+
+	s += fmt.Sprintf(" ServerId = %s\n", stringServerId(serverId))
+	s += stringCredentials(username, password)
+	s += fmt.Sprintf(" WithRawdata = %t\n", withRawdata)
+	s += fmt.Sprintf(" BeginTime = %s\n", stringTime(beginTime))
+	s += fmt.Sprintf(" EndTime = %s\n", stringTime(endTime))
+	s += fmt.Sprintf(" ParameterTreePath = %s\n", stringTreePath(parameterTreePath))
+	s += fmt.Sprintf(" ObjectList = %s\n", stringTreePath(objectList))
+
+	if dasDetails != nil {
+		s += fmt.Sprintf(" DasDetails = {\n%s\n }\n", prefixMultilineString(dasDetails.String(), "  "))
+	}
+
+	s += "}"
+	return s
+}
+
+// stringCredentials prints the username, but never the password sniffed from the bus.
+func stringCredentials(username []byte, password []byte) string {
+	s := fmt.Sprintf(" Username = %q\n", string(username))
+
+	if len(password) != 0 {
+		s += " Password = <redacted>\n"
+	} else {
+		s += " Password = \n"
+	}
+
+	return s
+}
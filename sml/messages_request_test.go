@@ -0,0 +1,117 @@
+package sml
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDecodeRequests(t *testing.T) {
+	serverId := []byte{0x0a, 0x01, 0x45, 0x4d, 0x48, 0x00, 0x00, 0x7f, 0x9e, 0x31}
+	beginTime := uint32(1700000000)
+
+	tests := []struct {
+		name    string
+		encoded string
+		want    MessageBody
+		// Lines the output of String() must contain
+		lines []string
+	}{
+		{
+			name:    "SML_PublicOpen.Req",
+			encoded: "77 01 07 0500b1c2d100 05 00b1c2d2 0b 0a01454d4800007f9e31 05 61646d69 05 31323334 62 01",
+			want: &PublicOpenReqMessageBody{
+				ClientId:   []byte{0x05, 0x00, 0xb1, 0xc2, 0xd1, 0x00},
+				ReqFileId:  []byte{0x00, 0xb1, 0xc2, 0xd2},
+				ServerId:   serverId,
+				Username:   []byte("admi"),
+				Password:   []byte("1234"),
+				SmlVersion: 1,
+			},
+			lines: []string{" ServerId = 0a01454d4800007f9e31 (1EMH0008363569)\n", " Password = <redacted>\n"},
+		},
+		{
+			name:    "SML_GetList.Req",
+			encoded: "75 07 0500b1c2d100 0b 0a01454d4800007f9e31 01 01 07 0100620affff",
+			want: &GetListReqMessageBody{
+				ClientId: []byte{0x05, 0x00, 0xb1, 0xc2, 0xd1, 0x00},
+				ServerId: serverId,
+				ListName: []byte{0x01, 0x00, 0x62, 0x0a, 0xff, 0xff},
+			},
+			lines: []string{" Password = \n", " ListName = 0100620affff\n"},
+		},
+		{
+			name:    "SML_GetProcParameter.Req",
+			encoded: "75 0b 0a01454d4800007f9e31 01 01 72 07 8181c78201ff 07 0100000009ff 01",
+			want: &GetProcParameterReqMessageBody{
+				ServerId:          serverId,
+				ParameterTreePath: [][]byte{{0x81, 0x81, 0xc7, 0x82, 0x01, 0xff}, {0x01, 0x00, 0x00, 0x00, 0x09, 0xff}},
+			},
+			lines: []string{" ParameterTreePath = [129-129:199.130.1*255, 1-0:0.0.9*255 (Device ID)]\n"},
+		},
+		{
+			name:    "SML_GetProfileList.Req",
+			encoded: "79 0b 0a01454d4800007f9e31 01 01 42 01 72 6202 65 6553f100 01 71 07 0100630100ff 01 01",
+			want: &GetProfileListReqMessageBody{
+				ServerId:          serverId,
+				WithRawdata:       true,
+				BeginTime:         &Time{Timestamp: &beginTime},
+				ParameterTreePath: [][]byte{{0x01, 0x00, 0x63, 0x01, 0x00, 0xff}},
+			},
+			lines: []string{" ServerId = 0a01454d4800007f9e31 (1EMH0008363569)\n", " WithRawdata = true\n"},
+		},
+		{
+			name:    "SML_PublicClose.Req",
+			encoded: "71 01",
+			want:    &PublicCloseReqMessageBody{},
+			lines:   []string{" GlobalSignature = \n"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := reflect.New(reflect.TypeOf(tt.want).Elem()).Interface().(MessageBody)
+
+			if err := decodeHex(t, tt.encoded, got); err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("decoded\n%v\nwant\n%v", got, tt.want)
+			}
+
+			for _, line := range tt.lines {
+				if !strings.Contains(got.String(), line) {
+					t.Errorf("String() does not contain %q:\n%s", line, got)
+				}
+			}
+		})
+	}
+}
+
+func TestReadRequestFile(t *testing.T) {
+	var payload []byte
+
+	// A gateway requesting the values of a meter on the bus
+	payload = append(payload, capturedMessage(t,
+		"05 00b1c2d1 6200 6200 72 630100 77 01 07 0500b1c2d100 05 00b1c2d2 0b 0a01454d4800007f9e31 01 01 01")...)
+	payload = append(payload, capturedMessage(t,
+		"05 00b1c2d3 6200 6200 72 630700 75 07 0500b1c2d100 0b 0a01454d4800007f9e31 01 01 07 0100620affff")...)
+	payload = append(payload, capturedMessage(t,
+		"05 00b1c2d4 6200 6200 72 630200 71 01")...)
+
+	file, err := NewReader(bytes.NewReader(fuzzFrame(payload))).ReadFile()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !file.IsRequest() {
+		t.Error("IsRequest() = false, want true")
+	}
+
+	if _, ok := file.Messages[1].MessageBody.(*GetListReqMessageBody); !ok {
+		t.Errorf("MessageBody = %T, want *GetListReqMessageBody", file.Messages[1].MessageBody)
+	}
+}
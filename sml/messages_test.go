@@ -0,0 +1,169 @@
+package sml
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDecodeGetProfilePackRes(t *testing.T) {
+	// A load profile of two energy registers with a single period, the values are 8 byte integers
+	encoded := "78 0b 0a01454d4800007f9e31 72 6201 65 00bc614e 65 00000384 71 07 0100630100ff" +
+		" 72 73 07 0100010800ff 621e 52ff 73 07 0100020800ff 621e 52ff" +
+		" 71 74 72 6201 65 00bc5f40 6208 72 72 59 0000000000001234 01 72 59 0000000000000017 01 01" +
+		" 01 01"
+
+	actTime := uint32(12345678)
+	valTime := uint32(12345152)
+	status := uint8(0x08)
+	energyIn := int64(0x1234)
+	energyOut := int64(0x17)
+
+	want := &GetProfilePackResMessageBody{
+		ServerId:          []byte{0x0a, 0x01, 0x45, 0x4d, 0x48, 0x00, 0x00, 0x7f, 0x9e, 0x31},
+		ActTime:           &Time{SecIndex: &actTime},
+		RegPeriod:         900,
+		ParameterTreePath: [][]byte{{0x01, 0x00, 0x63, 0x01, 0x00, 0xff}},
+		HeaderList: []*ProfObjHeaderEntry{
+			{ObjName: []byte{0x01, 0x00, 0x01, 0x08, 0x00, 0xff}, Unit: UnitWattHour, Scaler: -1},
+			{ObjName: []byte{0x01, 0x00, 0x02, 0x08, 0x00, 0xff}, Unit: UnitWattHour, Scaler: -1},
+		},
+		PeriodList: []*ProfObjPeriodEntry{
+			{
+				ValTime:   &Time{SecIndex: &valTime},
+				Status:    &status,
+				ValueList: []*ValueEntry{{Value: &energyIn}, {Value: &energyOut}},
+			},
+		},
+	}
+
+	got := &GetProfilePackResMessageBody{}
+
+	if err := decodeHex(t, encoded, got); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("decoded\n%v\nwant\n%v", got, want)
+	}
+
+	for _, line := range []string{
+		" ParameterTreePath = [1-0:99.1.0*255",
+		" RegPeriod = 900\n",
+		"  ObjName = 1-0:2.8.0*255",
+		"   Value = (int64) 4660\n",
+	} {
+		if !strings.Contains(got.String(), line) {
+			t.Errorf("String() does not contain %q:\n%s", line, got)
+		}
+	}
+}
+
+func TestDecodeGetProfileListRes(t *testing.T) {
+	// A single period of the energy import register, the period entries carry their unit and scaler
+	encoded := "79 0b 0a01454d4800007f9e31 72 6202 65 6553f100 65 00000384 71 07 0100630100ff" +
+		" 72 6201 65 00bc5f40 6208" +
+		" 71 75 07 0100010800ff 621e 52ff 59 0000000000001234 01" +
+		" 01 01"
+
+	actTime := uint32(1700000000)
+	valTime := uint32(12345152)
+	status := uint8(0x08)
+	energyIn := int64(0x1234)
+
+	want := &GetProfileListResMessageBody{
+		ServerId:          []byte{0x0a, 0x01, 0x45, 0x4d, 0x48, 0x00, 0x00, 0x7f, 0x9e, 0x31},
+		ActTime:           &Time{Timestamp: &actTime},
+		RegPeriod:         900,
+		ParameterTreePath: [][]byte{{0x01, 0x00, 0x63, 0x01, 0x00, 0xff}},
+		ValTime:           &Time{SecIndex: &valTime},
+		Status:            &status,
+		PeriodList: []*PeriodEntry{
+			{ObjName: []byte{0x01, 0x00, 0x01, 0x08, 0x00, 0xff}, Unit: UnitWattHour, Scaler: -1, Value: &energyIn},
+		},
+	}
+
+	got := &GetProfileListResMessageBody{}
+
+	if err := decodeHex(t, encoded, got); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("decoded\n%v\nwant\n%v", got, want)
+	}
+
+	if scaled, _ := got.PeriodList[0].TypedValue().Scaled(); scaled.RatString() != "466" {
+		t.Errorf("Scaled() = %s, want 466", scaled)
+	}
+
+	if !strings.Contains(got.String(), " ActTime = (timestamp) 2023-11-14T22:13:20Z\n") {
+		t.Errorf("String() does not contain the act time:\n%s", got)
+	}
+}
+
+func TestDecodeGetProcParameterRes(t *testing.T) {
+	// The tree contains a value, a time and a nested period entry
+	encoded := "73 0b 0a01454d4800007f9e31 71 07 8181c78201ff" +
+		" 73 07 8181c78201ff 01 73" +
+		"  73 07 0100000009ff 72 6201 0b 0a01454d4800007f9e31 01" +
+		"  73 07 0100000102ff 72 6204 72 6202 65 6553f100 01" +
+		"  73 03 0102 01 71" +
+		"   73 07 0100010800ff 72 6202 75 07 0100010800ff 621e 52ff 59 0000000000001234 01 01"
+
+	serverId := []byte{0x0a, 0x01, 0x45, 0x4d, 0x48, 0x00, 0x00, 0x7f, 0x9e, 0x31}
+	timestamp := uint32(1700000000)
+	energyIn := int64(0x1234)
+
+	want := &GetProcParameterResMessageBody{
+		ServerId:          serverId,
+		ParameterTreePath: [][]byte{{0x81, 0x81, 0xc7, 0x82, 0x01, 0xff}},
+		ParameterTree: &Tree{
+			ParameterName: []byte{0x81, 0x81, 0xc7, 0x82, 0x01, 0xff},
+			ChildList: []*Tree{
+				{
+					ParameterName:  []byte{0x01, 0x00, 0x00, 0x00, 0x09, 0xff},
+					ParameterValue: &ProcParValue{Value: serverId},
+				},
+				{
+					ParameterName:  []byte{0x01, 0x00, 0x00, 0x01, 0x02, 0xff},
+					ParameterValue: &ProcParValue{Time: &Time{Timestamp: &timestamp}},
+				},
+				{
+					ParameterName: []byte{0x01, 0x02},
+					ChildList: []*Tree{
+						{
+							ParameterName: []byte{0x01, 0x00, 0x01, 0x08, 0x00, 0xff},
+							ParameterValue: &ProcParValue{PeriodEntry: &PeriodEntry{
+								ObjName: []byte{0x01, 0x00, 0x01, 0x08, 0x00, 0xff},
+								Unit:    UnitWattHour,
+								Scaler:  -1,
+								Value:   &energyIn,
+							}},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	got := &GetProcParameterResMessageBody{}
+
+	if err := decodeHex(t, encoded, got); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("decoded\n%v\nwant\n%v", got, want)
+	}
+
+	for _, line := range []string{
+		"Value = (octet string) 0a01454d4800007f9e31\n",
+		"Time = (timestamp) 2023-11-14T22:13:20Z\n",
+		"ObjName = 1-0:1.8.0*255 (Energy import)\n",
+	} {
+		if !strings.Contains(got.String(), line) {
+			t.Errorf("String() does not contain %q:\n%s", line, got)
+		}
+	}
+}
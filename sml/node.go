@@ -0,0 +1,166 @@
+package sml
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+// Node is an element of a token tree, which represents SML data that is not known to the decoder.
+// It is one of *OctetStringNode, *BoolNode, *IntegerNode and *ListNode.
+type Node interface {
+	fmt.Stringer
+
+	// token converts the node back for encoding
+	token() (smlToken, error)
+}
+
+// OctetStringNode is an octet string. Absent optional values are empty octet strings as well.
+type OctetStringNode struct {
+	Value []byte
+}
+
+func (n *OctetStringNode) String() string {
+	return "(octet string) " + hex.EncodeToString(n.Value)
+}
+
+func (n *OctetStringNode) token() (smlToken, error) {
+	return &smlOctetString{value: n.Value}, nil
+}
+
+// BoolNode is a boolean.
+type BoolNode struct {
+	Value bool
+}
+
+func (n *BoolNode) String() string {
+	return NewValue(n.Value, 0).String()
+}
+
+func (n *BoolNode) token() (smlToken, error) {
+	return &smlBoolean{value: n.Value}, nil
+}
+
+// IntegerNode is a signed or unsigned integer. The kind of the value is the type it was transmitted as.
+type IntegerNode struct {
+	Value Value
+}
+
+func (n *IntegerNode) String() string {
+	return n.Value.String()
+}
+
+func (n *IntegerNode) token() (smlToken, error) {
+	bits := n.Value.bits
+
+	switch n.Value.kind {
+	case ValueKindInt8:
+		return &smlSigned8{value: int8(bits)}, nil
+	case ValueKindInt16:
+		return &smlSigned16{value: int16(bits)}, nil
+	case ValueKindInt32:
+		return &smlSigned32{value: int32(bits)}, nil
+	case ValueKindInt64:
+		return &smlSigned64{value: int64(bits)}, nil
+	case ValueKindUint8:
+		return &smlUnsigned8{value: uint8(bits)}, nil
+	case ValueKindUint16:
+		return &smlUnsigned16{value: uint16(bits)}, nil
+	case ValueKindUint32:
+		return &smlUnsigned32{value: uint32(bits)}, nil
+	case ValueKindUint64:
+		return &smlUnsigned64{value: bits}, nil
+	default:
+		return nil, fmt.Errorf("integer node must not contain a value of kind %s", n.Value.kind)
+	}
+}
+
+// ListNode is a list of nodes.
+type ListNode struct {
+	Elements []Node
+}
+
+func (n *ListNode) String() string {
+	if len(n.Elements) == 0 {
+		return "[]"
+	}
+
+	s := "[\n"
+
+	for _, e := range n.Elements {
+		s += prefixMultilineString(e.String(), " ") + "\n"
+	}
+
+	s += "]"
+	return s
+}
+
+func (n *ListNode) token() (smlToken, error) {
+	list := &smlList{
+		value: make([]smlToken, len(n.Elements)),
+	}
+
+	for i, e := range n.Elements {
+		if e == nil {
+			return nil, errors.New("list node must not contain nil elements")
+		}
+
+		token, err := e.token()
+
+		if err != nil {
+			return nil, err
+		}
+
+		list.value[i] = token
+	}
+
+	return list, nil
+}
+
+// newNode converts a token into a node. Octet strings are copied, as the tokens are reused by the reader.
+func newNode(token smlToken) (Node, error) {
+	var integer interface{}
+
+	switch t := token.(type) {
+	case *smlOctetString:
+		return &OctetStringNode{Value: append([]byte{}, t.value...)}, nil
+	case *smlBoolean:
+		return &BoolNode{Value: t.value}, nil
+	case *smlList:
+		n := &ListNode{
+			Elements: make([]Node, len(t.value)),
+		}
+
+		for i, element := range t.value {
+			e, err := newNode(element)
+
+			if err != nil {
+				return nil, err
+			}
+
+			n.Elements[i] = e
+		}
+
+		return n, nil
+	case *smlSigned8:
+		integer = t.value
+	case *smlSigned16:
+		integer = t.value
+	case *smlSigned32:
+		integer = t.value
+	case *smlSigned64:
+		integer = t.value
+	case *smlUnsigned8:
+		integer = t.value
+	case *smlUnsigned16:
+		integer = t.value
+	case *smlUnsigned32:
+		integer = t.value
+	case *smlUnsigned64:
+		integer = t.value
+	default:
+		return nil, newInvalidMessage(ErrInvalidToken, "unexpected token %T", token)
+	}
+
+	return &IntegerNode{Value: NewValue(integer, 0)}, nil
+}
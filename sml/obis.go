@@ -1,14 +1,275 @@
 package sml
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
+	"strconv"
+	"strings"
+	"sync"
 )
 
-func ObisToString(val []byte) (string, error) {
+// Obis is an OBIS code identifying a value, consisting of the groups A to F.
+type Obis [6]byte
+
+// ObisFromBytes converts an object name like ListEntry.ObjName.
+func ObisFromBytes(val []byte) (Obis, error) {
+	var o Obis
+
 	if len(val) != 6 {
-		return "", errors.New("OBIS values must consist of 6 bytes")
+		return o, errors.New("OBIS values must consist of 6 bytes")
+	}
+
+	copy(o[:], val)
+	return o, nil
+}
+
+func ObisToString(val []byte) (string, error) {
+	o, err := ObisFromBytes(val)
+
+	if err != nil {
+		return "", err
+	}
+
+	return o.String(), nil
+}
+
+// ParseObis parses an OBIS code like 1-0:16.7.0*255.
+// The short form 16.7.0 refers to electricity (1-0) and the current value (*255). Group F may be omitted in
+// the long form as well and can also be separated with a '&'.
+func ParseObis(s string) (Obis, error) {
+	groups, present, err := parseObisGroups(s, false)
+
+	if err != nil {
+		return Obis{}, err
+	}
+
+	defaults := [6]int{1, 0, 0, 0, 0, 255}
+	var o Obis
+
+	for i := range o {
+		if present[i] {
+			o[i] = byte(groups[i])
+		} else {
+			o[i] = byte(defaults[i])
+		}
+	}
+
+	return o, nil
+}
+
+func (o Obis) String() string {
+	return fmt.Sprintf("%d-%d:%d.%d.%d*%d", o[0], o[1], o[2], o[3], o[4], o[5])
+}
+
+// Bytes returns the object name as it is transmitted.
+func (o Obis) Bytes() []byte {
+	return o[:]
+}
+
+// Compare orders OBIS codes by their groups from A to F. The result is -1, 0 or 1 like bytes.Compare.
+func (o Obis) Compare(other Obis) int {
+	return bytes.Compare(o[:], other[:])
+}
+
+// Less reports whether the code is ordered before the other one.
+func (o Obis) Less(other Obis) bool {
+	return o.Compare(other) < 0
+}
+
+// Info returns the name and description of well-known and registered codes.
+func (o Obis) Info() (ObisInfo, bool) {
+	obisRegistryLock.RLock()
+	defer obisRegistryLock.RUnlock()
+
+	info, ok := obisRegistry[o]
+	return info, ok
+}
+
+// Name returns the name of a well-known or registered code, or an empty string.
+func (o Obis) Name() string {
+	info, _ := o.Info()
+	return info.Name
+}
+
+// ObisPattern matches OBIS codes, where every group is either a value or a wildcard.
+type ObisPattern struct {
+	values   Obis
+	wildcard [6]bool
+}
+
+// ParseObisPattern parses a pattern like 1-0:*.8.* using the syntax of ParseObis.
+// A '*' matches any value of a group. Omitted groups match any value as well, so 1.8.* matches all
+// tariffs of the imported energy for all media and storages.
+func ParseObisPattern(s string) (ObisPattern, error) {
+	groups, present, err := parseObisGroups(s, true)
+
+	if err != nil {
+		return ObisPattern{}, err
+	}
+
+	var p ObisPattern
+
+	for i := range groups {
+		if !present[i] || groups[i] < 0 {
+			p.wildcard[i] = true
+		} else {
+			p.values[i] = byte(groups[i])
+		}
+	}
+
+	return p, nil
+}
+
+// Match reports whether the code matches all groups of the pattern.
+func (p ObisPattern) Match(o Obis) bool {
+	for i := range o {
+		if !p.wildcard[i] && p.values[i] != o[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (p ObisPattern) String() string {
+	groups := make([]interface{}, len(p.values))
+
+	for i := range groups {
+		if p.wildcard[i] {
+			groups[i] = "*"
+		} else {
+			groups[i] = p.values[i]
+		}
+	}
+
+	return fmt.Sprintf("%v-%v:%v.%v.%v*%v", groups...)
+}
+
+// parseObisGroups parses the groups of an OBIS code. Wildcards are returned as -1.
+func parseObisGroups(s string, allowWildcard bool) (groups [6]int, present [6]bool, err error) {
+	rest := s
+
+	parseGroup := func(i int, v string) error {
+		if v == "*" && allowWildcard {
+			groups[i] = -1
+		} else {
+			n, err := strconv.ParseUint(v, 10, 8)
+
+			if err != nil {
+				return fmt.Errorf("invalid OBIS code %q: group %c must be a number from 0 to 255", s, 'A'+i)
+			}
+
+			groups[i] = int(n)
+		}
+
+		present[i] = true
+		return nil
+	}
+
+	if i := strings.IndexByte(rest, ':'); i >= 0 {
+		medium := strings.Split(rest[:i], "-")
+
+		if len(medium) != 2 {
+			err = fmt.Errorf("invalid OBIS code %q: expected groups A-B before ':'", s)
+			return
+		}
+
+		for j, v := range medium {
+			if err = parseGroup(j, v); err != nil {
+				return
+			}
+		}
+
+		rest = rest[i+1:]
 	}
 
-	return fmt.Sprintf("%d-%d:%d.%d.%d*%d", val[0], val[1], val[2], val[3], val[4], val[5]), nil
+	value := strings.Split(rest, ".")
+
+	if len(value) != 3 {
+		err = fmt.Errorf("invalid OBIS code %q: expected groups C.D.E", s)
+		return
+	}
+
+	// Group E may be followed by group F separated by '*' or '&', while group E itself may be a wildcard
+	e := value[2]
+	f := ""
+	hasF := false
+
+	if strings.HasPrefix(e, "*") && len(e) > 1 {
+		if e[1] != '*' && e[1] != '&' {
+			err = fmt.Errorf("invalid OBIS code %q: expected group F after group E", s)
+			return
+		}
+
+		e, f, hasF = "*", e[2:], true
+	} else if i := strings.IndexAny(e, "*&"); i > 0 {
+		e, f, hasF = e[:i], e[i+1:], true
+	}
+
+	value[2] = e
+
+	for j, v := range value {
+		if err = parseGroup(2+j, v); err != nil {
+			return
+		}
+	}
+
+	if hasF {
+		if err = parseGroup(5, f); err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// ObisInfo describes an OBIS code.
+type ObisInfo struct {
+	Name        string
+	Description string
+}
+
+var obisRegistryLock sync.RWMutex
+
+// obisRegistry contains the codes commonly transmitted by electricity meters.
+var obisRegistry = map[Obis]ObisInfo{
+	{1, 0, 0, 0, 0, 255}:         {"Property number", "Property number assigned by the metering point operator"},
+	{1, 0, 0, 0, 9, 255}:         {"Device ID", "Server ID of the meter"},
+	{1, 0, 0, 2, 0, 0}:           {"Firmware version", "Version of the meter firmware"},
+	{1, 0, 1, 8, 0, 255}:         {"Energy import", "Positive active energy (A+) of all tariffs"},
+	{1, 0, 1, 8, 1, 255}:         {"Energy import tariff 1", "Positive active energy (A+) of tariff 1"},
+	{1, 0, 1, 8, 2, 255}:         {"Energy import tariff 2", "Positive active energy (A+) of tariff 2"},
+	{1, 0, 2, 8, 0, 255}:         {"Energy export", "Negative active energy (A-) of all tariffs"},
+	{1, 0, 2, 8, 1, 255}:         {"Energy export tariff 1", "Negative active energy (A-) of tariff 1"},
+	{1, 0, 2, 8, 2, 255}:         {"Energy export tariff 2", "Negative active energy (A-) of tariff 2"},
+	{1, 0, 14, 7, 0, 255}:        {"Frequency", "Instantaneous supply frequency"},
+	{1, 0, 16, 7, 0, 255}:        {"Active power", "Sum of the instantaneous active power of all phases, negative when exporting"},
+	{1, 0, 31, 7, 0, 255}:        {"Current L1", "Instantaneous current of phase L1"},
+	{1, 0, 32, 7, 0, 255}:        {"Voltage L1", "Instantaneous voltage of phase L1"},
+	{1, 0, 36, 7, 0, 255}:        {"Active power L1", "Instantaneous active power of phase L1"},
+	{1, 0, 51, 7, 0, 255}:        {"Current L2", "Instantaneous current of phase L2"},
+	{1, 0, 52, 7, 0, 255}:        {"Voltage L2", "Instantaneous voltage of phase L2"},
+	{1, 0, 56, 7, 0, 255}:        {"Active power L2", "Instantaneous active power of phase L2"},
+	{1, 0, 71, 7, 0, 255}:        {"Current L3", "Instantaneous current of phase L3"},
+	{1, 0, 72, 7, 0, 255}:        {"Voltage L3", "Instantaneous voltage of phase L3"},
+	{1, 0, 76, 7, 0, 255}:        {"Active power L3", "Instantaneous active power of phase L3"},
+	{1, 0, 81, 7, 1, 255}:        {"Phase angle U-L2 to U-L1", "Angle between the voltages of phases L2 and L1"},
+	{1, 0, 81, 7, 2, 255}:        {"Phase angle U-L3 to U-L1", "Angle between the voltages of phases L3 and L1"},
+	{1, 0, 81, 7, 4, 255}:        {"Phase angle I-L1 to U-L1", "Angle between current and voltage of phase L1"},
+	{1, 0, 81, 7, 15, 255}:       {"Phase angle I-L2 to U-L2", "Angle between current and voltage of phase L2"},
+	{1, 0, 81, 7, 26, 255}:       {"Phase angle I-L3 to U-L3", "Angle between current and voltage of phase L3"},
+	{1, 0, 96, 1, 0, 255}:        {"Serial number", "Serial number of the meter"},
+	{1, 0, 96, 5, 0, 255}:        {"Operating status", "Status word of the meter"},
+	{1, 0, 96, 50, 1, 1}:         {"Manufacturer ID", "FLAG ID of the manufacturer"},
+	{129, 129, 199, 130, 3, 255}: {"Manufacturer ID", "FLAG ID of the manufacturer"},
+	{129, 129, 199, 130, 5, 255}: {"Public key", "Public key used to sign the values of the meter"},
+}
+
+// RegisterObis adds or replaces the name and description of a code, e.g. for manufacturer specific values.
+func RegisterObis(o Obis, info ObisInfo) {
+	obisRegistryLock.Lock()
+	defer obisRegistryLock.Unlock()
+
+	obisRegistry[o] = info
 }
@@ -0,0 +1,180 @@
+package sml
+
+import "testing"
+
+func TestParseObis(t *testing.T) {
+	tests := []struct {
+		s       string
+		want    Obis
+		wantErr bool
+	}{
+		{s: "1-0:16.7.0*255", want: Obis{1, 0, 16, 7, 0, 255}},
+		{s: "1-0:1.8.1&255", want: Obis{1, 0, 1, 8, 1, 255}},
+		{s: "129-129:199.130.3*255", want: Obis{129, 129, 199, 130, 3, 255}},
+		{s: "1-0:96.50.1*1", want: Obis{1, 0, 96, 50, 1, 1}},
+		// Omitted groups refer to electricity and the current value
+		{s: "1-0:1.8.0", want: Obis{1, 0, 1, 8, 0, 255}},
+		{s: "16.7.0", want: Obis{1, 0, 16, 7, 0, 255}},
+		{s: "1.8.0*1", want: Obis{1, 0, 1, 8, 0, 1}},
+		{s: "0-0:0.0.0*0", want: Obis{0, 0, 0, 0, 0, 0}},
+		{s: "1-0:16.7.256", wantErr: true},
+		{s: "1-0:-1.7.0", wantErr: true},
+		{s: "1-0-0:16.7.0", wantErr: true},
+		{s: "1:16.7.0", wantErr: true},
+		{s: "16.7", wantErr: true},
+		{s: "16.7.0.1", wantErr: true},
+		{s: "16.7.0*", wantErr: true},
+		{s: "1-0:*.8.0", wantErr: true},
+		{s: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			got, err := ParseObis(tt.s)
+
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseObis() error = %v, want error %t", err, tt.wantErr)
+			}
+
+			if got != tt.want {
+				t.Errorf("ParseObis() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseObisPattern(t *testing.T) {
+	tests := []struct {
+		s         string
+		want      string
+		matches   []Obis
+		unmatched []Obis
+	}{
+		{
+			s:         "1-0:16.7.0*255",
+			want:      "1-0:16.7.0*255",
+			matches:   []Obis{{1, 0, 16, 7, 0, 255}},
+			unmatched: []Obis{{1, 0, 16, 7, 0, 0}, {1, 1, 16, 7, 0, 255}},
+		},
+		{
+			// Omitted groups match any value
+			s:         "1.8.*",
+			want:      "*-*:1.8.***",
+			matches:   []Obis{{1, 0, 1, 8, 0, 255}, {1, 0, 1, 8, 2, 255}, {7, 3, 1, 8, 0, 1}},
+			unmatched: []Obis{{1, 0, 2, 8, 0, 255}, {1, 0, 1, 7, 0, 255}},
+		},
+		{
+			s:         "1-0:*.8.*",
+			want:      "1-0:*.8.***",
+			matches:   []Obis{{1, 0, 1, 8, 0, 255}, {1, 0, 2, 8, 1, 255}},
+			unmatched: []Obis{{1, 1, 1, 8, 0, 255}, {1, 0, 16, 7, 0, 255}},
+		},
+		{
+			// A wildcard for group E may be followed by group F
+			s:         "1-0:1.8.**255",
+			want:      "1-0:1.8.**255",
+			matches:   []Obis{{1, 0, 1, 8, 0, 255}, {1, 0, 1, 8, 1, 255}},
+			unmatched: []Obis{{1, 0, 1, 8, 1, 1}},
+		},
+		{
+			s:         "1-0:1.8.*&1",
+			want:      "1-0:1.8.**1",
+			matches:   []Obis{{1, 0, 1, 8, 1, 1}},
+			unmatched: []Obis{{1, 0, 1, 8, 1, 255}},
+		},
+		{
+			s:       "*-*:*.*.***",
+			want:    "*-*:*.*.***",
+			matches: []Obis{{0, 0, 0, 0, 0, 0}, {255, 255, 255, 255, 255, 255}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			p, err := ParseObisPattern(tt.s)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := p.String(); got != tt.want {
+				t.Errorf("String() = %q, want %q", got, tt.want)
+			}
+
+			if reparsed, err := ParseObisPattern(p.String()); err != nil || reparsed != p {
+				t.Errorf("ParseObisPattern(%q) = %v, %v, want %v", p.String(), reparsed, err, p)
+			}
+
+			for _, o := range tt.matches {
+				if !p.Match(o) {
+					t.Errorf("Match(%v) = false, want true", o)
+				}
+			}
+
+			for _, o := range tt.unmatched {
+				if p.Match(o) {
+					t.Errorf("Match(%v) = true, want false", o)
+				}
+			}
+		})
+	}
+}
+
+func TestParseObisPatternInvalid(t *testing.T) {
+	for _, s := range []string{"1-0:1.8.*x", "1-0:1.8.*&", "1-*-0:1.8.0", "1.8", "x.8.0", "1.8.256"} {
+		if p, err := ParseObisPattern(s); err == nil {
+			t.Errorf("ParseObisPattern(%q) = %v, want an error", s, p)
+		}
+	}
+}
+
+func TestObisInfo(t *testing.T) {
+	o := Obis{1, 0, 16, 7, 0, 255}
+
+	if name := o.Name(); name != "Active power" {
+		t.Errorf("Name() = %q, want Active power", name)
+	}
+
+	vendor := Obis{129, 129, 199, 130, 200, 255}
+
+	if _, ok := vendor.Info(); ok {
+		t.Fatalf("Info() of %v is ok before registering it", vendor)
+	}
+
+	RegisterObis(vendor, ObisInfo{Name: "Vendor value", Description: "Registered by the test"})
+
+	t.Cleanup(func() {
+		obisRegistryLock.Lock()
+		defer obisRegistryLock.Unlock()
+
+		delete(obisRegistry, vendor)
+	})
+
+	if info, ok := vendor.Info(); !ok || info.Name != "Vendor value" {
+		t.Errorf("Info() = %v, %t, want the registered info", info, ok)
+	}
+}
+
+func TestObisCompare(t *testing.T) {
+	codes := []Obis{{1, 0, 1, 8, 0, 255}, {1, 0, 1, 8, 1, 255}, {1, 0, 2, 8, 0, 255}, {1, 1, 0, 0, 0, 0}}
+
+	for i := range codes {
+		for j := range codes {
+			want := 0
+
+			if i < j {
+				want = -1
+			} else if i > j {
+				want = 1
+			}
+
+			if got := codes[i].Compare(codes[j]); got != want {
+				t.Errorf("%v.Compare(%v) = %d, want %d", codes[i], codes[j], got, want)
+			}
+
+			if got := codes[i].Less(codes[j]); got != (want < 0) {
+				t.Errorf("%v.Less(%v) = %t, want %t", codes[i], codes[j], got, want < 0)
+			}
+		}
+	}
+}
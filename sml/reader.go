@@ -1,27 +1,186 @@
 package sml
 
-import "io"
+import (
+	"context"
+	"io"
+)
+
+// DefaultMaxAllocation is the maximum allocation used when ReaderOptions.MaxAllocation is not set.
+const DefaultMaxAllocation = 64 * 1024
+
+// DefaultMaxDepth is the maximum nesting depth of lists used when ReaderOptions.MaxDepth is not set.
+const DefaultMaxDepth = 32
+
+// DefaultMaxFrameSize is the maximum size of a frame used when ReaderOptions.MaxFrameSize is not set.
+const DefaultMaxFrameSize = 1024 * 1024
 
 type Reader interface {
 	ReadFile() (*File, error)
+	// ReadFileContext reads the next file like ReadFile, but returns a *ReadCancelled error as soon as the
+	// context is done. A partially read frame is discarded, the next call continues with the following frame.
+	ReadFileContext(ctx context.Context) (*File, error)
+	// Statistics returns the counters of everything read so far.
+	Statistics() ReaderStatistics
+	// Close stops the goroutine started by ReadFileContext. It does not close the underlying reader, a read
+	// in progress keeps the goroutine running until the underlying reader returns, e.g. because it is closed.
+	// Reading from a closed Reader returns ErrReaderClosed. Close may be called while ReadFileContext waits for
+	// data, which then returns ErrReaderClosed.
+	Close() error
+}
+
+// ReaderStatistics counts the bytes and frames processed by a Reader.
+type ReaderStatistics struct {
+	// BytesRead is the number of raw bytes read from the underlying reader.
+	BytesRead uint64
+	// BytesSkipped is the number of bytes discarded while searching for a begin of message marker.
+	BytesSkipped uint64
+	// FramesOk is the number of frames successfully decoded into a File.
+	FramesOk uint64
+
+	// The following counters classify the rejected frames.
+
+	// CrcFailures counts frames with a mismatching transport or message CRC.
+	CrcFailures uint64
+	// EscapeErrors counts frames with an invalid escape sequence.
+	EscapeErrors uint64
+	// PaddingErrors counts frames whose padding does not match the end of message marker.
+	PaddingErrors uint64
+	// DecodeFailures counts frames with invalid tokens or messages which could not be decoded.
+	DecodeFailures uint64
+}
+
+// DiscardedFrame is a frame rejected by a Reader.
+type DiscardedFrame struct {
+	// Reason describes why the frame was rejected.
+	Reason error
+	// Raw contains the escaped bytes of the frame, starting with the begin of message marker and ending where
+	// the frame was rejected.
+	Raw []byte
+}
+
+// ReaderOptions configures a Reader created by NewReaderWithOptions.
+type ReaderOptions struct {
+	// MaxAllocation limits the length of octet strings in bytes and the number of elements of lists.
+	// Larger values announced by a type-length-field invalidate the message, so a corrupt length does not
+	// result in huge allocations. Defaults to DefaultMaxAllocation.
+	MaxAllocation int
+	// MaxDepth limits the nesting depth of lists, the messages themselves being at depth 1. Deeper lists
+	// invalidate the message, so a hostile stream cannot exhaust the stack. Defaults to DefaultMaxDepth.
+	MaxDepth int
+	// MaxFrameSize limits the size of a frame in escaped bytes including its begin of message marker. Larger
+	// frames are discarded, so a stream without an end of message marker is not buffered indefinitely.
+	// Defaults to DefaultMaxFrameSize.
+	MaxFrameSize int
+
+	// The following options relax individual checks for meters with known firmware quirks.
+	// Every relaxation applied to a file is reported in File.Relaxations.
+
+	// SkipFrameCrc accepts frames whose transport checksum does not match.
+	SkipFrameCrc bool
+	// AcceptSwappedCrc accepts frame and message checksums transmitted in the wrong byte order.
+	AcceptSwappedCrc bool
+	// AcceptPaddingMismatch accepts frames whose padding does not match the end of message marker.
+	AcceptPaddingMismatch bool
+	// SkipMessageCrc accepts messages whose embedded CRC16 does not match.
+	SkipMessageCrc bool
+	// CoerceNumericWidths decodes integers encoded with a different width or signedness than required.
+	CoerceNumericWidths bool
+
+	// MessageBodies adds vendor specific message bodies by their tag for this reader only.
+	// They take precedence over the bodies added by RegisterMessageBody.
+	MessageBodies map[uint32]MessageBodyFactory
+
+	// OnDiscardedFrame is called for every rejected frame, if set.
+	// Frames with an invalid transport encoding are skipped, the Reader continues with the next one. Frames whose
+	// messages cannot be decoded are also returned as *InvalidFile by ReadFile, the next call continues with the
+	// following frame.
+	OnDiscardedFrame func(frame DiscardedFrame)
 }
 
 type smlReaderImpl struct {
-	binary *smlBinaryReader
+	binary  *smlBinaryReader
+	options ReaderOptions
 }
 
 func NewReader(reader io.Reader) Reader {
+	return NewReaderWithOptions(reader, ReaderOptions{})
+}
+
+func NewReaderWithOptions(reader io.Reader, options ReaderOptions) Reader {
+	if options.MaxAllocation <= 0 {
+		options.MaxAllocation = DefaultMaxAllocation
+	}
+
+	if options.MaxDepth <= 0 {
+		options.MaxDepth = DefaultMaxDepth
+	}
+
+	if options.MaxFrameSize <= 0 {
+		options.MaxFrameSize = DefaultMaxFrameSize
+	}
+
 	return &smlReaderImpl{
-		binary: newSmlBinaryReader(reader),
+		binary:  newSmlBinaryReader(reader, options),
+		options: options,
 	}
 }
 
 func (s *smlReaderImpl) ReadFile() (*File, error) {
+	return s.ReadFileContext(context.Background())
+}
+
+func (s *smlReaderImpl) ReadFileContext(ctx context.Context) (*File, error) {
+	if s.binary.isClosed() {
+		return nil, ErrReaderClosed
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, &ReadCancelled{
+			err: err,
+		}
+	}
+
+	s.binary.ctx = ctx
 	unparsed, err := s.binary.readMessageBundle()
+	s.binary.ctx = nil
+
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil && err == ctxErr {
+			return nil, &ReadCancelled{
+				MidFrame: s.binary.doCrc,
+				err:      err,
+			}
+		}
+
+		return nil, err
+	}
+
+	file, err := deserializeMessageBundle(unparsed, &s.options)
 
 	if err != nil {
+		s.binary.discardFrame(failureDecode, err, unparsed.raw)
 		return nil, err
 	}
 
-	return deserializeMessageBundle(unparsed)
+	// The raw bytes are reused for the next frame
+	file.Frame = Frame{
+		Raw:        append([]byte{}, unparsed.raw...),
+		Offset:     unparsed.offset,
+		Skipped:    unparsed.skipped,
+		Crc:        unparsed.crc,
+		Padding:    unparsed.padding,
+		ReceivedAt: unparsed.receivedAt,
+	}
+
+	s.binary.statistics.FramesOk++
+	return file, nil
+}
+
+func (s *smlReaderImpl) Statistics() ReaderStatistics {
+	return s.binary.statistics
+}
+
+func (s *smlReaderImpl) Close() error {
+	s.binary.close()
+	return nil
 }
@@ -0,0 +1,354 @@
+package sml
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"reflect"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestReaderStatistics(t *testing.T) {
+	frames := relaxationFrames(t)
+	valid := frames["valid"]
+
+	// An escape sequence, which is neither an escaped escape sequence nor a marker
+	escapeError := append(append([]byte(nil), valid[:8]...), 0x1b, 0x1b, 0x1b, 0x1b, 0x05, 0x05, 0x05, 0x05)
+	escapeError = append(escapeError, valid[8:]...)
+
+	// A file needs at least two messages
+	decodeFailure := fuzzFrame(capturedMessage(t, "05 00b1c2d1 6200 6200 72 630101 76 01 01 05 00b1c2d2 0b 0a01454d4800007f9e31 01 01"))
+
+	stream := bytes.Join([][]byte{
+		{0x00, 0x11, 0x22},
+		valid,
+		frames["frame crc"],
+		{0x33, 0x44},
+		frames["padding mismatch"],
+		escapeError,
+		decodeFailure,
+		valid,
+	}, nil)
+
+	reader := NewReader(bytes.NewReader(stream))
+	files := 0
+
+	for {
+		_, err := reader.ReadFile()
+
+		if err == io.EOF {
+			break
+		}
+
+		if err == nil {
+			files++
+		}
+	}
+
+	// The rest of the frame after the invalid escape sequence is skipped while searching for the next frame
+	want := ReaderStatistics{
+		BytesRead:      uint64(len(stream)),
+		BytesSkipped:   3 + 2 + uint64(len(escapeError)-16),
+		FramesOk:       2,
+		CrcFailures:    1,
+		EscapeErrors:   1,
+		PaddingErrors:  1,
+		DecodeFailures: 1,
+	}
+
+	if got := reader.Statistics(); got != want {
+		t.Errorf("Statistics() = %+v, want %+v", got, want)
+	}
+
+	if files != 2 {
+		t.Errorf("read %d files, want 2", files)
+	}
+}
+
+func TestReaderStatisticsPerFailure(t *testing.T) {
+	frames := relaxationFrames(t)
+	openMessage := capturedMessage(t, "05 00b1c2d1 6200 6200 72 630101 76 01 01 05 00b1c2d2 0b 0a01454d4800007f9e31 01 01")
+
+	// A stray invalid escape sequence, which is skipped while searching for the next frame
+	strayEscape := []byte{0x1b, 0x1b, 0x1b, 0x1b, 0x05, 0x05, 0x05, 0x05}
+
+	escapeError := append(append([]byte(nil), frames["valid"][:8]...), strayEscape...)
+
+	// A list of 5 elements cannot be a message
+	invalidList := []byte{0x75, 0x01, 0x01, 0x01, 0x01, 0x01}
+
+	swappedCrc := append([]byte(nil), openMessage...)
+	swappedCrc[len(swappedCrc)-3], swappedCrc[len(swappedCrc)-2] = swappedCrc[len(swappedCrc)-2], swappedCrc[len(swappedCrc)-3]
+
+	tests := []struct {
+		name    string
+		stream  []byte
+		options ReaderOptions
+		want    ReaderStatistics
+	}{
+		{name: "frame crc", stream: frames["frame crc"], want: ReaderStatistics{CrcFailures: 1}},
+		{name: "message crc", stream: frames["swapped message crc"], want: ReaderStatistics{CrcFailures: 1}},
+		{name: "padding", stream: frames["padding mismatch"], want: ReaderStatistics{PaddingErrors: 1}},
+		{name: "escape", stream: escapeError, want: ReaderStatistics{EscapeErrors: 1}},
+		{name: "invalid message", stream: fuzzFrame(invalidList), want: ReaderStatistics{DecodeFailures: 1}},
+		{name: "invalid message after stray escape sequence", stream: append(strayEscape, fuzzFrame(invalidList)...), want: ReaderStatistics{DecodeFailures: 1}},
+		{name: "invalid message after relaxed message crc", stream: fuzzFrame(append(swappedCrc, invalidList...)), options: ReaderOptions{SkipMessageCrc: true}, want: ReaderStatistics{DecodeFailures: 1}},
+		{name: "invalid file", stream: fuzzFrame(openMessage), want: ReaderStatistics{DecodeFailures: 1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader := NewReaderWithOptions(bytes.NewReader(tt.stream), tt.options)
+
+			for {
+				if _, err := reader.ReadFile(); err == io.EOF {
+					break
+				}
+			}
+
+			got := reader.Statistics()
+			got.BytesRead, got.BytesSkipped = 0, 0
+
+			if got != tt.want {
+				t.Errorf("Statistics() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// notifyingReader closes the received channel once the first data has been consumed, which is when the next
+// read starts.
+type notifyingReader struct {
+	reader   io.Reader
+	received chan struct{}
+	read     bool
+}
+
+func (r *notifyingReader) Read(p []byte) (int, error) {
+	if r.read && r.received != nil {
+		close(r.received)
+		r.received = nil
+	}
+
+	n, err := r.reader.Read(p)
+
+	if n > 0 {
+		r.read = true
+	}
+
+	return n, err
+}
+
+func TestReadFileContextCancel(t *testing.T) {
+	pipeReader, pipeWriter := io.Pipe()
+	received := make(chan struct{})
+	reader := NewReader(&notifyingReader{reader: pipeReader, received: received})
+	frame := relaxationFrames(t)["valid"]
+
+	// The first half of the frame is received before the read is cancelled
+	go func() {
+		_, _ = pipeWriter.Write(frame[:len(frame)/2])
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	go func() {
+		<-received
+		cancel()
+	}()
+
+	_, err := reader.ReadFileContext(ctx)
+
+	var cancelled *ReadCancelled
+
+	if !errors.As(err, &cancelled) || !errors.Is(err, context.Canceled) || !cancelled.MidFrame {
+		t.Fatalf("ReadFileContext() = %v, want a mid-frame *ReadCancelled", err)
+	}
+
+	// The partially read frame is discarded, the pending read receives the rest of it and the next frame
+	go func() {
+		_, _ = pipeWriter.Write(append(frame[len(frame)/2:], frame...))
+	}()
+
+	if _, err := reader.ReadFile(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReadFileContextGoroutines(t *testing.T) {
+	reader := NewReader(&repeatingReader{frame: relaxationFrames(t)["valid"]})
+	defer reader.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if _, err := reader.ReadFileContext(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// All following reads are performed by the goroutine started by the first one
+	goroutines := runtime.NumGoroutine()
+
+	allocs := testing.AllocsPerRun(100, func() {
+		if _, err := reader.ReadFileContext(ctx); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	if n := runtime.NumGoroutine(); n > goroutines {
+		t.Errorf("%d goroutines after reading, want %d", n, goroutines)
+	}
+
+	uncancellable := testing.AllocsPerRun(100, func() {
+		if _, err := reader.ReadFile(); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	if allocs > uncancellable {
+		t.Errorf("ReadFileContext() allocates %.0f times, ReadFile() %.0f times", allocs, uncancellable)
+	}
+}
+
+func TestReaderClose(t *testing.T) {
+	goroutines := runtime.NumGoroutine()
+
+	pipeReader, pipeWriter := io.Pipe()
+	received := make(chan struct{})
+	reader := NewReader(&notifyingReader{reader: pipeReader, received: received})
+	frame := relaxationFrames(t)["valid"]
+
+	go func() {
+		_, _ = pipeWriter.Write(frame[:len(frame)/2])
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	go func() {
+		<-received
+		cancel()
+	}()
+
+	if _, err := reader.ReadFileContext(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("ReadFileContext() = %v, want %v", err, context.Canceled)
+	}
+
+	if err := reader.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := reader.ReadFile(); err != ErrReaderClosed {
+		t.Errorf("ReadFile() = %v, want %v", err, ErrReaderClosed)
+	}
+
+	// The pending read ends once the underlying reader is closed, which stops the goroutine
+	_ = pipeReader.Close()
+
+	for start := time.Now(); runtime.NumGoroutine() > goroutines; time.Sleep(time.Millisecond) {
+		if time.Since(start) > 5*time.Second {
+			t.Fatalf("%d goroutines after closing, want %d", runtime.NumGoroutine(), goroutines)
+		}
+	}
+}
+
+func TestReaderCloseDuringRead(t *testing.T) {
+	goroutines := runtime.NumGoroutine()
+
+	pipeReader, pipeWriter := io.Pipe()
+	received := make(chan struct{})
+	reader := NewReader(&notifyingReader{reader: pipeReader, received: received})
+	frame := relaxationFrames(t)["valid"]
+
+	go func() {
+		_, _ = pipeWriter.Write(frame[:len(frame)/2])
+	}()
+
+	// The reader is closed by another goroutine while the read waits for the rest of the frame
+	go func() {
+		<-received
+		_ = reader.Close()
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if _, err := reader.ReadFileContext(ctx); !errors.Is(err, ErrReaderClosed) {
+		t.Fatalf("ReadFileContext() = %v, want %v", err, ErrReaderClosed)
+	}
+
+	if err := reader.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	_ = pipeReader.Close()
+
+	for start := time.Now(); runtime.NumGoroutine() > goroutines; time.Sleep(time.Millisecond) {
+		if time.Since(start) > 5*time.Second {
+			t.Fatalf("%d goroutines after closing, want %d", runtime.NumGoroutine(), goroutines)
+		}
+	}
+}
+
+func TestFrameMetadata(t *testing.T) {
+	first := capturedFrame(t)
+
+	// The request file id contains an escape sequence, so the raw frame differs from the unescaped messages
+	var payload []byte
+
+	payload = append(payload, capturedMessage(t,
+		"05 00b1c2e1 6200 6200 72 630101 76 01 01 09 1b1b1b1b01020304 0b 0a01454d4800007f9e31 01 01")...)
+	payload = append(payload, capturedMessage(t,
+		"05 00b1c2e2 6200 6200 72 630201 71 01")...)
+
+	second := fuzzFrame(payload)
+
+	if !bytes.Contains(second, escapedEscapeSequence) {
+		t.Fatal("second frame does not contain an escaped escape sequence")
+	}
+
+	var stream []byte
+	stream = append(stream, 0x00, 0x11, 0x22, 0x33, 0x44)
+	stream = append(stream, first...)
+	stream = append(stream, 0x1b, 0x1b, 0x00)
+	stream = append(stream, second...)
+
+	tests := []struct {
+		frame   []byte
+		offset  uint64
+		skipped uint64
+	}{
+		{frame: first, offset: 5, skipped: 5},
+		{frame: second, offset: uint64(5 + len(first) + 3), skipped: 3},
+	}
+
+	reader := NewReader(bytes.NewReader(stream))
+	before := time.Now()
+
+	for i, tt := range tests {
+		file, err := reader.ReadFile()
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want := Frame{
+			Raw:        tt.frame,
+			Offset:     tt.offset,
+			Skipped:    tt.skipped,
+			Crc:        uint16(tt.frame[len(tt.frame)-2])<<8 | uint16(tt.frame[len(tt.frame)-1]),
+			Padding:    int(tt.frame[len(tt.frame)-3]),
+			ReceivedAt: file.Frame.ReceivedAt,
+		}
+
+		if !reflect.DeepEqual(file.Frame, want) {
+			t.Errorf("frame %d = %s, want %s", i, file.Frame, want)
+		}
+
+		if file.Frame.ReceivedAt.Before(before) || file.Frame.ReceivedAt.After(time.Now()) {
+			t.Errorf("frame %d received at %s, want the time it was read", i, file.Frame.ReceivedAt)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package sml
+
+import "fmt"
+
+type RelaxationKind int
+
+const (
+	// RelaxationFrameCrc is reported when the transport checksum of a frame did not match.
+	RelaxationFrameCrc RelaxationKind = iota
+	// RelaxationSwappedCrc is reported when a checksum only matched with its bytes swapped.
+	RelaxationSwappedCrc
+	// RelaxationPaddingMismatch is reported when the padding of a frame did not match the end of message marker.
+	RelaxationPaddingMismatch
+	// RelaxationMessageCrc is reported when the CRC16 embedded into a message did not match.
+	RelaxationMessageCrc
+	// RelaxationNumericWidth is reported when an integer has been decoded with a different width or signedness.
+	RelaxationNumericWidth
+)
+
+func (k RelaxationKind) String() string {
+	switch k {
+	case RelaxationFrameCrc:
+		return "frame crc mismatch"
+	case RelaxationSwappedCrc:
+		return "swapped crc"
+	case RelaxationPaddingMismatch:
+		return "padding mismatch"
+	case RelaxationMessageCrc:
+		return "message crc mismatch"
+	case RelaxationNumericWidth:
+		return "numeric width mismatch"
+	}
+
+	return fmt.Sprintf("unknown relaxation %d", int(k))
+}
+
+// Relaxation describes a check that failed, but has been accepted due to the ReaderOptions.
+type Relaxation struct {
+	Kind   RelaxationKind
+	Detail string
+}
+
+func (r Relaxation) String() string {
+	return fmt.Sprintf("%s: %s", r.Kind, r.Detail)
+}
@@ -0,0 +1,132 @@
+package sml
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+)
+
+// relaxationFrames returns frames of a minimal file, each breaking a single check.
+func relaxationFrames(tb testing.TB) map[string][]byte {
+	openMessage := "05 00b1c2d1 6200 6200 72 630101 76 01 01 05 00b1c2d2 0b 0a01454d4800007f9e31 01 01"
+	closeMessage := "05 00b1c2d4 6200 6200 72 630201 71 01"
+	payload := append(capturedMessage(tb, openMessage), capturedMessage(tb, closeMessage)...)
+	w := newSmlBinaryWriter(nil)
+
+	frames := map[string][]byte{
+		"valid": fuzzFrame(payload),
+	}
+
+	frame := fuzzFrame(payload)
+	frame[len(frame)-1] ^= 0xff
+	frames["frame crc"] = frame
+
+	frame = fuzzFrame(payload)
+	frame[len(frame)-2], frame[len(frame)-1] = frame[len(frame)-1], frame[len(frame)-2]
+	frames["swapped frame crc"] = frame
+
+	swapped := append([]byte(nil), payload...)
+	crc := len(capturedMessage(tb, openMessage)) - 3
+	swapped[crc], swapped[crc+1] = swapped[crc+1], swapped[crc]
+	frames["swapped message crc"] = fuzzFrame(swapped)
+
+	frame = fuzzFrame(payload)
+	frame[len(frame)-3] = (frame[len(frame)-3] + 1) % 4
+	checksum := w.checksum(frame[:len(frame)-2])
+	frame[len(frame)-2], frame[len(frame)-1] = byte(checksum>>8), byte(checksum)
+	frames["padding mismatch"] = frame
+
+	// The group number is an unsigned integer, but some meters send a signed one
+	frames["numeric width"] = fuzzFrame(append(capturedMessage(tb, "05 00b1c2d1 5200 6200 72 630101 76 01 01 05 00b1c2d2 0b 0a01454d4800007f9e31 01 01"),
+		capturedMessage(tb, closeMessage)...))
+
+	return frames
+}
+
+func TestRelaxations(t *testing.T) {
+	frames := relaxationFrames(t)
+
+	tests := []struct {
+		frame   string
+		options ReaderOptions
+		wantErr error
+		want    []RelaxationKind
+	}{
+		{frame: "valid"},
+		{frame: "valid", options: ReaderOptions{SkipFrameCrc: true, AcceptSwappedCrc: true, AcceptPaddingMismatch: true, SkipMessageCrc: true, CoerceNumericWidths: true}},
+		{frame: "frame crc", wantErr: ErrCrcMismatch},
+		{frame: "frame crc", options: ReaderOptions{AcceptSwappedCrc: true}, wantErr: ErrCrcMismatch},
+		{frame: "frame crc", options: ReaderOptions{SkipFrameCrc: true}, want: []RelaxationKind{RelaxationFrameCrc}},
+		{frame: "swapped frame crc", wantErr: ErrCrcMismatch},
+		{frame: "swapped frame crc", options: ReaderOptions{AcceptSwappedCrc: true}, want: []RelaxationKind{RelaxationSwappedCrc}},
+		{frame: "swapped frame crc", options: ReaderOptions{SkipFrameCrc: true}, want: []RelaxationKind{RelaxationFrameCrc}},
+		{frame: "swapped message crc", wantErr: ErrCrcMismatch},
+		{frame: "swapped message crc", options: ReaderOptions{AcceptSwappedCrc: true}, want: []RelaxationKind{RelaxationSwappedCrc}},
+		{frame: "swapped message crc", options: ReaderOptions{SkipMessageCrc: true}, want: []RelaxationKind{RelaxationMessageCrc}},
+		{frame: "padding mismatch", wantErr: ErrPadding},
+		{frame: "padding mismatch", options: ReaderOptions{AcceptPaddingMismatch: true}, want: []RelaxationKind{RelaxationPaddingMismatch}},
+		{frame: "numeric width", wantErr: ErrTypeMismatch},
+		{frame: "numeric width", options: ReaderOptions{CoerceNumericWidths: true}, want: []RelaxationKind{RelaxationNumericWidth}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.frame, func(t *testing.T) {
+			var discarded []DiscardedFrame
+
+			options := tt.options
+			options.OnDiscardedFrame = func(frame DiscardedFrame) {
+				discarded = append(discarded, frame)
+			}
+
+			file, err := NewReaderWithOptions(bytes.NewReader(frames[tt.frame]), options).ReadFile()
+
+			if tt.wantErr != nil {
+				if err == io.EOF && len(discarded) == 1 {
+					err = discarded[0].Reason
+				}
+
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("ReadFile() = %v, want %v", err, tt.wantErr)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got []RelaxationKind
+
+			for _, relaxation := range file.Relaxations {
+				got = append(got, relaxation.Kind)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Relaxations = %v, want %v", file.Relaxations, tt.want)
+			}
+		})
+	}
+}
+
+func TestRelaxationString(t *testing.T) {
+	tests := []struct {
+		relaxation Relaxation
+		want       string
+	}{
+		{Relaxation{RelaxationFrameCrc, "expected 1234, calculated 4321"}, "frame crc mismatch: expected 1234, calculated 4321"},
+		{Relaxation{RelaxationSwappedCrc, "message crc mismatch: expected 1234, calculated 3412"}, "swapped crc: message crc mismatch: expected 1234, calculated 3412"},
+		{Relaxation{RelaxationPaddingMismatch, "expected 1 padding bytes, found 2"}, "padding mismatch: expected 1 padding bytes, found 2"},
+		{Relaxation{RelaxationMessageCrc, "expected 1234, calculated 4321"}, "message crc mismatch: expected 1234, calculated 4321"},
+		{Relaxation{RelaxationNumericWidth, "decoded int8 as uint8"}, "numeric width mismatch: decoded int8 as uint8"},
+		{Relaxation{RelaxationKind(42), "detail"}, "unknown relaxation 42: detail"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.relaxation.String(); got != tt.want {
+			t.Errorf("String() = %q, want %q", got, tt.want)
+		}
+	}
+}
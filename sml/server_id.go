@@ -0,0 +1,97 @@
+package sml
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+)
+
+// serverIdTypeMeterNumber is the first byte of a server ID containing a meter number according to DIN 43863-5.
+const serverIdTypeMeterNumber = 0x0a
+
+var mediumNames = map[uint8]string{
+	0: "abstract",
+	1: "electricity",
+	4: "heat cost allocator",
+	5: "cooling",
+	6: "heat",
+	7: "gas",
+	8: "cold water",
+	9: "hot water",
+}
+
+// ServerId is the meter number a server ID consists of according to DIN 43863-5, e.g. 1 EMH 00 08363569.
+type ServerId struct {
+	// Medium is the energy type measured, using the values of OBIS group A, e.g. 1 for electricity
+	Medium uint8
+	// Manufacturer is the three letter FLAG ID of the manufacturer
+	Manufacturer string
+	// FabricationBlock is a number from 0 to 99 chosen by the manufacturer
+	FabricationBlock uint8
+	// SerialNumber is a number from 0 to 99999999 unique within the fabrication block
+	SerialNumber uint32
+}
+
+// ParseServerId decodes a server ID like GetListResMessageBody.ServerId, which must consist of 10 bytes:
+// the type 0x0a, the medium, the FLAG ID, the fabrication block and the big-endian serial number.
+func ParseServerId(id []byte) (ServerId, error) {
+	if len(id) != 10 {
+		return ServerId{}, fmt.Errorf("server ID %s: expected 10 bytes, got %d", hex.EncodeToString(id), len(id))
+	}
+
+	if id[0] != serverIdTypeMeterNumber {
+		return ServerId{}, fmt.Errorf("server ID %s: unsupported type %02x", hex.EncodeToString(id), id[0])
+	}
+
+	for _, c := range id[2:5] {
+		if c < 'A' || c > 'Z' {
+			return ServerId{}, fmt.Errorf("server ID %s: invalid FLAG ID", hex.EncodeToString(id))
+		}
+	}
+
+	s := ServerId{
+		Medium:           id[1],
+		Manufacturer:     string(id[2:5]),
+		FabricationBlock: id[5],
+		SerialNumber:     binary.BigEndian.Uint32(id[6:10]),
+	}
+
+	if s.FabricationBlock > 99 || s.SerialNumber > 99999999 {
+		return ServerId{}, fmt.Errorf("server ID %s: meter number out of range", hex.EncodeToString(id))
+	}
+
+	return s, nil
+}
+
+// MediumName returns the name of the medium, or an empty string if it is unknown.
+func (s ServerId) MediumName() string {
+	return mediumNames[s.Medium]
+}
+
+// String returns the meter number as it is printed on the meter, e.g. 1EMH0008363569.
+func (s ServerId) String() string {
+	return fmt.Sprintf("%d%s%02d%08d", s.Medium, s.Manufacturer, s.FabricationBlock, s.SerialNumber)
+}
+
+// Bytes returns the server ID as it is transmitted.
+func (s ServerId) Bytes() []byte {
+	id := make([]byte, 10)
+	id[0] = serverIdTypeMeterNumber
+	id[1] = s.Medium
+	copy(id[2:5], s.Manufacturer)
+	id[5] = s.FabricationBlock
+	binary.BigEndian.PutUint32(id[6:10], s.SerialNumber)
+
+	return id
+}
+
+// stringServerId prints a server ID as hex, followed by the meter number if it can be decoded.
+func stringServerId(id []byte) string {
+	s := hex.EncodeToString(id)
+
+	if serverId, err := ParseServerId(id); err == nil {
+		s += fmt.Sprintf(" (%s)", serverId)
+	}
+
+	return s
+}
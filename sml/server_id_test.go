@@ -0,0 +1,108 @@
+package sml
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+func TestParseServerId(t *testing.T) {
+	tests := []struct {
+		id         string
+		want       ServerId
+		wantString string
+		wantMedium string
+		wantErr    bool
+	}{
+		{
+			id:         "0a01454d4800007f9e31",
+			want:       ServerId{Medium: 1, Manufacturer: "EMH", FabricationBlock: 0, SerialNumber: 8363569},
+			wantString: "1EMH0008363569",
+			wantMedium: "electricity",
+		},
+		{
+			id:         "0a074954526305f5e0ff",
+			want:       ServerId{Medium: 7, Manufacturer: "ITR", FabricationBlock: 99, SerialNumber: 99999999},
+			wantString: "7ITR9999999999",
+			wantMedium: "gas",
+		},
+		{
+			id:         "0a02455359010000007b",
+			want:       ServerId{Medium: 2, Manufacturer: "ESY", FabricationBlock: 1, SerialNumber: 123},
+			wantString: "2ESY0100000123",
+		},
+		// Too short and too long
+		{id: "0a01454d4800007f9e", wantErr: true},
+		{id: "0a01454d4800007f9e3100", wantErr: true},
+		{id: "", wantErr: true},
+		// Other types, like the MAC address format
+		{id: "0601454d4800007f9e31", wantErr: true},
+		// Manufacturer is not upper-case letters
+		{id: "0a01656d6800007f9e31", wantErr: true},
+		{id: "0a01454d3000007f9e31", wantErr: true},
+		// Fabrication block and serial number out of range
+		{id: "0a01454d4864007f9e31", wantErr: true},
+		{id: "0a01454d480005f5e100", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.id, func(t *testing.T) {
+			id, err := hex.DecodeString(tt.id)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := ParseServerId(id)
+
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseServerId() error = %v, want error %t", err, tt.wantErr)
+			}
+
+			if got != tt.want {
+				t.Errorf("ParseServerId() = %+v, want %+v", got, tt.want)
+			}
+
+			if tt.wantErr {
+				return
+			}
+
+			if s := got.String(); s != tt.wantString {
+				t.Errorf("String() = %q, want %q", s, tt.wantString)
+			}
+
+			if name := got.MediumName(); name != tt.wantMedium {
+				t.Errorf("MediumName() = %q, want %q", name, tt.wantMedium)
+			}
+
+			if b := got.Bytes(); !bytes.Equal(b, id) {
+				t.Errorf("Bytes() = %x, want %x", b, id)
+			}
+		})
+	}
+}
+
+func TestStringServerId(t *testing.T) {
+	tests := []struct {
+		id   string
+		want string
+	}{
+		{"0a01454d4800007f9e31", "0a01454d4800007f9e31 (1EMH0008363569)"},
+		{"0601454d4800007f9e31", "0601454d4800007f9e31"},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.id, func(t *testing.T) {
+			id, err := hex.DecodeString(tt.id)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := stringServerId(id); got != tt.want {
+				t.Errorf("stringServerId() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
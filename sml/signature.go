@@ -0,0 +1,426 @@
+package sml
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"reflect"
+	"strings"
+)
+
+// SignatureState is the result of verifying a signature.
+type SignatureState uint8
+
+const (
+	// SignatureUnsigned means that no signature has been transmitted
+	SignatureUnsigned SignatureState = iota
+	// SignatureSigned means that a signature has been transmitted, but no key is available to verify it
+	SignatureSigned
+	// SignatureVerified means that the signature is valid for one of the keys
+	SignatureVerified
+	// SignatureFailed means that the signature is not valid for any of the keys
+	SignatureFailed
+)
+
+var signatureStateNames = map[SignatureState]string{
+	SignatureUnsigned: "unsigned",
+	SignatureSigned:   "signed",
+	SignatureVerified: "verified",
+	SignatureFailed:   "failed",
+}
+
+func (s SignatureState) String() string {
+	if name, ok := signatureStateNames[s]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("SignatureState(%d)", uint8(s))
+}
+
+// ParsePublicKey parses an ECDSA public key on one of the NIST curves P-256, P-384 or P-521.
+// The key is either a PEM encoded PKIX public key, or the hex encoded uncompressed point as displayed by many
+// meters, optionally without the leading 04.
+func ParsePublicKey(s string) (*ecdsa.PublicKey, error) {
+	s = strings.TrimSpace(s)
+
+	if block, _ := pem.Decode([]byte(s)); block != nil {
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+
+		if err != nil {
+			return nil, fmt.Errorf("invalid public key: %w", err)
+		}
+
+		ecKey, ok := key.(*ecdsa.PublicKey)
+
+		if !ok {
+			return nil, fmt.Errorf("invalid public key: expected an ECDSA key, got %T", key)
+		}
+
+		return ecKey, nil
+	}
+
+	point, err := hex.DecodeString(strings.ReplaceAll(s, " ", ""))
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key: %w", err)
+	}
+
+	if len(point)%2 == 0 {
+		point = append([]byte{0x04}, point...)
+	}
+
+	for _, curve := range []elliptic.Curve{elliptic.P256(), elliptic.P384(), elliptic.P521()} {
+		if len(point) != 1+2*curveByteSize(curve) {
+			continue
+		}
+
+		x, y := elliptic.Unmarshal(curve, point)
+
+		if x == nil {
+			return nil, errors.New("invalid public key: point is not on the curve")
+		}
+
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+
+	return nil, fmt.Errorf("invalid public key: unsupported length of %d bytes", len(point))
+}
+
+func curveByteSize(curve elliptic.Curve) int {
+	return (curve.Params().BitSize + 7) / 8
+}
+
+// Verifier verifies the signatures of a meter with its public keys.
+// A nil Verifier or one without keys reports transmitted signatures as SignatureSigned.
+type Verifier struct {
+	keys []*ecdsa.PublicKey
+}
+
+func NewVerifier(keys ...*ecdsa.PublicKey) *Verifier {
+	return &Verifier{
+		keys: keys,
+	}
+}
+
+// Verify checks an ECDSA signature over the data. The signature is either the concatenation of r and s, or
+// encoded in ASN.1. The data is hashed with SHA-256, SHA-384 or SHA-512 depending on the size of the curve.
+func (v *Verifier) Verify(data []byte, signature []byte) SignatureState {
+	if len(signature) == 0 {
+		return SignatureUnsigned
+	}
+
+	if v == nil || len(v.keys) == 0 {
+		return SignatureSigned
+	}
+
+	for _, key := range v.keys {
+		if verifySignature(key, data, signature) {
+			return SignatureVerified
+		}
+	}
+
+	return SignatureFailed
+}
+
+func verifySignature(key *ecdsa.PublicKey, data []byte, signature []byte) bool {
+	size := curveByteSize(key.Curve)
+
+	hash := crypto.SHA256
+
+	if size > 48 {
+		hash = crypto.SHA512
+	} else if size > 32 {
+		hash = crypto.SHA384
+	}
+
+	h := hash.New()
+	h.Write(data)
+	digest := h.Sum(nil)
+
+	if len(signature) == 2*size {
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		return ecdsa.Verify(key, digest, r, s)
+	}
+
+	return ecdsa.VerifyASN1(key, digest, signature)
+}
+
+// VerifyListEntry verifies the ValueSignature of an entry over its SignedData.
+func (v *Verifier) VerifyListEntry(e *ListEntry) SignatureState {
+	if len(e.ValueSignature) == 0 {
+		return SignatureUnsigned
+	}
+
+	data, err := e.SignedData()
+
+	if err != nil {
+		return SignatureFailed
+	}
+
+	return v.Verify(data, e.ValueSignature)
+}
+
+// VerifyList verifies the ListSignature of a list over its SignedData.
+func (v *Verifier) VerifyList(b *GetListResMessageBody) SignatureState {
+	if len(b.ListSignature) == 0 {
+		return SignatureUnsigned
+	}
+
+	data, err := b.SignedData()
+
+	if err != nil {
+		return SignatureFailed
+	}
+
+	return v.Verify(data, b.ListSignature)
+}
+
+// VerifyFile verifies the GlobalSignature of the SML_PublicClose.Res message over the SignedData of the file.
+func (v *Verifier) VerifyFile(f *File) SignatureState {
+	if len(f.Messages) == 0 {
+		return SignatureUnsigned
+	}
+
+	closeRes, ok := f.Messages[len(f.Messages)-1].MessageBody.(*PublicCloseResMessageBody)
+
+	if !ok || len(closeRes.GlobalSignature) == 0 {
+		return SignatureUnsigned
+	}
+
+	data, err := f.SignedData()
+
+	if err != nil {
+		return SignatureFailed
+	}
+
+	return v.Verify(data, closeRes.GlobalSignature)
+}
+
+// SignedData returns the data covered by the ValueSignature: the entry without its signature, which is
+// replaced by an absent value. Meters sign the bytes they transmit, so the entry is taken as it has been received,
+// unless it has been modified or created by the caller and needs to be encoded.
+func (e *ListEntry) SignedData() ([]byte, error) {
+	if data, ok := receivedSignedData(e, "ValueSignature"); ok {
+		return data, nil
+	}
+
+	entry := *e
+	entry.ValueSignature = nil
+	entry.receivedEncoding = receivedEncoding{}
+
+	return encodeSignedData(&entry)
+}
+
+// SignedData returns the data covered by the ListSignature: the list without its signature and without the
+// gateway time, which is added after signing. Both are replaced by absent values, the rest of the list is taken
+// as it has been received like for ListEntry.SignedData.
+func (b *GetListResMessageBody) SignedData() ([]byte, error) {
+	if data, ok := receivedSignedData(b, "ListSignature", "ActGatewayTime"); ok {
+		return data, nil
+	}
+
+	body := *b
+	body.ListSignature = nil
+	body.ActGatewayTime = nil
+	body.receivedEncoding = receivedEncoding{}
+
+	return encodeSignedData(&body)
+}
+
+// SignedData returns the data covered by the GlobalSignature: all messages preceding the SML_PublicClose.Res
+// message, including their CRC. Unmodified messages are taken as they have been received.
+func (f *File) SignedData() ([]byte, error) {
+	if len(f.Messages) == 0 {
+		return nil, errors.New("file does not contain any messages")
+	}
+
+	bundle, err := serializeMessageBundle(&File{
+		Messages:      f.Messages[:len(f.Messages)-1],
+		messageBodies: f.messageBodies,
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	buf := &bytes.Buffer{}
+	w := newSmlBinaryWriter(buf)
+
+	for _, m := range bundle.messages {
+		if err := w.encodeMessage(buf, m); err != nil {
+			return nil, err
+		}
+	}
+
+	return buf.Bytes(), nil
+}
+
+// receivedSignedData returns the received encoding of a struct, with the elements of the named fields replaced by
+// absent values. It returns false if the struct has not been read, or has been modified since.
+func receivedSignedData(value interface{}, unsigned ...string) ([]byte, bool) {
+	v := reflect.ValueOf(value).Elem()
+	raw, unchanged := unchangedReceived(v)
+
+	if !unchanged {
+		return nil, false
+	}
+
+	offsets, err := listElementOffsets(raw)
+
+	if err != nil {
+		return nil, false
+	}
+
+	// The elements of a list are the fields of the struct in their order, following the embedded receivedEncoding
+	absent := make(map[int]bool, len(unsigned))
+
+	for _, name := range unsigned {
+		field, ok := v.Type().FieldByName(name)
+
+		if !ok || field.Index[0] < 1 || field.Index[0] > len(offsets)-1 {
+			return nil, false
+		}
+
+		absent[field.Index[0]-1] = true
+	}
+
+	data := append([]byte(nil), raw[:offsets[0]]...)
+
+	for i := 0; i < len(offsets)-1; i++ {
+		if absent[i] {
+			data = append(data, 0x01)
+		} else {
+			data = append(data, raw[offsets[i]:offsets[i+1]]...)
+		}
+	}
+
+	return data, true
+}
+
+// listElementOffsets returns the offsets of the elements of an unescaped list encoding, followed by its length.
+func listElementOffsets(raw []byte) ([]int, error) {
+	escaped := &bytes.Buffer{}
+	newSmlBinaryWriter(nil).escape(escaped, raw)
+
+	r := newSmlBinaryReader(bytes.NewReader(escaped.Bytes()), ReaderOptions{
+		MaxAllocation: DefaultMaxAllocation,
+		MaxDepth:      DefaultMaxDepth,
+		MaxFrameSize:  DefaultMaxFrameSize,
+	})
+	r.recording = true
+
+	tlf, err := r.readTypeLength()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if tlf.dataType != 0x7 {
+		return nil, fmt.Errorf("expected a list, got type %1x", tlf.dataType)
+	}
+
+	offsets := make([]int, 0, tlf.dataLength+1)
+
+	for i := 0; i < tlf.dataLength; i++ {
+		offsets = append(offsets, len(r.payload))
+
+		if _, err := r.readToken(); err != nil {
+			return nil, err
+		}
+	}
+
+	return append(offsets, len(r.payload)), nil
+}
+
+func encodeSignedData(value interface{}) ([]byte, error) {
+	token, err := newEncoder(nil).serializeField(reflect.ValueOf(value).Elem(), fieldParams{}, nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	buf := &bytes.Buffer{}
+
+	if err := newSmlBinaryWriter(buf).encodeToken(buf, token); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// SignatureReport lists the results of verifying all signatures of a file.
+type SignatureReport struct {
+	Global SignatureState
+	Lists  []ListSignatureReport
+}
+
+// ListSignatureReport lists the results of verifying the signatures of a SML_GetList.Res message.
+type ListSignatureReport struct {
+	ServerId []byte
+	ListName []byte
+	State    SignatureState
+	Values   []ValueSignatureReport
+}
+
+// ValueSignatureReport is the result of verifying the signature of a ListEntry.
+type ValueSignatureReport struct {
+	ObjName []byte
+	State   SignatureState
+}
+
+// VerifyAll verifies the global signature, and the signatures of all lists and their entries.
+func (v *Verifier) VerifyAll(f *File) *SignatureReport {
+	r := &SignatureReport{
+		Global: v.VerifyFile(f),
+	}
+
+	for _, m := range f.Messages {
+		list, ok := m.MessageBody.(*GetListResMessageBody)
+
+		if !ok {
+			continue
+		}
+
+		l := ListSignatureReport{
+			ServerId: list.ServerId,
+			ListName: list.ListName,
+			State:    v.VerifyList(list),
+			Values:   make([]ValueSignatureReport, len(list.ValList)),
+		}
+
+		for i, e := range list.ValList {
+			l.Values[i] = ValueSignatureReport{
+				ObjName: e.ObjName,
+				State:   v.VerifyListEntry(e),
+			}
+		}
+
+		r.Lists = append(r.Lists, l)
+	}
+
+	return r
+}
+
+func (r *SignatureReport) String() string {
+	s := "Signatures = {\n"
+	s += fmt.Sprintf(" Global = %s\n", r.Global)
+
+	for _, l := range r.Lists {
+		s += fmt.Sprintf(" List %s of server %s = %s\n", hex.EncodeToString(l.ListName), stringServerId(l.ServerId), l.State)
+
+		for _, v := range l.Values {
+			s += fmt.Sprintf("  %s = %s\n", stringObjName(v.ObjName), v.State)
+		}
+	}
+
+	s += "}"
+	return s
+}
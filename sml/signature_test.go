@@ -0,0 +1,323 @@
+package sml
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"strings"
+	"testing"
+)
+
+// The signatures of signedFrame are arbitrary values of 64 bytes, the length of ECDSA signatures on P-256. Tests
+// verifying signatures generate a key and sign the frame with signedFrameWithKey.
+const (
+	testValueSignature = "58327c8e1f87b9843d68695b3db6da96e3bd518b45ef6b4734fa222f52445694" +
+		"303253cc93deeae80d413f51b850bbe21eeeaeddd5401c3f7681f57da4438e0f"
+	testListSignature = "5fc0d51e56458c655d8dbdf93b51806a76dbde30b68396d51e34f43097432e9f" +
+		"fae2938bbb05ec3fbf5ba68beed55ec52150919bd9c77904a7ce7dfe09d46b20"
+)
+
+const (
+	testSignedEntry = "77 07 0100010800ff 0101 621e 5200 56 0000001234"
+	testSignedList  = "77 01 0b 0a01454d4800007f9e31 07 0100620affff 72 6201 65 00bc614e 71"
+)
+
+// signedFrame contains a list with a signed entry, which uses an explicit zero scaler and an integer of 5 bytes
+// like the entries of real meters. The gateway time is added after the list has been signed.
+func signedFrame(tb testing.TB) []byte {
+	return signedFrameWith(tb, testValueSignature, testListSignature)
+}
+
+func signedFrameWith(tb testing.TB, valueSignature string, listSignature string) []byte {
+	var payload []byte
+
+	payload = append(payload, capturedMessage(tb,
+		"05 00b1c2d1 6200 6200 72 630101 76 01 01 05 00b1c2d2 0b 0a01454d4800007f9e31 01 01")...)
+	payload = append(payload, capturedMessage(tb,
+		"05 00b1c2d3 6200 6200 72 630701 "+testSignedList+testSignedEntry+" 8402"+valueSignature+
+			"8402"+listSignature+" 72 6202 65 5f5e1000")...)
+	payload = append(payload, capturedMessage(tb,
+		"05 00b1c2d4 6200 6200 72 630201 71 01")...)
+
+	return fuzzFrame(payload)
+}
+
+// signedFrameWithKey signs the entry and the list of signedFrame like a meter does, i.e. over their encodings with
+// the signatures and the gateway time being absent.
+func signedFrameWithKey(tb testing.TB, key *ecdsa.PrivateKey) []byte {
+	valueSignature := testSign(tb, key, testSignedEntry+" 01")
+	listSignature := testSign(tb, key, testSignedList+testSignedEntry+" 8402"+valueSignature+" 01 01")
+
+	return signedFrameWith(tb, valueSignature, listSignature)
+}
+
+// testSign returns the hex encoded concatenation of r and s of a P-256 signature over the hex encoded data.
+func testSign(tb testing.TB, key *ecdsa.PrivateKey, data string) string {
+	decoded, err := hex.DecodeString(strings.ReplaceAll(data, " ", ""))
+
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	digest := sha256.Sum256(decoded)
+	r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	signature := make([]byte, 64)
+	r.FillBytes(signature[:32])
+	s.FillBytes(signature[32:])
+
+	return hex.EncodeToString(signature)
+}
+
+func generateKey(tb testing.TB) *ecdsa.PrivateKey {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	return key
+}
+
+func TestParsePublicKey(t *testing.T) {
+	key := generateKey(t)
+	point := hex.EncodeToString(elliptic.Marshal(key.Curve, key.X, key.Y))
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		key     string
+		wantErr bool
+	}{
+		{name: "uncompressed point", key: point},
+		{name: "point without prefix", key: point[2:]},
+		{name: "PEM", key: string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))},
+		{name: "not on the curve", key: point[:len(point)-2] + "00", wantErr: true},
+		{name: "unsupported length", key: point[:len(point)-4], wantErr: true},
+		{name: "not hex", key: "04zz", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParsePublicKey(tt.key)
+
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("ParsePublicKey() = %v, want an error", got)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !got.Equal(&key.PublicKey) {
+				t.Errorf("ParsePublicKey() = %v, want the generated key", got)
+			}
+		})
+	}
+}
+
+func TestSignedData(t *testing.T) {
+	file, err := NewReader(bytes.NewReader(signedFrame(t))).ReadFile()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	list := file.Messages[1].MessageBody.(*GetListResMessageBody)
+
+	tests := []struct {
+		name       string
+		signedData func() ([]byte, error)
+		want       string
+	}{
+		{
+			name:       "entry",
+			signedData: list.ValList[0].SignedData,
+			want:       "77070100010800ff0101621e520056000000123401",
+		},
+		{
+			name:       "list",
+			signedData: list.SignedData,
+			want: "77010b0a01454d4800007f9e31070100620affff7262016500bc614e71" +
+				"77070100010800ff0101621e52005600000012348402" + testValueSignature + "0101",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := tt.signedData()
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := hex.EncodeToString(data); got != tt.want {
+				t.Errorf("SignedData() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSignedDataEncoded(t *testing.T) {
+	value := int64(0x1234)
+	signature, _ := hex.DecodeString(testValueSignature)
+
+	// Entries which have not been read are encoded, which chooses the minimal width for the value
+	entry := &ListEntry{
+		ObjName:        []byte{0x01, 0x00, 0x01, 0x08, 0x00, 0xff},
+		Unit:           UnitWattHour,
+		Value:          &value,
+		ValueSignature: signature,
+	}
+
+	data, err := entry.SignedData()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := hex.EncodeToString(data), "77070100010800ff0101621e0159000000000000123401"; got != want {
+		t.Errorf("SignedData() = %s, want %s", got, want)
+	}
+}
+
+func TestVerifyReceivedSignatures(t *testing.T) {
+	key := generateKey(t)
+	frame := signedFrameWithKey(t, key)
+
+	tests := []struct {
+		name      string
+		verifier  *Verifier
+		modify    func(list *GetListResMessageBody)
+		wantList  SignatureState
+		wantEntry SignatureState
+	}{
+		{
+			name:      "received",
+			verifier:  NewVerifier(&key.PublicKey),
+			wantList:  SignatureVerified,
+			wantEntry: SignatureVerified,
+		},
+		{
+			name:      "one of several keys",
+			verifier:  NewVerifier(&generateKey(t).PublicKey, &key.PublicKey),
+			wantList:  SignatureVerified,
+			wantEntry: SignatureVerified,
+		},
+		{
+			name:      "without keys",
+			verifier:  NewVerifier(),
+			wantList:  SignatureSigned,
+			wantEntry: SignatureSigned,
+		},
+		{
+			name:      "nil verifier",
+			wantList:  SignatureSigned,
+			wantEntry: SignatureSigned,
+		},
+		{
+			name:      "other key",
+			verifier:  NewVerifier(&generateKey(t).PublicKey),
+			wantList:  SignatureFailed,
+			wantEntry: SignatureFailed,
+		},
+		{
+			name:     "gateway time changed",
+			verifier: NewVerifier(&key.PublicKey),
+			modify: func(list *GetListResMessageBody) {
+				list.ActGatewayTime = nil
+			},
+			wantList:  SignatureVerified,
+			wantEntry: SignatureVerified,
+		},
+		{
+			name:     "value changed",
+			verifier: NewVerifier(&key.PublicKey),
+			modify: func(list *GetListResMessageBody) {
+				value := int64(0x1235)
+				list.ValList[0].Value = &value
+			},
+			wantList:  SignatureFailed,
+			wantEntry: SignatureFailed,
+		},
+		{
+			name:     "signature removed",
+			verifier: NewVerifier(&key.PublicKey),
+			modify: func(list *GetListResMessageBody) {
+				list.ValList[0].ValueSignature = nil
+			},
+			wantList:  SignatureFailed,
+			wantEntry: SignatureUnsigned,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file, err := NewReader(bytes.NewReader(frame)).ReadFile()
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			list := file.Messages[1].MessageBody.(*GetListResMessageBody)
+
+			if tt.modify != nil {
+				tt.modify(list)
+			}
+
+			report := tt.verifier.VerifyAll(file)
+
+			if len(report.Lists) != 1 || len(report.Lists[0].Values) != 1 {
+				t.Fatalf("VerifyAll() = %s, want one list with one entry", report)
+			}
+
+			if got := report.Lists[0].State; got != tt.wantList {
+				t.Errorf("list signature = %s, want %s", got, tt.wantList)
+			}
+
+			if got := report.Lists[0].Values[0].State; got != tt.wantEntry {
+				t.Errorf("entry signature = %s, want %s", got, tt.wantEntry)
+			}
+
+			if report.Global != SignatureUnsigned {
+				t.Errorf("global signature = %s, want %s", report.Global, SignatureUnsigned)
+			}
+		})
+	}
+}
+
+func TestVerifyASN1Signature(t *testing.T) {
+	key := generateKey(t)
+	data := []byte("signed data")
+	digest := sha256.Sum256(data)
+	signature, err := ecdsa.SignASN1(rand.Reader, key, digest[:])
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := NewVerifier(&key.PublicKey).Verify(data, signature); got != SignatureVerified {
+		t.Errorf("Verify() = %s, want %s", got, SignatureVerified)
+	}
+
+	if got := NewVerifier(&key.PublicKey).Verify([]byte("other data"), signature); got != SignatureFailed {
+		t.Errorf("Verify() of other data = %s, want %s", got, SignatureFailed)
+	}
+}
@@ -0,0 +1,130 @@
+package sml
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Status is the status word of a ListEntry. Electricity meters use the bits defined in the table of the status word
+// of the FNN Lastenheft Basiszähler (Funktionale Merkmale), which are available as StatusFlag constants. Other bits
+// are manufacturer specific.
+type Status uint64
+
+// StatusFlag is a single bit of a Status.
+type StatusFlag uint64
+
+const (
+	// StatusFnn is always set in status words according to the FNN specification
+	StatusFnn StatusFlag = 1 << 2
+	// StatusEnergyExport is set while energy is exported (-A), and cleared while it is imported (+A)
+	StatusEnergyExport StatusFlag = 1 << 5
+	// StatusStartUp (Anlauf) is set while the measured power exceeds the start-up threshold of the meter, so it is
+	// set on normally running meters
+	StatusStartUp StatusFlag = 1 << 8
+	// StatusManipulation is set if a manipulation like a magnetic field has been detected
+	StatusManipulation StatusFlag = 1 << 9
+	// StatusPhaseFailureL1 is set if the voltage of phase L1 is missing
+	StatusPhaseFailureL1 StatusFlag = 1 << 12
+	// StatusPhaseFailureL2 is set if the voltage of phase L2 is missing
+	StatusPhaseFailureL2 StatusFlag = 1 << 13
+	// StatusPhaseFailureL3 is set if the voltage of phase L3 is missing
+	StatusPhaseFailureL3 StatusFlag = 1 << 14
+	// StatusRotationFieldError is set if the phases are not connected in clockwise rotation
+	StatusRotationFieldError StatusFlag = 1 << 15
+)
+
+var statusFlags = []StatusFlag{
+	StatusFnn,
+	StatusEnergyExport,
+	StatusStartUp,
+	StatusManipulation,
+	StatusPhaseFailureL1,
+	StatusPhaseFailureL2,
+	StatusPhaseFailureL3,
+	StatusRotationFieldError,
+}
+
+var statusFlagNames = map[StatusFlag]string{
+	StatusFnn:                "FNN",
+	StatusEnergyExport:       "energy export",
+	StatusStartUp:            "start-up",
+	StatusManipulation:       "manipulation",
+	StatusPhaseFailureL1:     "phase failure L1",
+	StatusPhaseFailureL2:     "phase failure L2",
+	StatusPhaseFailureL3:     "phase failure L3",
+	StatusRotationFieldError: "rotation field error",
+}
+
+func (f StatusFlag) String() string {
+	if name, ok := statusFlagNames[f]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("StatusFlag(%#x)", uint64(f))
+}
+
+// NewStatus converts the content of a status field like ListEntry.Status.
+// It returns false if the field is absent or not an unsigned integer.
+func NewStatus(status interface{}) (Status, bool) {
+	v := NewValue(status, 0)
+
+	if v.Kind().IsSigned() {
+		return 0, false
+	}
+
+	s, ok := v.Uint64()
+	return Status(s), ok
+}
+
+// Has reports whether the flag is set.
+func (s Status) Has(flag StatusFlag) bool {
+	return uint64(s)&uint64(flag) != 0
+}
+
+// Flags returns the known flags that are set.
+func (s Status) Flags() []StatusFlag {
+	var flags []StatusFlag
+
+	for _, f := range statusFlags {
+		if s.Has(f) {
+			flags = append(flags, f)
+		}
+	}
+
+	return flags
+}
+
+// PhaseFailure reports whether the voltage of any phase is missing.
+func (s Status) PhaseFailure() bool {
+	return s.Has(StatusPhaseFailureL1) || s.Has(StatusPhaseFailureL2) || s.Has(StatusPhaseFailureL3)
+}
+
+func (s Status) String() string {
+	str := fmt.Sprintf("%08x", uint64(s))
+	flags := s.Flags()
+
+	if len(flags) == 0 {
+		return str
+	}
+
+	names := make([]string, len(flags))
+
+	for i, f := range flags {
+		names[i] = f.String()
+	}
+
+	return str + " (" + strings.Join(names, ", ") + ")"
+}
+
+// stringStatus prints a status field, decoding the flags of unsigned integers.
+func stringStatus(status interface{}) string {
+	if status == nil {
+		return "null"
+	}
+
+	if s, ok := NewStatus(status); ok {
+		return s.String()
+	}
+
+	return stringValue(status)
+}
@@ -0,0 +1,102 @@
+package sml
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNewStatus(t *testing.T) {
+	u8 := uint8(0x04)
+	u64 := uint64(0x1234)
+	i32 := int32(4)
+
+	tests := []struct {
+		name   string
+		status interface{}
+		want   Status
+		wantOk bool
+	}{
+		{"uint8", uint8(0x04), 0x04, true},
+		{"uint16", uint16(0x0104), 0x0104, true},
+		{"uint32", uint32(0x00070304), 0x00070304, true},
+		{"uint64", uint64(0xffffffffffffffff), 0xffffffffffffffff, true},
+		{"pointer", &u8, 0x04, true},
+		{"pointer uint64", &u64, 0x1234, true},
+		{"absent", nil, 0, false},
+		{"nil pointer", (*uint32)(nil), 0, false},
+		{"signed", &i32, 0, false},
+		{"octet string", []byte{0x04}, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := NewStatus(tt.status)
+
+			if got != tt.want || ok != tt.wantOk {
+				t.Errorf("NewStatus() = %v, %t, want %v, %t", got, ok, tt.want, tt.wantOk)
+			}
+		})
+	}
+}
+
+func TestStatusString(t *testing.T) {
+	tests := []struct {
+		status Status
+		want   string
+	}{
+		{0, "00000000"},
+		{0x00000104, "00000104 (FNN, start-up)"},
+		{0x00000204, "00000204 (FNN, manipulation)"},
+		// Sent by a running eHZ meter, the upper bits are manufacturer specific
+		{0x001c0104, "001c0104 (FNN, start-up)"},
+		{0x00007024, "00007024 (FNN, energy export, phase failure L1, phase failure L2, phase failure L3)"},
+		{0x00010000, "00010000"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			if got := tt.status.String(); got != tt.want {
+				t.Errorf("String() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTypedStatus(t *testing.T) {
+	status := uint32(0x00001204)
+
+	typed := []struct {
+		name  string
+		value interface {
+			TypedStatus() (Status, bool)
+			String() string
+		}
+	}{
+		{"ListEntry", &ListEntry{Status: &status}},
+		{"ProfObjPeriodEntry", &ProfObjPeriodEntry{Status: &status}},
+		{"GetProfileListResMessageBody", &GetProfileListResMessageBody{Status: &status}},
+		{"TupelEntry", &TupelEntry{Status: &status}},
+	}
+
+	for _, tt := range typed {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := tt.value.TypedStatus()
+
+			if !ok || got != 0x1204 {
+				t.Errorf("TypedStatus() = %v, %t, want 00001204, true", got, ok)
+			}
+
+			if s := tt.value.String(); !strings.Contains(s, " Status = 00001204 (FNN, manipulation, phase failure L1)\n") {
+				t.Errorf("String() = %q, want the decoded status", s)
+			}
+
+			fields := marshalReflect(reflect.ValueOf(tt.value), "").(map[string]interface{})
+			want := []string{"FNN", "manipulation", "phase failure L1"}
+
+			if flags := fields["statusFlags"]; !reflect.DeepEqual(flags, want) {
+				t.Errorf("statusFlags = %v, want %v", flags, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package sml
+
+import (
+	"fmt"
+	"time"
+)
+
+// Time is a SML_Time. Exactly one of the fields is set.
+type Time struct {
+	SecIndex       *uint32         `sml:"tag:0x01"`
+	Timestamp      *uint32         `sml:"tag:0x02"`
+	LocalTimestamp *LocalTimestamp `sml:"tag:0x03"`
+}
+
+// LocalTimestamp is a UTC timestamp together with the offsets to the local time in minutes.
+type LocalTimestamp struct {
+	Timestamp        uint32
+	LocalOffset      int16
+	SeasonTimeOffset int16
+}
+
+// Time converts the SML_Time into a Go time.
+// A second index only counts the seconds since an arbitrary point, usually the power-up of the meter, and
+// can thus not be converted.
+func (t *Time) Time() (time.Time, bool) {
+	if t.Timestamp != nil {
+		return time.Unix(int64(*t.Timestamp), 0).UTC(), true
+	}
+
+	if t.LocalTimestamp != nil {
+		offset := (int(t.LocalTimestamp.LocalOffset) + int(t.LocalTimestamp.SeasonTimeOffset)) * 60
+		location := time.FixedZone("", offset)
+
+		return time.Unix(int64(t.LocalTimestamp.Timestamp), 0).In(location), true
+	}
+
+	return time.Time{}, false
+}
+
+func (t *Time) String() string {
+	if t.SecIndex != nil {
+		return fmt.Sprintf("(secIndex) %d", *t.SecIndex)
+	}
+
+	if goTime, ok := t.Time(); ok {
+		if t.LocalTimestamp != nil {
+			return "(localTimestamp) " + goTime.Format(time.RFC3339)
+		}
+
+		return "(timestamp) " + goTime.Format(time.RFC3339)
+	}
+
+	return "null"
+}
+
+func stringTime(t *Time) string {
+	if t == nil {
+		return "null"
+	}
+
+	return t.String()
+}
@@ -0,0 +1,87 @@
+package sml
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTime(t *testing.T) {
+	tests := []struct {
+		name     string
+		encoded  string
+		wantTime time.Time
+		wantOk   bool
+		want     string
+	}{
+		{
+			name:    "second index",
+			encoded: "72 6201 65 00bc614e",
+			want:    "(secIndex) 12345678",
+		},
+		{
+			name:     "timestamp",
+			encoded:  "72 6202 65 6553f100",
+			wantTime: time.Date(2023, 11, 14, 22, 13, 20, 0, time.UTC),
+			wantOk:   true,
+			want:     "(timestamp) 2023-11-14T22:13:20Z",
+		},
+		{
+			name:     "local timestamp in summer time",
+			encoded:  "72 6203 73 65 6553f100 53 003c 53 003c",
+			wantTime: time.Date(2023, 11, 15, 0, 13, 20, 0, time.FixedZone("", 2*60*60)),
+			wantOk:   true,
+			want:     "(localTimestamp) 2023-11-15T00:13:20+02:00",
+		},
+		{
+			name:     "local timestamp west of UTC",
+			encoded:  "72 6203 73 65 6553f100 53 ff10 53 0000",
+			wantTime: time.Date(2023, 11, 14, 18, 13, 20, 0, time.FixedZone("", -4*60*60)),
+			wantOk:   true,
+			want:     "(localTimestamp) 2023-11-14T18:13:20-04:00",
+		},
+		{
+			name:     "epoch",
+			encoded:  "72 6202 65 00000000",
+			wantTime: time.Unix(0, 0).UTC(),
+			wantOk:   true,
+			want:     "(timestamp) 1970-01-01T00:00:00Z",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var v Time
+
+			if err := decodeHex(t, tt.encoded, &v); err != nil {
+				t.Fatal(err)
+			}
+
+			got, ok := v.Time()
+
+			if ok != tt.wantOk || !got.Equal(tt.wantTime) {
+				t.Errorf("Time() = %v, %t, want %v, %t", got, ok, tt.wantTime, tt.wantOk)
+			}
+
+			_, gotOffset := got.Zone()
+			_, wantOffset := tt.wantTime.Zone()
+
+			if gotOffset != wantOffset {
+				t.Errorf("Time() has an offset of %d seconds, want %d", gotOffset, wantOffset)
+			}
+
+			if s := v.String(); s != tt.want {
+				t.Errorf("String() = %q, want %q", s, tt.want)
+			}
+		})
+	}
+}
+
+func TestStringTimeNil(t *testing.T) {
+	if s := stringTime(nil); s != "null" {
+		t.Errorf("stringTime(nil) = %q, want null", s)
+	}
+
+	if s := (&Time{}).String(); s != "null" {
+		t.Errorf("String() = %q, want null", s)
+	}
+}
@@ -0,0 +1,245 @@
+package sml
+
+import "fmt"
+
+// Unit is a unit code of the DLMS/COSEM unit enumeration, as used by the unit fields of the SML messages.
+type Unit uint8
+
+const (
+	UnitYear                           Unit = 1
+	UnitMonth                          Unit = 2
+	UnitWeek                           Unit = 3
+	UnitDay                            Unit = 4
+	UnitHour                           Unit = 5
+	UnitMinute                         Unit = 6
+	UnitSecond                         Unit = 7
+	UnitDegree                         Unit = 8
+	UnitDegreeCelsius                  Unit = 9
+	UnitCurrency                       Unit = 10
+	UnitMetre                          Unit = 11
+	UnitMetrePerSecond                 Unit = 12
+	UnitCubicMetre                     Unit = 13
+	UnitCorrectedCubicMetre            Unit = 14
+	UnitCubicMetrePerHour              Unit = 15
+	UnitCorrectedCubicMetrePerHour     Unit = 16
+	UnitCubicMetrePerDay               Unit = 17
+	UnitCorrectedCubicMetrePerDay      Unit = 18
+	UnitLitre                          Unit = 19
+	UnitKilogram                       Unit = 20
+	UnitNewton                         Unit = 21
+	UnitNewtonMetre                    Unit = 22
+	UnitPascal                         Unit = 23
+	UnitBar                            Unit = 24
+	UnitJoule                          Unit = 25
+	UnitJoulePerHour                   Unit = 26
+	UnitWatt                           Unit = 27
+	UnitVoltAmpere                     Unit = 28
+	UnitVar                            Unit = 29
+	UnitWattHour                       Unit = 30
+	UnitVoltAmpereHour                 Unit = 31
+	UnitVarHour                        Unit = 32
+	UnitAmpere                         Unit = 33
+	UnitCoulomb                        Unit = 34
+	UnitVolt                           Unit = 35
+	UnitVoltPerMetre                   Unit = 36
+	UnitFarad                          Unit = 37
+	UnitOhm                            Unit = 38
+	UnitOhmSquareMetrePerMetre         Unit = 39
+	UnitWeber                          Unit = 40
+	UnitTesla                          Unit = 41
+	UnitAmperePerMetre                 Unit = 42
+	UnitHenry                          Unit = 43
+	UnitHertz                          Unit = 44
+	UnitActiveEnergyMeterConstant      Unit = 45
+	UnitReactiveEnergyMeterConstant    Unit = 46
+	UnitApparentEnergyMeterConstant    Unit = 47
+	UnitVoltSquaredHour                Unit = 48
+	UnitAmpereSquaredHour              Unit = 49
+	UnitKilogramPerSecond              Unit = 50
+	UnitSiemens                        Unit = 51
+	UnitKelvin                         Unit = 52
+	UnitVoltSquaredHourMeterConstant   Unit = 53
+	UnitAmpereSquaredHourConstant      Unit = 54
+	UnitVolumeMeterConstant            Unit = 55
+	UnitPercent                        Unit = 56
+	UnitAmpereHour                     Unit = 57
+	UnitWattHourPerCubicMetre          Unit = 60
+	UnitJoulePerCubicMetre             Unit = 61
+	UnitMolePercent                    Unit = 62
+	UnitGramPerCubicMetre              Unit = 63
+	UnitPascalSecond                   Unit = 64
+	UnitJoulePerKilogram               Unit = 65
+	UnitGramPerSquareCentimetre        Unit = 66
+	UnitAtmosphere                     Unit = 67
+	UnitDecibelMilliwatt               Unit = 70
+	UnitDecibelMicrovolt               Unit = 71
+	UnitDecibel                        Unit = 72
+	UnitInch                           Unit = 128
+	UnitFoot                           Unit = 129
+	UnitPound                          Unit = 130
+	UnitDegreeFahrenheit               Unit = 131
+	UnitDegreeRankine                  Unit = 132
+	UnitSquareInch                     Unit = 133
+	UnitSquareFoot                     Unit = 134
+	UnitAcre                           Unit = 135
+	UnitCubicInch                      Unit = 136
+	UnitCubicFoot                      Unit = 137
+	UnitAcreFoot                       Unit = 138
+	UnitImperialGallon                 Unit = 139
+	UnitUSGallon                       Unit = 140
+	UnitPoundForce                     Unit = 141
+	UnitPoundForcePerSquareInch        Unit = 142
+	UnitPoundPerCubicFoot              Unit = 143
+	UnitPoundPerFootSecond             Unit = 144
+	UnitBritishThermalUnit             Unit = 145
+	UnitThermEU                        Unit = 146
+	UnitThermUS                        Unit = 147
+	UnitBritishThermalUnitPerPound     Unit = 148
+	UnitBritishThermalUnitPerCubicFoot Unit = 149
+	UnitReserved                       Unit = 253
+	UnitOther                          Unit = 254
+	UnitCount                          Unit = 255
+)
+
+type unitInfo struct {
+	symbol string
+	name   string
+}
+
+var units = map[Unit]unitInfo{
+	UnitYear:                           {"a", "year"},
+	UnitMonth:                          {"mo", "month"},
+	UnitWeek:                           {"wk", "week"},
+	UnitDay:                            {"d", "day"},
+	UnitHour:                           {"h", "hour"},
+	UnitMinute:                         {"min", "minute"},
+	UnitSecond:                         {"s", "second"},
+	UnitDegree:                         {"°", "phase angle in degrees"},
+	UnitDegreeCelsius:                  {"°C", "temperature in degrees Celsius"},
+	UnitCurrency:                       {"currency", "local currency"},
+	UnitMetre:                          {"m", "length"},
+	UnitMetrePerSecond:                 {"m/s", "speed"},
+	UnitCubicMetre:                     {"m³", "volume"},
+	UnitCorrectedCubicMetre:            {"m³", "corrected volume"},
+	UnitCubicMetrePerHour:              {"m³/h", "volume flux"},
+	UnitCorrectedCubicMetrePerHour:     {"m³/h", "corrected volume flux"},
+	UnitCubicMetrePerDay:               {"m³/d", "volume flux"},
+	UnitCorrectedCubicMetrePerDay:      {"m³/d", "corrected volume flux"},
+	UnitLitre:                          {"l", "volume in litres"},
+	UnitKilogram:                       {"kg", "mass"},
+	UnitNewton:                         {"N", "force"},
+	UnitNewtonMetre:                    {"Nm", "energy in newton metres"},
+	UnitPascal:                         {"Pa", "pressure in pascal"},
+	UnitBar:                            {"bar", "pressure in bar"},
+	UnitJoule:                          {"J", "energy in joules"},
+	UnitJoulePerHour:                   {"J/h", "thermal power"},
+	UnitWatt:                           {"W", "active power"},
+	UnitVoltAmpere:                     {"VA", "apparent power"},
+	UnitVar:                            {"var", "reactive power"},
+	UnitWattHour:                       {"Wh", "active energy"},
+	UnitVoltAmpereHour:                 {"VAh", "apparent energy"},
+	UnitVarHour:                        {"varh", "reactive energy"},
+	UnitAmpere:                         {"A", "current"},
+	UnitCoulomb:                        {"C", "electrical charge"},
+	UnitVolt:                           {"V", "voltage"},
+	UnitVoltPerMetre:                   {"V/m", "electrical field strength"},
+	UnitFarad:                          {"F", "capacitance"},
+	UnitOhm:                            {"Ω", "resistance"},
+	UnitOhmSquareMetrePerMetre:         {"Ωm²/m", "resistivity"},
+	UnitWeber:                          {"Wb", "magnetic flux"},
+	UnitTesla:                          {"T", "magnetic flux density"},
+	UnitAmperePerMetre:                 {"A/m", "magnetic field strength"},
+	UnitHenry:                          {"H", "inductance"},
+	UnitHertz:                          {"Hz", "frequency"},
+	UnitActiveEnergyMeterConstant:      {"1/(Wh)", "active energy meter constant or pulse value"},
+	UnitReactiveEnergyMeterConstant:    {"1/(varh)", "reactive energy meter constant or pulse value"},
+	UnitApparentEnergyMeterConstant:    {"1/(VAh)", "apparent energy meter constant or pulse value"},
+	UnitVoltSquaredHour:                {"V²h", "volt-squared hours"},
+	UnitAmpereSquaredHour:              {"A²h", "ampere-squared hours"},
+	UnitKilogramPerSecond:              {"kg/s", "mass flux"},
+	UnitSiemens:                        {"S", "conductance"},
+	UnitKelvin:                         {"K", "temperature in kelvin"},
+	UnitVoltSquaredHourMeterConstant:   {"1/(V²h)", "volt-squared hour meter constant or pulse value"},
+	UnitAmpereSquaredHourConstant:      {"1/(A²h)", "ampere-squared hour meter constant or pulse value"},
+	UnitVolumeMeterConstant:            {"1/m³", "volume meter constant or pulse value"},
+	UnitPercent:                        {"%", "percentage"},
+	UnitAmpereHour:                     {"Ah", "ampere-hours"},
+	UnitWattHourPerCubicMetre:          {"Wh/m³", "energy per volume"},
+	UnitJoulePerCubicMetre:             {"J/m³", "calorific value"},
+	UnitMolePercent:                    {"mol %", "molar fraction"},
+	UnitGramPerCubicMetre:              {"g/m³", "mass density"},
+	UnitPascalSecond:                   {"Pa s", "dynamic viscosity"},
+	UnitJoulePerKilogram:               {"J/kg", "specific energy"},
+	UnitGramPerSquareCentimetre:        {"g/cm²", "pressure in grams per square centimetre"},
+	UnitAtmosphere:                     {"atm", "pressure in atmospheres"},
+	UnitDecibelMilliwatt:               {"dBm", "signal strength"},
+	UnitDecibelMicrovolt:               {"dBµV", "signal strength"},
+	UnitDecibel:                        {"dB", "logarithmic unit"},
+	UnitInch:                           {"in", "length in inches"},
+	UnitFoot:                           {"ft", "length in feet"},
+	UnitPound:                          {"lb", "mass in pounds"},
+	UnitDegreeFahrenheit:               {"°F", "temperature in degrees Fahrenheit"},
+	UnitDegreeRankine:                  {"°R", "temperature in degrees Rankine"},
+	UnitSquareInch:                     {"sq in", "area in square inches"},
+	UnitSquareFoot:                     {"sq ft", "area in square feet"},
+	UnitAcre:                           {"ac", "area in acres"},
+	UnitCubicInch:                      {"cu in", "volume in cubic inches"},
+	UnitCubicFoot:                      {"cu ft", "volume in cubic feet"},
+	UnitAcreFoot:                       {"ac-ft", "volume in acre-feet"},
+	UnitImperialGallon:                 {"gal (imp)", "volume in imperial gallons"},
+	UnitUSGallon:                       {"gal (US)", "volume in US gallons"},
+	UnitPoundForce:                     {"lbf", "force in pounds"},
+	UnitPoundForcePerSquareInch:        {"psi", "pressure in pounds per square inch"},
+	UnitPoundPerCubicFoot:              {"lb/cu ft", "density"},
+	UnitPoundPerFootSecond:             {"lb/(ft s)", "dynamic viscosity"},
+	UnitBritishThermalUnit:             {"Btu", "energy in British thermal units"},
+	UnitThermEU:                        {"thm (EU)", "energy in EU therms"},
+	UnitThermUS:                        {"thm (US)", "energy in US therms"},
+	UnitBritishThermalUnitPerPound:     {"Btu/lb", "specific energy"},
+	UnitBritishThermalUnitPerCubicFoot: {"Btu/cu ft", "calorific value"},
+	UnitReserved:                       {"", "reserved"},
+	UnitOther:                          {"", "other unit"},
+	UnitCount:                          {"", "count"},
+}
+
+// info returns the table entry of the unit. The codes left unassigned by the unit enumeration
+// are reported as reserved, like the reserved code 253.
+func (u Unit) info() (unitInfo, bool) {
+	if info, ok := units[u]; ok {
+		return info, true
+	}
+
+	if u == 58 || u == 59 || u == 68 || u == 69 || (u >= 73 && u <= 127) {
+		return units[UnitReserved], true
+	}
+
+	return unitInfo{}, false
+}
+
+// Symbol returns the symbol of the unit, like "Wh" or "W".
+// Counts, other, reserved and unknown units have no symbol.
+func (u Unit) Symbol() string {
+	info, _ := u.info()
+	return info.symbol
+}
+
+// Name returns a description of the quantity measured in the unit, or an empty string for unknown units.
+func (u Unit) Name() string {
+	info, _ := u.info()
+	return info.name
+}
+
+func (u Unit) String() string {
+	info, ok := u.info()
+
+	// Unit 0 is sent when the unit is not present
+	if !ok {
+		return fmt.Sprintf("%d", uint8(u))
+	}
+
+	if info.symbol == "" {
+		return fmt.Sprintf("%d (%s)", uint8(u), info.name)
+	}
+
+	return fmt.Sprintf("%d (%s)", uint8(u), info.symbol)
+}
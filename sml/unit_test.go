@@ -0,0 +1,87 @@
+package sml
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestUnit(t *testing.T) {
+	tests := []struct {
+		unit       Unit
+		wantSymbol string
+		wantName   string
+		wantString string
+	}{
+		{unit: 0, wantString: "0"},
+		{unit: UnitYear, wantSymbol: "a", wantName: "year", wantString: "1 (a)"},
+		{unit: UnitWatt, wantSymbol: "W", wantName: "active power", wantString: "27 (W)"},
+		{unit: UnitWattHour, wantSymbol: "Wh", wantName: "active energy", wantString: "30 (Wh)"},
+		{unit: UnitAmpereHour, wantSymbol: "Ah", wantName: "ampere-hours", wantString: "57 (Ah)"},
+		{unit: 58, wantName: "reserved", wantString: "58 (reserved)"},
+		{unit: 59, wantName: "reserved", wantString: "59 (reserved)"},
+		{unit: UnitWattHourPerCubicMetre, wantSymbol: "Wh/m³", wantName: "energy per volume", wantString: "60 (Wh/m³)"},
+		{unit: UnitAtmosphere, wantSymbol: "atm", wantName: "pressure in atmospheres", wantString: "67 (atm)"},
+		{unit: 68, wantName: "reserved", wantString: "68 (reserved)"},
+		{unit: 69, wantName: "reserved", wantString: "69 (reserved)"},
+		{unit: UnitDecibel, wantSymbol: "dB", wantName: "logarithmic unit", wantString: "72 (dB)"},
+		{unit: 73, wantName: "reserved", wantString: "73 (reserved)"},
+		{unit: 127, wantName: "reserved", wantString: "127 (reserved)"},
+		{unit: UnitInch, wantSymbol: "in", wantName: "length in inches", wantString: "128 (in)"},
+		{unit: UnitBritishThermalUnitPerCubicFoot, wantSymbol: "Btu/cu ft", wantName: "calorific value", wantString: "149 (Btu/cu ft)"},
+		{unit: 150, wantString: "150"},
+		{unit: UnitReserved, wantName: "reserved", wantString: "253 (reserved)"},
+		{unit: UnitOther, wantName: "other unit", wantString: "254 (other unit)"},
+		{unit: UnitCount, wantName: "count", wantString: "255 (count)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.wantString, func(t *testing.T) {
+			if got := tt.unit.Symbol(); got != tt.wantSymbol {
+				t.Errorf("Symbol() = %q, want %q", got, tt.wantSymbol)
+			}
+
+			if got := tt.unit.Name(); got != tt.wantName {
+				t.Errorf("Name() = %q, want %q", got, tt.wantName)
+			}
+
+			if got := tt.unit.String(); got != tt.wantString {
+				t.Errorf("String() = %q, want %q", got, tt.wantString)
+			}
+		})
+	}
+}
+
+func TestUnitTable(t *testing.T) {
+	// Every code up to the last assigned one is either a unit or reserved
+	for u := UnitYear; u <= UnitBritishThermalUnitPerCubicFoot; u++ {
+		if u.Name() == "" {
+			t.Errorf("unit %d has no name", uint8(u))
+		}
+	}
+}
+
+func TestTupelEntryString(t *testing.T) {
+	entry := &TupelEntry{
+		UnitPA:   UnitWattHour,
+		ScalerPA: -1,
+		ValuePA:  12345,
+		UnitR1:   UnitVarHour,
+		UnitR4:   UnitVarHour,
+		UnitMA:   UnitWattHour,
+		UnitR2:   UnitVarHour,
+		UnitR3:   UnitVarHour,
+	}
+
+	s := entry.String()
+
+	for _, want := range []string{
+		" +A = 12345 * 10^-1 (unit 30 (Wh))\n",
+		" +R1 = 0 * 10^0 (unit 32 (varh))\n",
+		" -A = 0 * 10^0 (unit 30 (Wh))\n",
+		" -R3 = 0 * 10^0 (unit 32 (varh))\n",
+	} {
+		if !strings.Contains(s, want) {
+			t.Errorf("String() = %q, want it to contain %q", s, want)
+		}
+	}
+}
@@ -0,0 +1,234 @@
+package sml
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+)
+
+// ValueKind is the type a SML_Value was transmitted as.
+type ValueKind uint8
+
+const (
+	ValueKindNone ValueKind = iota
+	ValueKindBool
+	ValueKindOctetString
+	ValueKindInt8
+	ValueKindInt16
+	ValueKindInt32
+	ValueKindInt64
+	ValueKindUint8
+	ValueKindUint16
+	ValueKindUint32
+	ValueKindUint64
+)
+
+var valueKindNames = map[ValueKind]string{
+	ValueKindNone:        "null",
+	ValueKindBool:        "bool",
+	ValueKindOctetString: "octet string",
+	ValueKindInt8:        "int8",
+	ValueKindInt16:       "int16",
+	ValueKindInt32:       "int32",
+	ValueKindInt64:       "int64",
+	ValueKindUint8:       "uint8",
+	ValueKindUint16:      "uint16",
+	ValueKindUint32:      "uint32",
+	ValueKindUint64:      "uint64",
+}
+
+func (k ValueKind) String() string {
+	if name, ok := valueKindNames[k]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("ValueKind(%d)", uint8(k))
+}
+
+// IsInteger reports whether the kind is one of the signed or unsigned integers.
+func (k ValueKind) IsInteger() bool {
+	return k >= ValueKindInt8 && k <= ValueKindUint64
+}
+
+// IsSigned reports whether the kind is a signed integer.
+func (k ValueKind) IsSigned() bool {
+	return k >= ValueKindInt8 && k <= ValueKindInt64
+}
+
+// Value is a SML_Value converted from one of its possible types, together with the scaler of its entry.
+// The accessors return false as second result, when the value is of a different kind.
+type Value struct {
+	kind ValueKind
+	// Integers are sign-extended to 64 bits, booleans are stored as 0 and 1
+	bits   uint64
+	bytes  []byte
+	scaler int8
+}
+
+// NewValue converts the content of a SML_Value field like ListEntry.Value.
+// Values of unsupported types result in a Value of ValueKindNone.
+func NewValue(value interface{}, scaler int8) Value {
+	v := Value{
+		scaler: scaler,
+	}
+
+	r := reflect.ValueOf(value)
+
+	if r.Kind() == reflect.Pointer {
+		if r.IsNil() {
+			return v
+		}
+
+		r = r.Elem()
+	}
+
+	switch r.Kind() {
+	case reflect.Bool:
+		v.kind = ValueKindBool
+
+		if r.Bool() {
+			v.bits = 1
+		}
+	case reflect.Slice:
+		if r.Type().Elem().Kind() == reflect.Uint8 {
+			v.kind = ValueKindOctetString
+			v.bytes = r.Bytes()
+		}
+	case reflect.Int8:
+		v.kind = ValueKindInt8
+		v.bits = uint64(r.Int())
+	case reflect.Int16:
+		v.kind = ValueKindInt16
+		v.bits = uint64(r.Int())
+	case reflect.Int32:
+		v.kind = ValueKindInt32
+		v.bits = uint64(r.Int())
+	case reflect.Int64:
+		v.kind = ValueKindInt64
+		v.bits = uint64(r.Int())
+	case reflect.Uint8:
+		v.kind = ValueKindUint8
+		v.bits = r.Uint()
+	case reflect.Uint16:
+		v.kind = ValueKindUint16
+		v.bits = r.Uint()
+	case reflect.Uint32:
+		v.kind = ValueKindUint32
+		v.bits = r.Uint()
+	case reflect.Uint64:
+		v.kind = ValueKindUint64
+		v.bits = r.Uint()
+	}
+
+	return v
+}
+
+// Kind returns the type the value was transmitted as.
+func (v Value) Kind() ValueKind {
+	return v.kind
+}
+
+// Scaler returns the power of ten the value needs to be multiplied with.
+func (v Value) Scaler() int8 {
+	return v.scaler
+}
+
+// Int64 returns an integer value, if it fits into an int64. The scaler is not applied.
+func (v Value) Int64() (int64, bool) {
+	if !v.kind.IsInteger() || (!v.kind.IsSigned() && v.bits > math.MaxInt64) {
+		return 0, false
+	}
+
+	return int64(v.bits), true
+}
+
+// Uint64 returns an integer value, if it is not negative. The scaler is not applied.
+func (v Value) Uint64() (uint64, bool) {
+	if !v.kind.IsInteger() || (v.kind.IsSigned() && int64(v.bits) < 0) {
+		return 0, false
+	}
+
+	return v.bits, true
+}
+
+// Float64 returns an integer value as float. The scaler is not applied.
+func (v Value) Float64() (float64, bool) {
+	if !v.kind.IsInteger() {
+		return 0, false
+	}
+
+	if v.kind.IsSigned() {
+		return float64(int64(v.bits)), true
+	}
+
+	return float64(v.bits), true
+}
+
+// Bytes returns the content of an octet string.
+func (v Value) Bytes() ([]byte, bool) {
+	if v.kind != ValueKindOctetString {
+		return nil, false
+	}
+
+	return v.bytes, true
+}
+
+// Bool returns a boolean value.
+func (v Value) Bool() (bool, bool) {
+	if v.kind != ValueKindBool {
+		return false, false
+	}
+
+	return v.bits != 0, true
+}
+
+// Scaled returns an integer value multiplied with ten to the power of its scaler.
+// The result is exact, use big.Rat.Float64 or big.Rat.FloatString to convert it.
+func (v Value) Scaled() (*big.Rat, bool) {
+	if !v.kind.IsInteger() {
+		return nil, false
+	}
+
+	value := new(big.Int)
+
+	if v.kind.IsSigned() {
+		value.SetInt64(int64(v.bits))
+	} else {
+		value.SetUint64(v.bits)
+	}
+
+	scaler := int64(v.scaler)
+
+	if scaler < 0 {
+		scaler = -scaler
+	}
+
+	factor := new(big.Int).Exp(big.NewInt(10), big.NewInt(scaler), nil)
+
+	if v.scaler < 0 {
+		return new(big.Rat).SetFrac(value, factor), true
+	}
+
+	return new(big.Rat).SetInt(value.Mul(value, factor)), true
+}
+
+func (v Value) String() string {
+	switch {
+	case v.kind == ValueKindNone:
+		return "null"
+	case v.kind == ValueKindBool:
+		if v.bits != 0 {
+			return "(bool) True"
+		}
+
+		return "(bool) False"
+	case v.kind == ValueKindOctetString:
+		return "(octet string) " + hex.EncodeToString(v.bytes)
+	case v.kind.IsSigned():
+		return fmt.Sprintf("(%s) %d", v.kind, int64(v.bits))
+	default:
+		return fmt.Sprintf("(%s) %d", v.kind, v.bits)
+	}
+}
@@ -0,0 +1,113 @@
+package sml
+
+import (
+	"math"
+	"math/big"
+	"strings"
+	"testing"
+)
+
+func TestValueScaled(t *testing.T) {
+	int64Max, int64Min, uint64Max := int64(math.MaxInt64), int64(math.MinInt64), uint64(math.MaxUint64)
+	negative, positive, zero := int32(-12345), uint32(12345), uint8(0)
+
+	tests := []struct {
+		name   string
+		value  interface{}
+		scaler int8
+		want   string
+	}{
+		{"no scaler", &positive, 0, "12345"},
+		{"negative scaler", &positive, -1, "2469/2"},
+		{"negative value with negative scaler", &negative, -2, "-2469/20"},
+		{"negative value with positive scaler", &negative, 3, "-12345000"},
+		{"zero with scaler", &zero, -128, "0"},
+		{"smallest scaler", &positive, -128, "2469/2" + strings.Repeat("0", 127)},
+		{"largest scaler", &positive, 127, "12345" + strings.Repeat("0", 127)},
+		// Scaling must not overflow the 64 bits the integers are transmitted with
+		{"int64 maximum scaled up", &int64Max, 1, "92233720368547758070"},
+		{"int64 minimum scaled up", &int64Min, 2, "-922337203685477580800"},
+		{"int64 minimum scaled down", &int64Min, -1, "-4611686018427387904/5"},
+		{"uint64 maximum scaled up", &uint64Max, 1, "184467440737095516150"},
+		{"uint64 maximum scaled down", &uint64Max, -3, "3689348814741910323/200"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := NewValue(tt.value, tt.scaler).Scaled()
+
+			if !ok {
+				t.Fatal("Scaled() is not ok")
+			}
+
+			want, ok := new(big.Rat).SetString(tt.want)
+
+			if !ok {
+				t.Fatalf("invalid rational %s", tt.want)
+			}
+
+			if got.Cmp(want) != 0 {
+				t.Errorf("Scaled() = %s, want %s", got.RatString(), want.RatString())
+			}
+		})
+	}
+}
+
+func TestValueIntegers(t *testing.T) {
+	int8Min, int64Min := int8(math.MinInt8), int64(math.MinInt64)
+	uint64Max, uint64Fits := uint64(math.MaxUint64), uint64(math.MaxInt64)
+	octets, boolean := []byte{0x01}, true
+	var nilPointer *uint32
+
+	tests := []struct {
+		name       string
+		value      interface{}
+		kind       ValueKind
+		int64      int64
+		int64Ok    bool
+		uint64     uint64
+		uint64Ok   bool
+		float64    float64
+		float64Ok  bool
+		wantString string
+	}{
+		{"int8 minimum", &int8Min, ValueKindInt8, -128, true, 0, false, -128, true, "(int8) -128"},
+		{"int64 minimum", &int64Min, ValueKindInt64, math.MinInt64, true, 0, false, math.MinInt64, true, "(int64) -9223372036854775808"},
+		{"uint64 overflowing int64", &uint64Max, ValueKindUint64, 0, false, math.MaxUint64, true, math.MaxUint64, true, "(uint64) 18446744073709551615"},
+		{"uint64 fitting int64", &uint64Fits, ValueKindUint64, math.MaxInt64, true, math.MaxInt64, true, math.MaxInt64, true, "(uint64) 9223372036854775807"},
+		{"octet string", octets, ValueKindOctetString, 0, false, 0, false, 0, false, "(octet string) 01"},
+		{"bool", &boolean, ValueKindBool, 0, false, 0, false, 0, false, "(bool) True"},
+		{"nil pointer", nilPointer, ValueKindNone, 0, false, 0, false, 0, false, "null"},
+		{"unsupported type", "string", ValueKindNone, 0, false, 0, false, 0, false, "null"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := NewValue(tt.value, -1)
+
+			if v.Kind() != tt.kind {
+				t.Errorf("Kind() = %v, want %v", v.Kind(), tt.kind)
+			}
+
+			if got, ok := v.Int64(); got != tt.int64 || ok != tt.int64Ok {
+				t.Errorf("Int64() = %d, %t, want %d, %t", got, ok, tt.int64, tt.int64Ok)
+			}
+
+			if got, ok := v.Uint64(); got != tt.uint64 || ok != tt.uint64Ok {
+				t.Errorf("Uint64() = %d, %t, want %d, %t", got, ok, tt.uint64, tt.uint64Ok)
+			}
+
+			if got, ok := v.Float64(); got != tt.float64 || ok != tt.float64Ok {
+				t.Errorf("Float64() = %g, %t, want %g, %t", got, ok, tt.float64, tt.float64Ok)
+			}
+
+			if _, ok := v.Scaled(); ok != tt.kind.IsInteger() {
+				t.Errorf("Scaled() is ok %t, want %t", ok, tt.kind.IsInteger())
+			}
+
+			if got := v.String(); got != tt.wantString {
+				t.Errorf("String() = %q, want %q", got, tt.wantString)
+			}
+		})
+	}
+}
@@ -0,0 +1,30 @@
+package sml
+
+import "io"
+
+type Writer interface {
+	WriteFile(file *File) error
+}
+
+type smlWriterImpl struct {
+	binary *smlBinaryWriter
+}
+
+func NewWriter(writer io.Writer) Writer {
+	return &smlWriterImpl{
+		binary: newSmlBinaryWriter(writer),
+	}
+}
+
+// WriteFile serializes the file into a single SML transport frame.
+// The CRC16 of every message is calculated while writing, the Crc16 field of the messages is ignored.
+// Messages and entries that have been read and not modified since are written as they have been received.
+func (s *smlWriterImpl) WriteFile(file *File) error {
+	bundle, err := serializeMessageBundle(file)
+
+	if err != nil {
+		return err
+	}
+
+	return s.binary.writeMessageBundle(bundle)
+}
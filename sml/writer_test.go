@@ -0,0 +1,212 @@
+package sml
+
+import (
+	"bytes"
+	"encoding/hex"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// capturedMessage returns a message with the given elements after its type-length-field, followed by its CRC.
+func capturedMessage(tb testing.TB, elements string) []byte {
+	message, err := hex.DecodeString("76" + strings.ReplaceAll(elements, " ", ""))
+
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	checksum := newSmlBinaryWriter(nil).checksum(message)
+
+	return append(message, 0x63, byte(checksum>>8), byte(checksum), 0x00)
+}
+
+// capturedFrame resembles a frame of an eHZ meter. Like real meters, it transmits zero scalers, group numbers
+// and abort flags explicitly and uses integers of 5 bytes, which are not the minimal encoding chosen by the writer.
+func capturedFrame(tb testing.TB) []byte {
+	var payload []byte
+
+	payload = append(payload, capturedMessage(tb,
+		"05 00b1c2d1 6200 6200 72 630101 76 01 01 05 00b1c2d2 0b 0a01454d4800007f9e31 01 01")...)
+	payload = append(payload, capturedMessage(tb,
+		"05 00b1c2d3 6200 6200 72 630701 77 01 0b 0a01454d4800007f9e31 07 0100620affff 72 6201 65 00bc614e 75"+
+			"77 07 8181c78203ff 01 01 01 01 04 454d48 01"+
+			"77 07 0100000009ff 01 01 01 01 0b 0a01454d4800007f9e31 01"+
+			"77 07 0100010800ff 0101 621e 5200 56 0000001234 01"+
+			"77 07 0100020800ff 0101 621e 52ff 56 0000000017 01"+
+			"77 07 0100100700ff 01 01 621b 5200 55 fffff3ee 01"+
+			"01 01")...)
+	payload = append(payload, capturedMessage(tb,
+		"05 00b1c2d4 6200 6200 72 630201 71 01")...)
+
+	return fuzzFrame(payload)
+}
+
+func TestWriteFileRoundTrip(t *testing.T) {
+	frame := capturedFrame(t)
+
+	file, err := NewReader(bytes.NewReader(frame)).ReadFile()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf := &bytes.Buffer{}
+
+	if err := NewWriter(buf).WriteFile(file); err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(buf.Bytes(), frame) {
+		t.Errorf("WriteFile() = %x, want %x", buf.Bytes(), frame)
+	}
+}
+
+func TestWriteFileModifiedEntry(t *testing.T) {
+	file, err := NewReader(bytes.NewReader(capturedFrame(t))).ReadFile()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	valList := file.Messages[1].MessageBody.(*GetListResMessageBody).ValList
+	power := int32(-1234)
+	valList[4].Value = &power
+	valList[0].Value = []byte{0x01, 0x02}
+
+	buf := &bytes.Buffer{}
+
+	if err := NewWriter(buf).WriteFile(file); err != nil {
+		t.Fatal(err)
+	}
+
+	written, err := NewReader(bytes.NewReader(buf.Bytes())).ReadFile()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		entry int
+		want  string
+	}{
+		// The unmodified entries are written as they have been received
+		{"explicit zero scaler", 2, "77070100010800ff0101621e520056000000123401"},
+		{"negative scaler", 3, "77070100020800ff0101621e52ff56000000001701"},
+		// The modified entries are encoded again, keeping their explicit zero scaler and absent unit and scaler
+		{"modified", 4, "77070100100700ff0101621b520055fffffb2e01"},
+		{"modified without unit", 0, "77078181c78203ff0101010103010201"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entry := written.Messages[1].MessageBody.(*GetListResMessageBody).ValList[tt.entry]
+
+			if got := hex.EncodeToString(entry.raw); got != tt.want {
+				t.Errorf("raw = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteFileReaderMessageBodies(t *testing.T) {
+	options := ReaderOptions{
+		MessageBodies: map[uint32]MessageBodyFactory{
+			testReaderTag: func() MessageBody { return &vendorStateBody{} },
+		},
+	}
+
+	frame := vendorFrame(t, testReaderTag)
+	file, err := NewReaderWithOptions(bytes.NewReader(frame), options).ReadFile()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf := &bytes.Buffer{}
+
+	if err := NewWriter(buf).WriteFile(file); err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(buf.Bytes(), frame) {
+		t.Errorf("WriteFile() = %x, want %x", buf.Bytes(), frame)
+	}
+
+	// Modified bodies of the reader are encoded again
+	file.Messages[1].MessageBody.(*vendorStateBody).State = 43
+	buf.Reset()
+
+	if err := NewWriter(buf).WriteFile(file); err != nil {
+		t.Fatal(err)
+	}
+
+	written, err := NewReaderWithOptions(bytes.NewReader(buf.Bytes()), options).ReadFile()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := written.Messages[1].MessageBody.(*vendorStateBody).State; got != 43 {
+		t.Errorf("State = %d, want 43", got)
+	}
+}
+
+func TestWriteFileModifiedInPlace(t *testing.T) {
+	file, err := NewReader(bytes.NewReader(capturedFrame(t))).ReadFile()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	list := file.Messages[1].MessageBody.(*GetListResMessageBody)
+	list.ValList[3].ObjName[3] = 0x01
+
+	tests := []struct {
+		name      string
+		v         interface{}
+		unchanged bool
+	}{
+		{"modified entry", list.ValList[3], false},
+		{"unmodified entry", list.ValList[2], true},
+		{"list of the modified entry", list, false},
+		{"message of the modified entry", file.Messages[1], false},
+		{"unmodified message", file.Messages[0], true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, unchanged := unchangedReceived(reflect.ValueOf(tt.v).Elem()); unchanged != tt.unchanged {
+				t.Errorf("unchanged = %v, want %v", unchanged, tt.unchanged)
+			}
+		})
+	}
+}
+
+func TestWriteFileInvalidMessageCrc(t *testing.T) {
+	frame := capturedFrame(t)
+	closeRes := capturedMessage(t, "05 00b1c2d4 6200 6200 72 630201 71 01")
+	// Flip a bit of the CRC of the SML_PublicClose.Res message, which is followed by the end of message marker
+	frame[bytes.Index(frame, closeRes)+len(closeRes)-2] ^= 0x01
+
+	file, err := NewReaderWithOptions(bytes.NewReader(frame), ReaderOptions{SkipFrameCrc: true, SkipMessageCrc: true}).ReadFile()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if raw := file.Messages[2].raw; raw != nil {
+		t.Errorf("raw = %x, want the received encoding to be dropped", raw)
+	}
+
+	buf := &bytes.Buffer{}
+
+	if err := NewWriter(buf).WriteFile(file); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewReader(bytes.NewReader(buf.Bytes())).ReadFile(); err != nil {
+		t.Errorf("ReadFile() of the written file = %v, want the CRC to be calculated again", err)
+	}
+}
@@ -1,9 +1,12 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"net/http"
+	"strings"
+	"sync"
 )
 
 type webExporter struct {
@@ -11,6 +14,7 @@ type webExporter struct {
 	logger       logger
 
 	server *http.Server
+	lock   sync.Mutex
 }
 
 func newWebExporter(processImage *processImageManager, log logger) *webExporter {
@@ -21,12 +25,16 @@ func newWebExporter(processImage *processImageManager, log logger) *webExporter
 }
 
 func (i *webExporter) serve(cfg *webConfig) error {
+	i.lock.Lock()
+
 	if i.server != nil {
+		i.lock.Unlock()
 		return errors.New("server already started")
 	}
 
 	mux := http.NewServeMux()
 	mux.HandleFunc("/processImage", i.getProcessImage)
+	mux.HandleFunc("/lastFile/", i.getLastFile)
 
 	var handler http.Handler = mux
 
@@ -37,12 +45,26 @@ func (i *webExporter) serve(cfg *webConfig) error {
 		}
 	}
 
-	i.server = &http.Server{
+	server := &http.Server{
 		Addr:    cfg.Address,
 		Handler: handler,
 	}
 
-	return i.server.ListenAndServe()
+	i.server = server
+	i.lock.Unlock()
+
+	return server.ListenAndServe()
+}
+
+func (i *webExporter) shutdown(ctx context.Context) error {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	if i.server == nil {
+		return nil
+	}
+
+	return i.server.Shutdown(ctx)
 }
 
 func (i *webExporter) getProcessImage(resp http.ResponseWriter, _ *http.Request) {
@@ -59,6 +81,32 @@ func (i *webExporter) getProcessImage(resp http.ResponseWriter, _ *http.Request)
 	_, _ = resp.Write(marshal)
 }
 
+// getLastFile serves the last file received from the meter named in the path, decoded in full.
+func (i *webExporter) getLastFile(resp http.ResponseWriter, req *http.Request) {
+	f, ok := i.processImage.getLastFile(strings.TrimPrefix(req.URL.Path, "/lastFile/"))
+
+	if !ok {
+		resp.WriteHeader(404)
+		return
+	}
+
+	if f == nil {
+		resp.WriteHeader(204)
+		return
+	}
+
+	marshal, err := json.Marshal(f)
+
+	if err != nil {
+		i.logger.Printf("failed to serialize file: %v", err)
+		resp.WriteHeader(500)
+		return
+	}
+
+	resp.WriteHeader(200)
+	_, _ = resp.Write(marshal)
+}
+
 type webLoggerHandler struct {
 	logger logger
 	next   http.Handler